@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxCompareFiles is the number of files the compare API lists at most
+	maxCompareFiles = 300
+	// maxPreviousReleasePages bounds the release pages searched for the previous release
+	maxPreviousReleasePages = 3
+)
+
+// ChangedFiles are the files changed between two refs
+type ChangedFiles struct {
+	Files []string
+	// Truncated is set when the compare API cap was reached and more files may have changed
+	Truncated bool
+}
+
+// changeRangeEvent is implemented by events the paths filters apply to
+type changeRangeEvent interface {
+	// CompareRange returns the refs whose changes the paths filters are
+	// evaluated against. An empty base means the filters do not apply, an
+	// empty head that nothing changed.
+	CompareRange(ctx context.Context, client *github.Client) (base, head string, err error)
+}
+
+// changedFilesLoader computes the changed files of a delivery once, however many rules need them
+type changedFilesLoader struct {
+	client  *github.Client
+	event   Event
+	loaded  bool
+	changes *ChangedFiles
+	err     error
+}
+
+func newChangedFilesLoader(client *github.Client, event Event) *changedFilesLoader {
+	return &changedFilesLoader{client: client, event: event}
+}
+
+// Load returns the changed files, nil when the paths filters do not apply to the event
+func (l *changedFilesLoader) Load(ctx context.Context) (*ChangedFiles, error) {
+	if !l.loaded {
+		l.changes, l.err = l.load(ctx)
+		l.loaded = true
+	}
+	return l.changes, l.err
+}
+
+func (l *changedFilesLoader) load(ctx context.Context) (*ChangedFiles, error) {
+	rangeEvent, ok := l.event.(changeRangeEvent)
+	if !ok {
+		return nil, nil
+	}
+
+	base, head, err := rangeEvent.CompareRange(ctx, l.client)
+	if err != nil {
+		return nil, err
+	}
+	if base == "" {
+		return nil, nil
+	}
+	if head == "" {
+		return &ChangedFiles{}, nil
+	}
+
+	repo := l.event.Envelope().Repository
+	return compareChangedFiles(ctx, l.client, repo.Owner.Login, repo.Name, base, head)
+}
+
+// compareChangedFiles lists the files changed between base and head. Renamed
+// files are listed under their old and new names. The compare API returns at
+// most 300 files, spread over the pages of the comparison.
+func compareChangedFiles(ctx context.Context, client *github.Client, owner, repo, base, head string) (*ChangedFiles, error) {
+	changes := &ChangedFiles{}
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			changes.Files = append(changes.Files, name)
+		}
+	}
+
+	opts := &github.ListOptions{PerPage: 100}
+	fileCount := 0
+	for {
+		comparison, resp, err := client.Repositories.CompareCommits(ctx, owner, repo, base, head, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compare %s...%s: %w", base, head, err)
+		}
+
+		for _, file := range comparison.Files {
+			add(file.GetFilename())
+			add(file.GetPreviousFilename())
+		}
+		fileCount += len(comparison.Files)
+
+		// Files are only listed on the first page by GitHub, later pages list more commits
+		if len(comparison.Files) == 0 || resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	changes.Truncated = fileCount >= maxCompareFiles
+	if changes.Truncated {
+		logger.Warn("changed files truncated by the compare API",
+			zap.String("repo", owner+"/"+repo),
+			zap.String("base", base),
+			zap.String("head", head),
+		)
+	}
+	return changes, nil
+}
+
+// hasPathFilters reports whether the rule restricts changed paths
+func hasPathFilters(rule Rule) bool {
+	return len(rule.Paths) > 0 || len(rule.PathsIgnore) > 0
+}
+
+// matchPathFilters applies the rule's paths and paths-ignore filters with
+// GitHub Actions semantics and returns the files that made the rule match.
+// With paths at least one changed file has to match. With only paths-ignore at
+// least one changed file has to be outside the ignored paths; when the list
+// was truncated an unlisted file may be, so the rule matches.
+func matchPathFilters(rule Rule, changes *ChangedFiles) ([]string, bool) {
+	var matched []string
+	for _, file := range changes.Files {
+		if len(rule.Paths) > 0 && !matchGlobs(file, rule.Paths) {
+			continue
+		}
+		if len(rule.PathsIgnore) > 0 && matchGlobs(file, rule.PathsIgnore) {
+			continue
+		}
+		matched = append(matched, file)
+	}
+
+	if len(rule.Paths) == 0 && changes.Truncated {
+		return matched, true
+	}
+	return matched, len(matched) > 0
+}
+
+// isNullSHA reports whether the SHA is the all zero SHA GitHub sends for created and deleted refs
+func isNullSHA(sha string) bool {
+	return sha == "" || strings.Trim(sha, "0") == ""
+}
+
+// findPreviousRelease returns the tag of the release published before the
+// given one, "" when it is the first. Stable releases are compared with the
+// previous stable release, skipping the prereleases in between.
+func findPreviousRelease(ctx context.Context, client *github.Client, owner, repo string, release *Release) (string, error) {
+	found := false
+	opts := &github.ListOptions{PerPage: 100}
+	for page := 0; page < maxPreviousReleasePages; page++ {
+		releases, resp, err := client.Repositories.ListReleases(ctx, owner, repo, opts)
+		if err != nil {
+			return "", fmt.Errorf("failed to list releases: %w", err)
+		}
+
+		// Releases are listed newest first
+		for _, candidate := range releases {
+			if !found {
+				found = candidate.GetID() == release.ID
+				continue
+			}
+			if candidate.GetDraft() || (candidate.GetPrerelease() && !release.Prerelease) {
+				continue
+			}
+			return candidate.GetTagName(), nil
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return "", nil
+}
+
+// evaluatePathFilters checks the rule's paths filters against the changed
+// files of the delivery and returns the matching files. The files are nil when
+// the rule has no paths filters or they do not apply to the event.
+func evaluatePathFilters(ctx context.Context, loader *changedFilesLoader, rule Rule) ([]string, bool, error) {
+	if !hasPathFilters(rule) {
+		return nil, true, nil
+	}
+
+	changes, err := loader.Load(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	if changes == nil {
+		return nil, true, nil
+	}
+
+	paths, matched := matchPathFilters(rule, changes)
+	if paths == nil {
+		paths = []string{}
+	}
+	return paths, matched, nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// fakeCompare serves the compare and releases APIs. The comparison lists its
+// files on the first page only and has as many pages as configured.
+type fakeCompare struct {
+	files    []map[string]string
+	pages    int
+	releases []map[string]interface{}
+	compared []string
+}
+
+func (f *fakeCompare) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	page := 1
+	fmt.Sscanf(r.URL.Query().Get("page"), "%d", &page)
+	next := func() {
+		query := r.URL.Query()
+		query.Set("page", fmt.Sprint(page+1))
+		w.Header().Set("Link", fmt.Sprintf(`<http://%s%s?%s>; rel="next"`, r.Host, r.URL.Path, query.Encode()))
+	}
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/repos/owner/repo/compare/"):
+		f.compared = append(f.compared, strings.TrimPrefix(r.URL.Path, "/repos/owner/repo/compare/"))
+		if page < f.pages {
+			next()
+		}
+		files := f.files
+		if page > 1 {
+			files = nil
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"files": files})
+	case r.URL.Path == "/repos/owner/repo/releases":
+		start := (page - 1) * 2
+		end := start + 2
+		if end < len(f.releases) {
+			next()
+		} else {
+			end = len(f.releases)
+		}
+		json.NewEncoder(w).Encode(f.releases[start:end])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newFakeCompareClient(t *testing.T, fake *fakeCompare) *github.Client {
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client
+}
+
+func TestCompareChangedFiles(t *testing.T) {
+	fake := &fakeCompare{
+		pages: 3,
+		files: []map[string]string{
+			{"filename": "docs/index.md"},
+			{"filename": "src/new.go", "previous_filename": "src/old.go"},
+		},
+	}
+	client := newFakeCompareClient(t, fake)
+
+	changes, err := compareChangedFiles(context.Background(), client, "owner", "repo", "aaa", "bbb")
+	if err != nil {
+		t.Fatalf("compareChangedFiles() error = %v", err)
+	}
+	if want := []string{"docs/index.md", "src/new.go", "src/old.go"}; !reflect.DeepEqual(changes.Files, want) {
+		t.Errorf("Files = %v, want %v", changes.Files, want)
+	}
+	if changes.Truncated {
+		t.Error("expected a complete file list")
+	}
+	if len(fake.compared) != 2 {
+		t.Errorf("expected paging to stop at the first page without files, got %d requests", len(fake.compared))
+	}
+
+	fake.files = nil
+	for i := 0; i < maxCompareFiles; i++ {
+		fake.files = append(fake.files, map[string]string{"filename": fmt.Sprintf("file-%d", i)})
+	}
+	changes, err = compareChangedFiles(context.Background(), client, "owner", "repo", "aaa", "bbb")
+	if err != nil || !changes.Truncated {
+		t.Errorf("expected a truncated file list, got %v, %v", changes.Truncated, err)
+	}
+}
+
+func TestMatchPathFilters(t *testing.T) {
+	changes := &ChangedFiles{Files: []string{"docs/index.md", "docs/api/users.md", "src/main.go"}}
+
+	tests := []struct {
+		name      string
+		rule      Rule
+		changes   *ChangedFiles
+		wantPaths []string
+		want      bool
+	}{
+		{"paths match", Rule{Paths: []string{"docs/**"}}, changes, []string{"docs/index.md", "docs/api/users.md"}, true},
+		{"paths single level", Rule{Paths: []string{"docs/*"}}, changes, []string{"docs/index.md"}, true},
+		{"paths miss", Rule{Paths: []string{"infra/**"}}, changes, nil, false},
+		{"paths with negation", Rule{Paths: []string{"docs/**", "!docs/api/**"}}, changes, []string{"docs/index.md"}, true},
+		{"paths-ignore leaves files", Rule{PathsIgnore: []string{"docs/**"}}, changes, []string{"src/main.go"}, true},
+		{"paths-ignore covers every file", Rule{PathsIgnore: []string{"docs/**", "src/**"}}, changes, nil, false},
+		{"paths and paths-ignore", Rule{Paths: []string{"docs/**"}, PathsIgnore: []string{"**/users.md"}}, changes, []string{"docs/index.md"}, true},
+		{"paths-ignore truncated", Rule{PathsIgnore: []string{"docs/**"}}, &ChangedFiles{Files: []string{"docs/a.md"}, Truncated: true}, nil, true},
+		{"paths truncated without match", Rule{Paths: []string{"src/**"}}, &ChangedFiles{Files: []string{"docs/a.md"}, Truncated: true}, nil, false},
+		{"nothing changed", Rule{Paths: []string{"**"}}, &ChangedFiles{}, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths, matched := matchPathFilters(tt.rule, tt.changes)
+			if matched != tt.want || !reflect.DeepEqual(paths, tt.wantPaths) {
+				t.Errorf("matchPathFilters() = %v, %v, want %v, %v", paths, matched, tt.wantPaths, tt.want)
+			}
+		})
+	}
+}
+
+func TestPushCompareRange(t *testing.T) {
+	null := strings.Repeat("0", 40)
+	repo := Repository{Name: "repo", Owner: User{Login: "owner"}, DefaultBranch: "main"}
+
+	tests := []struct {
+		name     string
+		event    PushEvent
+		wantBase string
+		wantHead string
+	}{
+		{"branch push", PushEvent{Ref: "refs/heads/main", Before: "aaa", After: "bbb"}, "aaa", "bbb"},
+		{"tag push", PushEvent{Ref: "refs/tags/v1.0.0", Before: null, After: "bbb"}, "", ""},
+		{"new branch", PushEvent{Ref: "refs/heads/feature", Before: null, After: "bbb", Created: true}, "main", "bbb"},
+		{"new default branch", PushEvent{Ref: "refs/heads/main", Before: null, After: "bbb", Created: true}, "", ""},
+		{"deleted branch", PushEvent{Ref: "refs/heads/feature", Before: "aaa", After: null, Deleted: true}, "refs/heads/feature", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.event.Repository = repo
+			base, head, err := tt.event.CompareRange(context.Background(), nil)
+			if err != nil || base != tt.wantBase || head != tt.wantHead {
+				t.Errorf("CompareRange() = %q, %q, %v, want %q, %q", base, head, err, tt.wantBase, tt.wantHead)
+			}
+		})
+	}
+}
+
+func TestFindPreviousRelease(t *testing.T) {
+	fake := &fakeCompare{releases: []map[string]interface{}{
+		{"id": 6, "tag_name": "v2.1.0", "draft": true},
+		{"id": 5, "tag_name": "v2.0.0"},
+		{"id": 4, "tag_name": "v2.0.0-rc.2", "prerelease": true},
+		{"id": 3, "tag_name": "v2.0.0-rc.1", "prerelease": true},
+		{"id": 2, "tag_name": "v1.9.0", "draft": true},
+		{"id": 1, "tag_name": "v1.8.0"},
+	}}
+	client := newFakeCompareClient(t, fake)
+
+	tests := []struct {
+		name    string
+		release *Release
+		want    string
+	}{
+		{"stable skips prereleases and drafts", &Release{ID: 5, TagName: "v2.0.0"}, "v1.8.0"},
+		{"prerelease compares with any release", &Release{ID: 4, TagName: "v2.0.0-rc.2", Prerelease: true}, "v2.0.0-rc.1"},
+		{"first release", &Release{ID: 1, TagName: "v1.8.0"}, ""},
+		{"unknown release", &Release{ID: 99, TagName: "v9.0.0"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := findPreviousRelease(context.Background(), client, "owner", "repo", tt.release)
+			if err != nil || got != tt.want {
+				t.Errorf("findPreviousRelease() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluatePathFilters(t *testing.T) {
+	fake := &fakeCompare{pages: 1, files: []map[string]string{{"filename": "docs/index.md"}}}
+	client := newFakeCompareClient(t, fake)
+
+	event := &PushEvent{
+		WebhookPayload: WebhookPayload{Repository: Repository{Name: "repo", Owner: User{Login: "owner"}}},
+		Ref:            "refs/heads/main",
+		Before:         "aaa",
+		After:          "bbb",
+	}
+	loader := newChangedFilesLoader(client, event)
+
+	paths, matched, err := evaluatePathFilters(context.Background(), loader, Rule{Paths: []string{"docs/**"}})
+	if err != nil || !matched || !reflect.DeepEqual(paths, []string{"docs/index.md"}) {
+		t.Errorf("docs rule = %v, %v, %v", paths, matched, err)
+	}
+
+	paths, matched, err = evaluatePathFilters(context.Background(), loader, Rule{PathsIgnore: []string{"docs/**"}})
+	if err != nil || matched || len(paths) != 0 {
+		t.Errorf("paths-ignore rule = %v, %v, %v", paths, matched, err)
+	}
+
+	if paths, matched, _ := evaluatePathFilters(context.Background(), loader, Rule{}); !matched || paths != nil {
+		t.Errorf("rule without paths filters = %v, %v", paths, matched)
+	}
+
+	if !reflect.DeepEqual(fake.compared, []string{"aaa...bbb"}) {
+		t.Errorf("compared %v, want a single aaa...bbb comparison", fake.compared)
+	}
+}
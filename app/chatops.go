@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+	"go.uber.org/zap"
+)
+
+const (
+	dispatchCommandName  = "/dispatch"
+	dispatchCommandUsage = "usage: /dispatch <event_type> <target-repo> [args...]"
+	// maxDispatchCommands caps the commands run from a single comment
+	maxDispatchCommands = 10
+
+	defaultChatOpsPermission = "write"
+)
+
+// permissionRanks orders the repository roles returned by the collaborator permission API
+var permissionRanks = map[string]int{
+	"none":     0,
+	"read":     1,
+	"triage":   2,
+	"write":    3,
+	"maintain": 4,
+	"admin":    5,
+}
+
+// ChatOpsConfig configures the slash commands run from issue and pull request comments
+type ChatOpsConfig struct {
+	// Permission is the minimum permission on the source repository needed to
+	// run commands: read, triage, write (default), maintain or admin
+	Permission string `yaml:"permission" mapstructure:"permission"`
+}
+
+// DispatchCommand is a /dispatch command parsed from a comment
+type DispatchCommand struct {
+	// Line is the command as written, quoted in the reply
+	Line      string
+	EventType string
+	Repo      string
+	// Args are the words after the target repo, forwarded in the client_payload
+	Args []string
+	// Err is set when the line is not a valid command
+	Err string
+}
+
+// commandSource is implemented by events carrying slash commands. Their
+// dispatches are resolved from the commands instead of the dispatch rules.
+type commandSource interface {
+	DispatchCommands() []DispatchCommand
+}
+
+// parseDispatchCommands returns the /dispatch commands of a comment, one per line
+func parseDispatchCommands(body string) []DispatchCommand {
+	var commands []DispatchCommand
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		words := strings.Fields(line)
+		if len(words) == 0 || words[0] != dispatchCommandName {
+			continue
+		}
+		if len(commands) == maxDispatchCommands {
+			break
+		}
+
+		command := DispatchCommand{Line: line}
+		if len(words) < 3 {
+			command.Err = dispatchCommandUsage
+		} else {
+			command.EventType = words[1]
+			command.Repo = words[2]
+			command.Args = words[3:]
+		}
+		commands = append(commands, command)
+	}
+	return commands
+}
+
+// commandResult is the outcome of a command, quoted in the reply
+type commandResult struct {
+	command DispatchCommand
+	status  string
+	reason  string
+}
+
+// runDispatchCommands checks the commenter's permission, resolves every
+// command against the configured targets, sends the dispatches and answers
+// the comment with a reaction and a summary
+func runDispatchCommands(ctx context.Context, d *dispatcher, config *AppConfig, source commandSource) {
+	commands := source.DispatchCommands()
+	if len(commands) == 0 {
+		return
+	}
+
+	payload := d.event.Envelope()
+	owner, repo := payload.Repository.Owner.Login, payload.Repository.Name
+	results := make([]commandResult, 0, len(commands))
+
+	// Every command ends the same way when they cannot run at all
+	rejectAll := func(status, reason string) {
+		for _, command := range commands {
+			d.report.addTarget(-1, Target{Repo: command.Repo, EventType: command.EventType}, status, reason)
+			results = append(results, commandResult{command: command, status: status, reason: reason})
+		}
+	}
+
+	fields, reason, err := authorizeCommands(ctx, d, config)
+	switch {
+	case err != nil:
+		logger.Error("failed to authorize dispatch command", zap.Error(err))
+		rejectAll(targetStatusFailed, err.Error())
+	case reason != "":
+		logger.Info("dispatch command rejected", zap.String("sender", payload.Sender.Login), zap.String("reason", reason))
+		rejectAll(targetStatusSkipped, reason)
+	default:
+		for i, command := range commands {
+			results = append(results, runDispatchCommand(ctx, d, config, i, command, fields))
+		}
+	}
+
+	replyToCommands(ctx, d.client, owner, repo, d.event, results)
+}
+
+// authorizeCommands checks the sender's permission on the source repository
+// and returns the client_payload fields shared by the commands, or why the
+// commands may not run
+func authorizeCommands(ctx context.Context, d *dispatcher, config *AppConfig) (map[string]interface{}, string, error) {
+	payload := d.event.Envelope()
+	owner, repo := payload.Repository.Owner.Login, payload.Repository.Name
+
+	required := defaultChatOpsPermission
+	if config.ChatOps != nil && config.ChatOps.Permission != "" {
+		required = strings.ToLower(config.ChatOps.Permission)
+	}
+	if _, ok := permissionRanks[required]; !ok || required == "none" {
+		return nil, "", fmt.Errorf("invalid chatops permission %q", required)
+	}
+
+	permission, err := repositoryPermission(ctx, d.client, owner, repo, payload.Sender.Login)
+	if err != nil {
+		return nil, "", err
+	}
+	if permissionRanks[permission] < permissionRanks[required] {
+		return nil, fmt.Sprintf("sender %s has %s permission, %s is required", payload.Sender.Login, permission, required), nil
+	}
+
+	fields := map[string]interface{}{}
+	if issue, ok := d.event.(*IssueCommentEvent); ok && issue.Issue.PullRequest != nil {
+		// Downstream workflows need the pull request head to act on it
+		pr, _, err := d.client.PullRequests.Get(ctx, owner, repo, issue.Issue.Number)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get pull request #%d: %w", issue.Issue.Number, err)
+		}
+		fields["pull_request"] = map[string]interface{}{
+			"number":   pr.GetNumber(),
+			"head_ref": pr.GetHead().GetRef(),
+			"head_sha": pr.GetHead().GetSHA(),
+			"base_ref": pr.GetBase().GetRef(),
+		}
+	}
+	return fields, "", nil
+}
+
+// repositoryPermission returns the user's role on the repository, "none" for
+// users who are not collaborators
+func repositoryPermission(ctx context.Context, client *github.Client, owner, repo, user string) (string, error) {
+	level, _, err := client.Repositories.GetPermissionLevel(ctx, owner, repo, user)
+	if err != nil {
+		var errResp *github.ErrorResponse
+		if errors.As(err, &errResp) && errResp.Response.StatusCode == http.StatusNotFound {
+			return "none", nil
+		}
+		return "", fmt.Errorf("failed to get permission of %s: %w", user, err)
+	}
+
+	// role_name distinguishes triage and maintain, which permission reports as read and write
+	if role := level.GetUser().GetRoleName(); role != "" {
+		if _, ok := permissionRanks[role]; ok {
+			return role, nil
+		}
+	}
+	return level.GetPermission(), nil
+}
+
+// runDispatchCommand sends the dispatch of a single command to the target it
+// names, index is the position of the command in the comment
+func runDispatchCommand(ctx context.Context, d *dispatcher, config *AppConfig, index int, command DispatchCommand, fields map[string]interface{}) commandResult {
+	result := commandResult{command: command}
+	target := Target{Repo: command.Repo, EventType: command.EventType}
+
+	if command.Err != "" {
+		result.status, result.reason = targetStatusSkipped, command.Err
+		d.report.addTarget(-1, target, result.status, result.reason)
+		return result
+	}
+
+	ruleIndex, targetIndex, ok := resolveCommandTarget(config, d.event.Envelope().Repository.Owner.Login, command)
+	if !ok {
+		result.status = targetStatusSkipped
+		result.reason = fmt.Sprintf("no target %s with event_type %s is configured", command.Repo, command.EventType)
+		d.report.addTarget(-1, target, result.status, result.reason)
+		return result
+	}
+
+	rule := config.Dispatches[ruleIndex]
+	if !d.report.hasMatchedRule(ruleIndex) {
+		d.report.MatchedRules = append(d.report.MatchedRules, RuleReport{Index: ruleIndex, Event: rule.Event})
+	}
+
+	commandFields := make(map[string]interface{}, len(fields)+1)
+	for key, value := range fields {
+		commandFields[key] = value
+	}
+	commandFields["command"] = map[string]interface{}{
+		"event_type": command.EventType,
+		"repo":       rule.Targets[targetIndex].Repo,
+		"args":       append([]string{}, command.Args...),
+	}
+
+	dispatchID := deferredCommandDispatchID(d.deliveryID, index, ruleIndex, targetIndex)
+	report := d.dispatchAs(ctx, dispatchID, ruleIndex, rule, rule.Targets[targetIndex], commandFields)
+	result.status, result.reason = report.Status, report.Reason
+	return result
+}
+
+// resolveCommandTarget finds the first configured target with the command's
+// repo and event_type. The repo may be given as owner/repo of the source owner.
+func resolveCommandTarget(config *AppConfig, owner string, command DispatchCommand) (int, int, bool) {
+	repo := command.Repo
+	if prefix, name, found := strings.Cut(repo, "/"); found {
+		if !strings.EqualFold(prefix, owner) {
+			return 0, 0, false
+		}
+		repo = name
+	}
+
+	for i, rule := range config.Dispatches {
+		for j, target := range rule.Targets {
+			if strings.EqualFold(target.Repo, repo) && target.EventType == command.EventType {
+				return i, j, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// commandReaction picks the reaction to the comment: rocket when every
+// command was sent or deferred, confused when one failed and -1 otherwise
+func commandReaction(results []commandResult) string {
+	accepted := 0
+	for _, result := range results {
+		switch result.status {
+		case targetStatusFailed:
+			return "confused"
+		case targetStatusSent, targetStatusDeferred:
+			accepted++
+		}
+	}
+	if accepted == len(results) {
+		return "rocket"
+	}
+	return "-1"
+}
+
+// formatCommandReply renders the outcome of every command as a markdown table
+func formatCommandReply(sender string, results []commandResult) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "@%s\n\n| Command | Result |\n|---|---|\n", sender)
+	for _, result := range results {
+		outcome := result.status
+		if result.reason != "" {
+			outcome += ": " + result.reason
+		}
+		fmt.Fprintf(&b, "| `%s` | %s |\n", strings.ReplaceAll(result.command.Line, "`", "'"), strings.ReplaceAll(outcome, "|", "\\|"))
+	}
+	return b.String()
+}
+
+// replyToCommands reacts to the comment and answers it with the results.
+// Failures are only logged, the dispatches were already sent.
+func replyToCommands(ctx context.Context, client *github.Client, owner, repo string, event Event, results []commandResult) {
+	issue, ok := event.(*IssueCommentEvent)
+	if !ok {
+		return
+	}
+
+	if _, _, err := client.Reactions.CreateIssueCommentReaction(ctx, owner, repo, issue.Comment.ID, commandReaction(results)); err != nil {
+		logger.Warn("failed to react to command comment", zap.Int64("commentId", issue.Comment.ID), zap.Error(err))
+	}
+
+	body := formatCommandReply(issue.Sender.Login, results)
+	if _, _, err := client.Issues.CreateComment(ctx, owner, repo, issue.Issue.Number, &github.IssueComment{Body: &body}); err != nil {
+		logger.Warn("failed to reply to command comment", zap.Int("issue", issue.Issue.Number), zap.Error(err))
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+func TestParseDispatchCommands(t *testing.T) {
+	body := "Looks good, redeploying.\n" +
+		"/dispatch deploy target-repo-1\n" +
+		"  /dispatch rebuild my-org/target-repo-2 --clean fast  \n" +
+		"/dispatch deploy\n" +
+		"/dispatcher deploy target-repo-1\n" +
+		"please /dispatch deploy target-repo-3"
+
+	commands := parseDispatchCommands(body)
+	if len(commands) != 3 {
+		t.Fatalf("parseDispatchCommands() = %+v, want 3 commands", commands)
+	}
+	if c := commands[0]; c.EventType != "deploy" || c.Repo != "target-repo-1" || len(c.Args) != 0 || c.Err != "" {
+		t.Errorf("commands[0] = %+v", c)
+	}
+	if c := commands[1]; c.EventType != "rebuild" || c.Repo != "my-org/target-repo-2" || strings.Join(c.Args, " ") != "--clean fast" || c.Line != "/dispatch rebuild my-org/target-repo-2 --clean fast" {
+		t.Errorf("commands[1] = %+v", c)
+	}
+	if c := commands[2]; c.Err != dispatchCommandUsage {
+		t.Errorf("commands[2] = %+v, want usage error", c)
+	}
+
+	if commands := parseDispatchCommands(strings.Repeat("/dispatch deploy repo\n", 20)); len(commands) != maxDispatchCommands {
+		t.Errorf("got %d commands, want them capped at %d", len(commands), maxDispatchCommands)
+	}
+}
+
+func TestIssueCommentDispatchCommands(t *testing.T) {
+	event := func(action, login, userType string) *IssueCommentEvent {
+		return &IssueCommentEvent{
+			WebhookPayload: WebhookPayload{Action: action, Sender: User{Login: login, Type: userType}},
+			Comment:        IssueComment{Body: "/dispatch deploy prod"},
+		}
+	}
+
+	if commands := event("created", "alice", "User").DispatchCommands(); len(commands) != 1 {
+		t.Errorf("created comment commands = %+v, want 1", commands)
+	}
+	if commands := event("edited", "alice", "User").DispatchCommands(); commands != nil {
+		t.Errorf("edited comment commands = %+v, want none", commands)
+	}
+	if commands := event("created", "my-app[bot]", "Bot").DispatchCommands(); commands != nil {
+		t.Errorf("bot comment commands = %+v, want none", commands)
+	}
+}
+
+func TestResolveCommandTarget(t *testing.T) {
+	config := &AppConfig{Dispatches: []Rule{
+		{Event: "release", Targets: []Target{{Repo: "prod", EventType: "deploy"}}},
+		{Event: "push", Targets: []Target{{Repo: "staging", EventType: "deploy"}, {Repo: "prod", EventType: "build"}}},
+	}}
+
+	tests := []struct {
+		name       string
+		command    DispatchCommand
+		wantRule   int
+		wantTarget int
+		wantOK     bool
+	}{
+		{"first match", DispatchCommand{EventType: "deploy", Repo: "prod"}, 0, 0, true},
+		{"case insensitive repo", DispatchCommand{EventType: "build", Repo: "Prod"}, 1, 1, true},
+		{"owner prefix", DispatchCommand{EventType: "deploy", Repo: "my-org/staging"}, 1, 0, true},
+		{"other owner", DispatchCommand{EventType: "deploy", Repo: "evil-org/staging"}, 0, 0, false},
+		{"unknown event type", DispatchCommand{EventType: "destroy", Repo: "prod"}, 0, 0, false},
+		{"unknown repo", DispatchCommand{EventType: "deploy", Repo: "dev"}, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, target, ok := resolveCommandTarget(config, "my-org", tt.command)
+			if ok != tt.wantOK || (ok && (rule != tt.wantRule || target != tt.wantTarget)) {
+				t.Errorf("resolveCommandTarget() = %d, %d, %v, want %d, %d, %v", rule, target, ok, tt.wantRule, tt.wantTarget, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestCommandReaction(t *testing.T) {
+	tests := []struct {
+		statuses []string
+		want     string
+	}{
+		{[]string{targetStatusSent}, "rocket"},
+		{[]string{targetStatusSent, targetStatusDeferred}, "rocket"},
+		{[]string{targetStatusSent, targetStatusFailed}, "confused"},
+		{[]string{targetStatusSent, targetStatusSkipped}, "-1"},
+		{[]string{targetStatusSkipped}, "-1"},
+	}
+
+	for _, tt := range tests {
+		results := make([]commandResult, len(tt.statuses))
+		for i, status := range tt.statuses {
+			results[i].status = status
+		}
+		if got := commandReaction(results); got != tt.want {
+			t.Errorf("commandReaction(%v) = %q, want %q", tt.statuses, got, tt.want)
+		}
+	}
+}
+
+// fakeChatOpsGitHub serves the APIs used by dispatch commands and records dispatches, reactions and replies
+type fakeChatOpsGitHub struct {
+	mu         sync.Mutex
+	role       string
+	dispatches []string
+	payloads   []map[string]interface{}
+	reactions  []string
+	replies    []string
+}
+
+func (f *fakeChatOpsGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	switch {
+	case r.URL.Path == "/repos/my-org/app/collaborators/alice/permission":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"permission": "write",
+			"user":       map[string]interface{}{"login": "alice", "role_name": f.role},
+		})
+	case r.URL.Path == "/repos/my-org/app/pulls/7":
+		w.Write([]byte(`{"number": 7, "head": {"ref": "feature", "sha": "abc123"}, "base": {"ref": "main"}}`))
+	case strings.HasSuffix(r.URL.Path, "/dispatches"):
+		var request struct {
+			EventType     string                 `json:"event_type"`
+			ClientPayload map[string]interface{} `json:"client_payload"`
+		}
+		json.Unmarshal(body, &request)
+		f.dispatches = append(f.dispatches, strings.TrimPrefix(strings.TrimSuffix(r.URL.Path, "/dispatches"), "/repos/")+" "+request.EventType)
+		f.payloads = append(f.payloads, request.ClientPayload)
+		w.WriteHeader(http.StatusNoContent)
+	case r.URL.Path == "/repos/my-org/app/issues/comments/42/reactions":
+		var reaction struct {
+			Content string `json:"content"`
+		}
+		json.Unmarshal(body, &reaction)
+		f.reactions = append(f.reactions, reaction.Content)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{}`))
+	case r.URL.Path == "/repos/my-org/app/issues/7/comments":
+		var comment struct {
+			Body string `json:"body"`
+		}
+		json.Unmarshal(body, &comment)
+		f.replies = append(f.replies, comment.Body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message": "Not Found"}`))
+	}
+}
+
+func TestRunDispatchCommands(t *testing.T) {
+	config := &AppConfig{Dispatches: []Rule{
+		{Event: "release", Targets: []Target{
+			{Repo: "target-repo-1", EventType: "deploy"},
+			{Repo: "target-repo-2", EventType: "deploy", Senders: &SenderPolicy{Deny: []string{"alice"}}},
+		}},
+	}}
+
+	tests := []struct {
+		name           string
+		role           string
+		permission     string
+		wantDispatches []string
+		wantReaction   string
+		wantReply      []string
+	}{
+		{
+			name:           "maintainer",
+			role:           "maintain",
+			wantDispatches: []string{"my-org/target-repo-1 deploy"},
+			wantReaction:   "-1",
+			wantReply: []string{
+				"| `/dispatch deploy target-repo-1 now` | sent |",
+				"| `/dispatch deploy target-repo-2` | skipped: sender alice is denied |",
+				"| `/dispatch deploy unknown` | skipped: no target unknown with event_type deploy is configured |",
+			},
+		},
+		{
+			name:         "insufficient permission",
+			role:         "triage",
+			wantReaction: "-1",
+			wantReply:    []string{"skipped: sender alice has triage permission, write is required"},
+		},
+		{
+			name:           "lowered permission",
+			role:           "triage",
+			permission:     "triage",
+			wantDispatches: []string{"my-org/target-repo-1 deploy"},
+			wantReaction:   "-1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeChatOpsGitHub{role: tt.role}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+
+			client := github.NewClient(nil)
+			client.BaseURL, _ = url.Parse(server.URL + "/")
+
+			event := &IssueCommentEvent{
+				WebhookPayload: WebhookPayload{
+					Action:     "created",
+					Repository: Repository{Name: "app", FullName: "my-org/app", Owner: User{Login: "my-org"}},
+					Sender:     User{Login: "alice", Type: "User"},
+				},
+				Issue:   Issue{Number: 7, PullRequest: &IssuePullRequest{URL: "https://api.github.com/repos/my-org/app/pulls/7"}},
+				Comment: IssueComment{ID: 42, Body: "/dispatch deploy target-repo-1 now\n/dispatch deploy target-repo-2\n/dispatch deploy unknown"},
+			}
+
+			cfg := *config
+			if tt.permission != "" {
+				cfg.ChatOps = &ChatOpsConfig{Permission: tt.permission}
+			}
+			report := newDispatchReport("delivery-1", event)
+			d := newDispatcher("delivery-1", event, client, &cfg, report)
+			runDispatchCommands(context.Background(), d, &cfg, event)
+
+			if strings.Join(fake.dispatches, ",") != strings.Join(tt.wantDispatches, ",") {
+				t.Errorf("dispatches = %v, want %v", fake.dispatches, tt.wantDispatches)
+			}
+			if len(fake.reactions) != 1 || fake.reactions[0] != tt.wantReaction {
+				t.Errorf("reactions = %v, want %q", fake.reactions, tt.wantReaction)
+			}
+			if len(fake.replies) != 1 {
+				t.Fatalf("replies = %v, want one", fake.replies)
+			}
+			for _, line := range tt.wantReply {
+				if !strings.Contains(fake.replies[0], line) {
+					t.Errorf("reply %q does not contain %q", fake.replies[0], line)
+				}
+			}
+			if len(report.Targets) != 3 {
+				t.Errorf("report targets = %+v, want one per command", report.Targets)
+			}
+
+			if len(fake.payloads) > 0 {
+				payload := fake.payloads[0]
+				command, _ := payload["command"].(map[string]interface{})
+				pr, _ := payload["pull_request"].(map[string]interface{})
+				if command["repo"] != "target-repo-1" || pr["head_sha"] != "abc123" || payload["source_event"] != "issue_comment" {
+					t.Errorf("client_payload = %v", payload)
+				}
+			}
+		})
+	}
+}
+
+func TestDeferredDispatchCommands(t *testing.T) {
+	previous := deferredDispatchStore
+	store := newMemoryDeferredDispatchStore()
+	deferredDispatchStore = store
+	defer func() { deferredDispatchStore = previous }()
+
+	fake := &fakeChatOpsGitHub{role: "write"}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	config := &AppConfig{
+		Dispatches: []Rule{{Event: "release", Targets: []Target{{Repo: "target-repo-1", EventType: "deploy"}}}},
+		Freezes:    []FreezeWindow{{Name: "release-freeze", From: "2020-01-01", To: time.Now().AddDate(0, 0, 1).Format("2006-01-02"), Mode: freezeModeDefer}},
+	}
+	event := &IssueCommentEvent{
+		WebhookPayload: WebhookPayload{
+			Action:     "created",
+			Repository: Repository{Name: "app", FullName: "my-org/app", Owner: User{Login: "my-org"}},
+			Sender:     User{Login: "alice", Type: "User"},
+		},
+		Issue:   Issue{Number: 7},
+		Comment: IssueComment{ID: 42, Body: "/dispatch deploy target-repo-1 eu\n/dispatch deploy target-repo-1 us"},
+	}
+
+	report := newDispatchReport("delivery-1", event)
+	d := newDispatcher("delivery-1", event, client, config, report)
+	runDispatchCommands(context.Background(), d, config, event)
+
+	// Both commands defer their own dispatch to the same target
+	due, err := store.Due(context.Background(), time.Now().AddDate(1, 0, 0))
+	if err != nil {
+		t.Fatalf("Due() error = %v", err)
+	}
+	if len(due) != 2 || due[0].ID == due[1].ID {
+		t.Fatalf("deferred dispatches = %+v, want one per command", due)
+	}
+	var args []string
+	for _, dispatch := range due {
+		var payload struct {
+			Command struct {
+				Args []string `json:"args"`
+			} `json:"command"`
+		}
+		if err := json.Unmarshal(dispatch.ClientPayload, &payload); err != nil {
+			t.Fatalf("failed to decode client_payload: %v", err)
+		}
+		args = append(args, payload.Command.Args...)
+	}
+	slices.Sort(args)
+	if strings.Join(args, ",") != "eu,us" {
+		t.Errorf("deferred command args = %v, want [eu us]", args)
+	}
+}
@@ -3,17 +3,39 @@ package main
 import (
 	"context"
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"go.uber.org/zap"
 )
 
+const (
+	// processingModeSync processes deliveries inside the webhook request
+	processingModeSync = "sync"
+	// processingModeAsync enqueues deliveries and acknowledges the webhook immediately
+	processingModeAsync = "async"
+)
+
 var (
+	awsConfig              aws.Config
 	ssmClient              *ssm.Client
+	idempotencyStore       IdempotencyStore
+	installationRegistry   InstallationRegistry
+	deferredDispatchStore  DeferredDispatchStore
+	deliveryQueue          DeliveryQueue
+	processingMode         string
 	githubAppPrivateKeyPem string
 	githubAppWebhookSecret string
-	githubAppID            int64 
+	githubAppID            int64
+
+	// githubAppPreviousWebhookSecrets are still accepted while a secret rotation is rolled out
+	githubAppPreviousWebhookSecrets []string
+	// allowSHA1Signatures accepts the legacy X-Hub-Signature header when no SHA-256 signature is sent
+	allowSHA1Signatures bool
+	// logPayloadPreviews logs a redacted preview of webhook bodies at debug level
+	logPayloadPreviews bool
 )
 
 func loadSSMParameter(ctx context.Context, paramName string) (string, error) {
@@ -31,3 +53,33 @@ func loadSSMParameter(ctx context.Context, paramName string) (string, error) {
 
 	return *result.Parameter.Value, nil
 }
+
+// envOrDefault returns the value of the environment variable or fallback when unset
+func envOrDefault(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// splitSecrets splits a newline or comma separated list of secrets
+func splitSecrets(value string) []string {
+	var secrets []string
+	for _, secret := range strings.FieldsFunc(value, func(r rune) bool { return r == '\n' || r == ',' }) {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			secrets = append(secrets, secret)
+		}
+	}
+	return secrets
+}
+
+// splitList splits a list on sep, trimming entries and dropping empty ones
+func splitList(value string, sep string) []string {
+	var items []string
+	for _, item := range strings.Split(value, sep) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{"* * * * *", false},
+		{"0 9 * * MON-FRI", false},
+		{"*/15 8-18 1,15 jan-mar 7", false},
+		{"5/10 * * * *", false},
+		{"* * * *", true},
+		{"60 * * * *", true},
+		{"* 24 * * *", true},
+		{"* * 0 * *", true},
+		{"* * * 13 *", true},
+		{"* * * * FUNDAY", true},
+		{"*/0 * * * *", true},
+		{"5-1 * * * *", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := parseCron(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseCron(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCronMatches(t *testing.T) {
+	// 2025-12-19 is a Friday
+	friday := time.Date(2025, 12, 19, 14, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		t    time.Time
+		want bool
+	}{
+		{"* 12-23 * * FRI", friday, true},
+		{"* 12-23 * * FRI", friday.Add(-3 * time.Hour), false},
+		{"* 12-23 * * FRI", friday.AddDate(0, 0, 1), false},
+		{"*/15 * * * *", friday, true},
+		{"*/20 * * * *", friday, false},
+		{"* * * * 0", friday.AddDate(0, 0, 2), true},
+		{"* * * * 7", friday.AddDate(0, 0, 2), true},
+		{"* * * DEC *", friday, true},
+		// Both day fields restricted: either one matches
+		{"* * 1 * FRI", friday, true},
+		{"* * 1 * MON", friday, false},
+		{"* * 19 * MON", friday, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr+" "+tt.t.Format(time.RFC3339), func(t *testing.T) {
+			schedule, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("parseCron() error = %v", err)
+			}
+			if got := schedule.Matches(tt.t); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	start := time.Date(2025, 12, 19, 14, 30, 20, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2025, 12, 19, 14, 31, 0, 0, time.UTC)},
+		{"0 9 * * MON-FRI", time.Date(2025, 12, 22, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			schedule, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("parseCron() error = %v", err)
+			}
+			if got := schedule.Next(start); !got.Equal(tt.want) {
+				t.Errorf("Next() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCronNextNonMatching(t *testing.T) {
+	start := time.Date(2025, 12, 19, 14, 30, 0, 0, time.UTC)
+
+	schedule, _ := parseCron("* 12-17 * * FRI")
+	if got, want := schedule.NextNonMatching(start), time.Date(2025, 12, 19, 18, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("NextNonMatching() = %v, want %v", got, want)
+	}
+
+	schedule, _ = parseCron("* * * * *")
+	if got := schedule.NextNonMatching(start); !got.IsZero() {
+		t.Errorf("NextNonMatching() = %v, want zero time", got)
+	}
+}
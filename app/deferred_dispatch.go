@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"go.uber.org/zap"
+)
+
+// DeferredDispatch is a repository dispatch held back by a defer freeze
+// window, sent once the window closes
+type DeferredDispatch struct {
+	// ID is derived from the delivery, rule and target so a redelivery defers the dispatch only once
+	ID             string          `json:"id"`
+	DeliveryID     string          `json:"delivery_id"`
+	InstallationID int64           `json:"installation_id"`
+	Owner          string          `json:"owner"`
+	Target         Target          `json:"target"`
+	ClientPayload  json.RawMessage `json:"client_payload"`
+	NotBefore      time.Time       `json:"not_before"`
+	Freeze         string          `json:"freeze"`
+}
+
+func deferredDispatchID(deliveryID string, ruleIndex, targetIndex int) string {
+	return fmt.Sprintf("%s-%d-%d", deliveryID, ruleIndex, targetIndex)
+}
+
+// deferredCommandDispatchID also includes the index of the chatops command,
+// a comment may dispatch to the same target more than once
+func deferredCommandDispatchID(deliveryID string, commandIndex, ruleIndex, targetIndex int) string {
+	return fmt.Sprintf("%s-command-%d", deferredDispatchID(deliveryID, ruleIndex, targetIndex), commandIndex)
+}
+
+// DeferredDispatchStore persists deferred dispatches until they are due
+type DeferredDispatchStore interface {
+	Put(ctx context.Context, dispatch *DeferredDispatch) error
+	// Due returns the dispatches whose NotBefore is at or before now, oldest first
+	Due(ctx context.Context, now time.Time) ([]*DeferredDispatch, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// newDeferredDispatchStore builds the store selected by the DEFERRED_DISPATCH_STORE env var
+func newDeferredDispatchStore(cfg aws.Config) (DeferredDispatchStore, error) {
+	switch store := os.Getenv("DEFERRED_DISPATCH_STORE"); store {
+	case "", "memory":
+		return newMemoryDeferredDispatchStore(), nil
+	case "file":
+		dir := os.Getenv("DEFERRED_DISPATCH_DIR")
+		if dir == "" {
+			dir = filepath.Join(os.TempDir(), "github-app-deferred")
+		}
+		return newFileDeferredDispatchStore(dir)
+	case "dynamodb":
+		table := os.Getenv("DEFERRED_DISPATCH_TABLE")
+		if table == "" {
+			return nil, fmt.Errorf("DEFERRED_DISPATCH_TABLE is required for the dynamodb store")
+		}
+		return newDynamoDeferredDispatchStore(newDynamoDBClient(cfg), table), nil
+	default:
+		return nil, fmt.Errorf("unknown deferred dispatch store %q", store)
+	}
+}
+
+// sendDeferredDispatches is the scheduled task sending the deferred dispatches
+// whose freeze window closed. Failed dispatches stay stored and are retried on
+// the next run.
+func sendDeferredDispatches(ctx context.Context) error {
+	sent, err := sendDueDispatches(ctx, deferredDispatchStore, time.Now())
+	if err != nil {
+		return err
+	}
+	logger.Info("deferred dispatch run complete", zap.Int("sent", sent))
+	return nil
+}
+
+// sendDeferredDispatchesEvery runs sendDeferredDispatches on every tick until ctx is done
+func sendDeferredDispatchesEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := sendDeferredDispatches(ctx); err != nil {
+				logger.Error("failed to send deferred dispatches", zap.Error(err))
+			}
+		}
+	}
+}
+
+// sendDueDispatches sends the dispatches due at now and returns how many were sent
+func sendDueDispatches(ctx context.Context, store DeferredDispatchStore, now time.Time) (int, error) {
+	due, err := store.Due(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	var failures []string
+	for _, dispatch := range due {
+		target := fmt.Sprintf("%s/%s", dispatch.Owner, dispatch.Target.Repo)
+
+		client, err := createGitHubClient(dispatch.InstallationID)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", target, err))
+			continue
+		}
+		if err := dispatchClientPayload(ctx, client, dispatch.Owner, dispatch.Target, dispatch.ClientPayload); err != nil {
+			logger.Error("failed to send deferred dispatch",
+				zap.String("id", dispatch.ID),
+				zap.String("target", target),
+				zap.Error(err),
+			)
+			failures = append(failures, fmt.Sprintf("%s: %v", target, err))
+			continue
+		}
+
+		// A dispatch sent but not deleted is sent again on the next run
+		if err := store.Delete(ctx, dispatch.ID); err != nil {
+			logger.Error("failed to delete deferred dispatch", zap.String("id", dispatch.ID), zap.Error(err))
+		}
+		sent++
+	}
+
+	if len(failures) > 0 {
+		return sent, fmt.Errorf("%d deferred dispatches failed: %s", len(failures), strings.Join(failures, "; "))
+	}
+	return sent, nil
+}
+
+// memoryDeferredDispatchStore keeps deferred dispatches for the lifetime of the process
+type memoryDeferredDispatchStore struct {
+	mu         sync.Mutex
+	dispatches map[string]DeferredDispatch
+}
+
+func newMemoryDeferredDispatchStore() *memoryDeferredDispatchStore {
+	return &memoryDeferredDispatchStore{dispatches: make(map[string]DeferredDispatch)}
+}
+
+func (s *memoryDeferredDispatchStore) Put(ctx context.Context, dispatch *DeferredDispatch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dispatches[dispatch.ID] = *dispatch
+	return nil
+}
+
+func (s *memoryDeferredDispatchStore) Due(ctx context.Context, now time.Time) ([]*DeferredDispatch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []*DeferredDispatch
+	for _, dispatch := range s.dispatches {
+		if !dispatch.NotBefore.After(now) {
+			d := dispatch
+			due = append(due, &d)
+		}
+	}
+	sortDeferredDispatches(due)
+	return due, nil
+}
+
+func (s *memoryDeferredDispatchStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.dispatches, id)
+	return nil
+}
+
+// fileDeferredDispatchStore keeps one JSON file per deferred dispatch in a directory
+type fileDeferredDispatchStore struct {
+	dir string
+}
+
+func newFileDeferredDispatchStore(dir string) (*fileDeferredDispatchStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create deferred dispatch directory: %w", err)
+	}
+	return &fileDeferredDispatchStore{dir: dir}, nil
+}
+
+func (s *fileDeferredDispatchStore) Put(ctx context.Context, dispatch *DeferredDispatch) error {
+	data, err := json.MarshalIndent(dispatch, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode deferred dispatch: %w", err)
+	}
+
+	// Write then rename so readers never see a partial file
+	tmp := s.path(dispatch.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write deferred dispatch: %w", err)
+	}
+	if err := os.Rename(tmp, s.path(dispatch.ID)); err != nil {
+		return fmt.Errorf("failed to write deferred dispatch: %w", err)
+	}
+	return nil
+}
+
+func (s *fileDeferredDispatchStore) Due(ctx context.Context, now time.Time) ([]*DeferredDispatch, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deferred dispatches: %w", err)
+	}
+
+	var due []*DeferredDispatch
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read deferred dispatch: %w", err)
+		}
+
+		var dispatch DeferredDispatch
+		if err := json.Unmarshal(data, &dispatch); err != nil {
+			return nil, fmt.Errorf("failed to decode deferred dispatch: %w", err)
+		}
+		if !dispatch.NotBefore.After(now) {
+			due = append(due, &dispatch)
+		}
+	}
+	sortDeferredDispatches(due)
+	return due, nil
+}
+
+func (s *fileDeferredDispatchStore) Delete(ctx context.Context, id string) error {
+	if err := os.Remove(s.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete deferred dispatch: %w", err)
+	}
+	return nil
+}
+
+func (s *fileDeferredDispatchStore) path(id string) string {
+	// Delivery IDs are GUIDs, but keep the name safe whatever they are
+	return filepath.Join(s.dir, strings.NewReplacer("/", "_", "\\", "_").Replace(id)+".json")
+}
+
+// dynamoDBDeferredDispatchAPI is the subset of the DynamoDB client used by dynamoDeferredDispatchStore
+type dynamoDBDeferredDispatchAPI interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+}
+
+// dynamoDeferredDispatchStore stores each deferred dispatch as a JSON document
+// keyed by dispatch_id, with not_before as epoch seconds to scan for due ones
+type dynamoDeferredDispatchStore struct {
+	client dynamoDBDeferredDispatchAPI
+	table  string
+}
+
+func newDynamoDeferredDispatchStore(client dynamoDBDeferredDispatchAPI, table string) *dynamoDeferredDispatchStore {
+	return &dynamoDeferredDispatchStore{client: client, table: table}
+}
+
+func (s *dynamoDeferredDispatchStore) Put(ctx context.Context, dispatch *DeferredDispatch) error {
+	data, err := json.Marshal(dispatch)
+	if err != nil {
+		return fmt.Errorf("failed to encode deferred dispatch: %w", err)
+	}
+
+	if _, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item: map[string]types.AttributeValue{
+			"dispatch_id": &types.AttributeValueMemberS{Value: dispatch.ID},
+			"not_before":  &types.AttributeValueMemberN{Value: strconv.FormatInt(dispatch.NotBefore.Unix(), 10)},
+			"record":      &types.AttributeValueMemberS{Value: string(data)},
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to put deferred dispatch: %w", err)
+	}
+	return nil
+}
+
+func (s *dynamoDeferredDispatchStore) Due(ctx context.Context, now time.Time) ([]*DeferredDispatch, error) {
+	var due []*DeferredDispatch
+	input := &dynamodb.ScanInput{
+		TableName:        aws.String(s.table),
+		FilterExpression: aws.String("not_before <= :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+		},
+		ConsistentRead: aws.Bool(true),
+	}
+	for {
+		output, err := s.client.Scan(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan deferred dispatches: %w", err)
+		}
+		for _, item := range output.Items {
+			attr, ok := item["record"].(*types.AttributeValueMemberS)
+			if !ok {
+				return nil, fmt.Errorf("deferred dispatch item has no record attribute")
+			}
+			var dispatch DeferredDispatch
+			if err := json.Unmarshal([]byte(attr.Value), &dispatch); err != nil {
+				return nil, fmt.Errorf("failed to decode deferred dispatch: %w", err)
+			}
+			due = append(due, &dispatch)
+		}
+		if output.LastEvaluatedKey == nil {
+			break
+		}
+		input.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+	sortDeferredDispatches(due)
+	return due, nil
+}
+
+func (s *dynamoDeferredDispatchStore) Delete(ctx context.Context, id string) error {
+	if _, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(s.table),
+		Key: map[string]types.AttributeValue{
+			"dispatch_id": &types.AttributeValueMemberS{Value: id},
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to delete deferred dispatch: %w", err)
+	}
+	return nil
+}
+
+func sortDeferredDispatches(dispatches []*DeferredDispatch) {
+	sort.Slice(dispatches, func(i, j int) bool {
+		if !dispatches[i].NotBefore.Equal(dispatches[j].NotBefore) {
+			return dispatches[i].NotBefore.Before(dispatches[j].NotBefore)
+		}
+		return dispatches[i].ID < dispatches[j].ID
+	})
+}
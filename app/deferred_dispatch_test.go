@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// fakeDeferredDynamoDB keeps items by dispatch_id and applies the not_before scan filter
+type fakeDeferredDynamoDB struct {
+	mu    sync.Mutex
+	items map[string]map[string]types.AttributeValue
+}
+
+func newFakeDeferredDynamoDB() *fakeDeferredDynamoDB {
+	return &fakeDeferredDynamoDB{items: make(map[string]map[string]types.AttributeValue)}
+}
+
+func (f *fakeDeferredDynamoDB) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.items[params.Item["dispatch_id"].(*types.AttributeValueMemberS).Value] = params.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeDeferredDynamoDB) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.items, params.Key["dispatch_id"].(*types.AttributeValueMemberS).Value)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func (f *fakeDeferredDynamoDB) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now, _ := strconv.ParseInt(params.ExpressionAttributeValues[":now"].(*types.AttributeValueMemberN).Value, 10, 64)
+	output := &dynamodb.ScanOutput{}
+	for _, item := range f.items {
+		notBefore, _ := strconv.ParseInt(item["not_before"].(*types.AttributeValueMemberN).Value, 10, 64)
+		if notBefore <= now {
+			output.Items = append(output.Items, item)
+		}
+	}
+	return output, nil
+}
+
+func TestDeferredDispatchStores(t *testing.T) {
+	fileStore, err := newFileDeferredDispatchStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	stores := map[string]DeferredDispatchStore{
+		"memory":   newMemoryDeferredDispatchStore(),
+		"file":     fileStore,
+		"dynamodb": newDynamoDeferredDispatchStore(newFakeDeferredDynamoDB(), "deferred"),
+	}
+
+	now := time.Date(2025, 12, 19, 12, 0, 0, 0, time.UTC)
+	dispatches := []*DeferredDispatch{
+		{ID: deferredDispatchID("delivery-1", 0, 1), NotBefore: now.Add(time.Hour)},
+		{ID: deferredDispatchID("delivery-2", 0, 0), NotBefore: now},
+		{ID: deferredDispatchID("delivery-1", 0, 0), NotBefore: now.Add(-time.Hour)},
+	}
+	for _, dispatch := range dispatches {
+		dispatch.InstallationID = 42
+		dispatch.Owner = "my-org"
+		dispatch.Target = Target{Repo: "prod", EventType: "deploy"}
+		dispatch.ClientPayload = json.RawMessage(`{"ref":"refs/heads/main"}`)
+		dispatch.Freeze = "fridays"
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			for _, dispatch := range dispatches {
+				if err := store.Put(ctx, dispatch); err != nil {
+					t.Fatalf("Put() error = %v", err)
+				}
+			}
+			// A redelivery defers the same dispatch again
+			if err := store.Put(ctx, dispatches[0]); err != nil {
+				t.Fatalf("Put() error = %v", err)
+			}
+
+			due, err := store.Due(ctx, now)
+			if err != nil {
+				t.Fatalf("Due() error = %v", err)
+			}
+			if len(due) != 2 || due[0].ID != "delivery-1-0-0" || due[1].ID != "delivery-2-0-0" {
+				t.Fatalf("Due() = %+v, want delivery-1-0-0 and delivery-2-0-0", due)
+			}
+			var payload bytes.Buffer
+			json.Compact(&payload, due[0].ClientPayload)
+			if due[0].Target.Repo != "prod" || payload.String() != `{"ref":"refs/heads/main"}` || due[0].InstallationID != 42 {
+				t.Errorf("Due()[0] = %+v", due[0])
+			}
+
+			if err := store.Delete(ctx, "delivery-1-0-0"); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			due, err = store.Due(ctx, now.Add(2*time.Hour))
+			if err != nil {
+				t.Fatalf("Due() error = %v", err)
+			}
+			if len(due) != 2 || due[0].ID != "delivery-2-0-0" || due[1].ID != "delivery-1-0-1" {
+				t.Errorf("Due() after Delete() = %+v", due)
+			}
+		})
+	}
+}
+
+func TestHoldDispatch(t *testing.T) {
+	previous := deferredDispatchStore
+	store := newMemoryDeferredDispatchStore()
+	deferredDispatchStore = store
+	defer func() { deferredDispatchStore = previous }()
+
+	event := &PushEvent{
+		WebhookPayload: WebhookPayload{Repository: Repository{FullName: "my-org/app"}},
+		Ref:            "refs/heads/main",
+	}
+	release := time.Date(2025, 12, 20, 0, 0, 0, 0, time.UTC)
+
+	skip, _ := compileFreezeWindow(FreezeWindow{Name: "fridays", Cron: "* 12-23 * * FRI"})
+	status, reason := holdDispatch(context.Background(), skip, &DeferredDispatch{ID: "d-0-0", NotBefore: release}, event, nil)
+	if status != targetStatusSkipped || reason != "frozen by freeze window fridays until 2025-12-20T00:00:00Z" {
+		t.Errorf("skip holdDispatch() = %q, %q", status, reason)
+	}
+
+	deferred, _ := compileFreezeWindow(FreezeWindow{Name: "holidays", To: "2025-12-19", Mode: freezeModeDefer})
+	status, reason = holdDispatch(context.Background(), deferred, &DeferredDispatch{ID: "d-0-1", NotBefore: release}, event, map[string]interface{}{"paths": []string{"main.go"}})
+	if status != targetStatusDeferred || reason != "deferred by freeze window holidays until 2025-12-20T00:00:00Z" {
+		t.Errorf("defer holdDispatch() = %q, %q", status, reason)
+	}
+
+	due, _ := store.Due(context.Background(), release)
+	if len(due) != 1 || due[0].ID != "d-0-1" {
+		t.Fatalf("stored dispatches = %+v, want d-0-1", due)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(due[0].ClientPayload, &payload); err != nil {
+		t.Fatalf("invalid client_payload: %v", err)
+	}
+	if payload["ref"] != "refs/heads/main" || payload["source_repo"] != "my-org/app" || payload["paths"] == nil {
+		t.Errorf("client_payload = %v", payload)
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultMemoryQueueSize = 100
+)
+
+// QueuedDelivery is a verified webhook delivery waiting to be processed
+type QueuedDelivery struct {
+	DeliveryID string          `json:"delivery_id"`
+	Event      string          `json:"event"`
+	Repository string          `json:"repository"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// DeliveryQueue hands verified deliveries to the consumer that processes them.
+// Deliveries of the same source repository are consumed in the order they were enqueued.
+type DeliveryQueue interface {
+	Enqueue(ctx context.Context, delivery *QueuedDelivery) error
+}
+
+// newDeliveryQueue builds the queue selected by the DELIVERY_QUEUE env var
+func newDeliveryQueue(cfg aws.Config) (DeliveryQueue, error) {
+	switch queue := os.Getenv("DELIVERY_QUEUE"); queue {
+	case "", "memory":
+		// Lambda freezes the environment between invocations, deliveries
+		// acknowledged with a 202 would be lost with its in-process consumer
+		if os.Getenv("AWS_LAMBDA_RUNTIME_API") != "" {
+			return nil, fmt.Errorf("the memory queue cannot be used inside Lambda, set DELIVERY_QUEUE=sqs")
+		}
+		return newMemoryDeliveryQueue(defaultMemoryQueueSize), nil
+	case "sqs":
+		queueURL := os.Getenv("DELIVERY_QUEUE_URL")
+		if queueURL == "" {
+			return nil, fmt.Errorf("DELIVERY_QUEUE_URL is required for the sqs queue")
+		}
+		client := sqs.NewFromConfig(cfg, func(o *sqs.Options) {
+			if endpoint := os.Getenv("SQS_ENDPOINT"); endpoint != "" {
+				o.BaseEndpoint = aws.String(endpoint)
+			}
+		})
+		return newSQSDeliveryQueue(client, queueURL), nil
+	default:
+		return nil, fmt.Errorf("unknown delivery queue %q", queue)
+	}
+}
+
+// processQueuedDelivery runs the processing pipeline for a dequeued delivery
+func processQueuedDelivery(ctx context.Context, delivery *QueuedDelivery) error {
+	event, err := parseWebhookEvent(delivery.Event, delivery.Body)
+	if err != nil {
+		return fmt.Errorf("failed to parse queued delivery: %w", err)
+	}
+
+	logger.Info("processing queued delivery",
+		zap.String("deliveryId", delivery.DeliveryID),
+		zap.String("event", delivery.Event),
+		zap.String("repo", delivery.Repository),
+	)
+
+	report, err := processWebhook(ctx, delivery.DeliveryID, event)
+	if err != nil {
+		return err
+	}
+	if report.Status != reportStatusProcessed {
+		logger.Warn("queued delivery processed with failed dispatches",
+			zap.String("deliveryId", delivery.DeliveryID),
+			zap.Any("report", report),
+		)
+	}
+	return nil
+}
+
+// memoryDeliveryQueue is a channel backed queue for running locally. A single
+// consumer drains it, which keeps every repository's deliveries in order.
+type memoryDeliveryQueue struct {
+	mu         sync.RWMutex
+	closed     bool
+	deliveries chan *QueuedDelivery
+}
+
+func newMemoryDeliveryQueue(size int) *memoryDeliveryQueue {
+	return &memoryDeliveryQueue{deliveries: make(chan *QueuedDelivery, size)}
+}
+
+func (q *memoryDeliveryQueue) Enqueue(ctx context.Context, delivery *QueuedDelivery) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return fmt.Errorf("failed to enqueue delivery: queue closed")
+	}
+
+	select {
+	case q.deliveries <- delivery:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to enqueue delivery: %w", ctx.Err())
+	}
+}
+
+// Close stops accepting deliveries, the consumer returns once it drained the
+// ones already queued
+func (q *memoryDeliveryQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed {
+		q.closed = true
+		close(q.deliveries)
+	}
+}
+
+// Consume processes queued deliveries until the queue is closed and drained
+// or ctx is cancelled. Nothing retries
+// an in-memory delivery, so its claim is only completed once processed and is
+// released on failure to let GitHub's redelivery through.
+func (q *memoryDeliveryQueue) Consume(ctx context.Context, process func(context.Context, *QueuedDelivery) error) {
+	for {
+		select {
+		case delivery, ok := <-q.deliveries:
+			if !ok {
+				return
+			}
+			if err := process(ctx, delivery); err != nil {
+				logger.Error("failed to process queued delivery",
+					zap.Error(err),
+					zap.String("deliveryId", delivery.DeliveryID),
+				)
+				releaseDelivery(ctx, delivery.DeliveryID)
+				continue
+			}
+			completeDelivery(ctx, delivery.DeliveryID)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sqsAPI is the subset of the SQS client used by sqsDeliveryQueue
+type sqsAPI interface {
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+}
+
+// sqsDeliveryQueue sends deliveries to an SQS FIFO queue, grouped by source
+// repository so ordering is preserved per repository
+type sqsDeliveryQueue struct {
+	client   sqsAPI
+	queueURL string
+}
+
+func newSQSDeliveryQueue(client sqsAPI, queueURL string) *sqsDeliveryQueue {
+	return &sqsDeliveryQueue{client: client, queueURL: queueURL}
+}
+
+func (q *sqsDeliveryQueue) Enqueue(ctx context.Context, delivery *QueuedDelivery) error {
+	body, err := json.Marshal(delivery)
+	if err != nil {
+		return fmt.Errorf("failed to marshal delivery: %w", err)
+	}
+
+	// Events without a repository (e.g. installation events) share one group
+	groupID := delivery.Repository
+	if groupID == "" {
+		groupID = "no-repository"
+	}
+
+	input := &sqs.SendMessageInput{
+		QueueUrl:       aws.String(q.queueURL),
+		MessageBody:    aws.String(string(body)),
+		MessageGroupId: aws.String(groupID),
+	}
+	// Without a delivery ID the queue must have content based deduplication enabled
+	if delivery.DeliveryID != "" {
+		input.MessageDeduplicationId = aws.String(delivery.DeliveryID)
+	}
+
+	if _, err := q.client.SendMessage(ctx, input); err != nil {
+		return fmt.Errorf("failed to send delivery to queue: %w", err)
+	}
+	return nil
+}
+
+// sqsHandler is the Lambda entry point consuming the SQS FIFO delivery queue.
+// Once a message fails, it and every later message in the batch are reported
+// as failures so SQS retries them in their original order.
+func sqsHandler(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+	var response events.SQSEventResponse
+
+	for i, record := range event.Records {
+		var delivery QueuedDelivery
+		err := json.Unmarshal([]byte(record.Body), &delivery)
+		if err == nil {
+			err = processQueuedDelivery(ctx, &delivery)
+		}
+		if err == nil {
+			continue
+		}
+
+		logger.Error("failed to process queued delivery",
+			zap.Error(err),
+			zap.String("messageId", record.MessageId),
+			zap.String("deliveryId", delivery.DeliveryID),
+		)
+		for _, remaining := range event.Records[i:] {
+			response.BatchItemFailures = append(response.BatchItemFailures, events.SQSBatchItemFailure{
+				ItemIdentifier: remaining.MessageId,
+			})
+		}
+		break
+	}
+
+	return response, nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+func TestMemoryDeliveryQueueOrdering(t *testing.T) {
+	queue := newMemoryDeliveryQueue(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ids := []string{"1", "2", "3", "4"}
+	for _, id := range ids {
+		if err := queue.Enqueue(ctx, &QueuedDelivery{DeliveryID: id, Repository: "owner/repo"}); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+
+	processed := make(chan string, len(ids))
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		queue.Consume(ctx, func(ctx context.Context, delivery *QueuedDelivery) error {
+			processed <- delivery.DeliveryID
+			return nil
+		})
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	for _, want := range ids {
+		select {
+		case got := <-processed:
+			if got != want {
+				t.Errorf("processed %v, want %v", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for delivery %v", want)
+		}
+	}
+}
+
+func TestMemoryDeliveryQueueFull(t *testing.T) {
+	queue := newMemoryDeliveryQueue(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := queue.Enqueue(ctx, &QueuedDelivery{DeliveryID: "1"}); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if err := queue.Enqueue(ctx, &QueuedDelivery{DeliveryID: "2"}); err == nil {
+		t.Error("expected error when the queue is full and the context expires")
+	}
+}
+
+func TestMemoryDeliveryQueueCloseDrains(t *testing.T) {
+	queue := newMemoryDeliveryQueue(10)
+	ctx := context.Background()
+
+	for _, id := range []string{"1", "2", "3"} {
+		if err := queue.Enqueue(ctx, &QueuedDelivery{DeliveryID: id}); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+	queue.Close()
+	if err := queue.Enqueue(ctx, &QueuedDelivery{DeliveryID: "4"}); err == nil {
+		t.Error("expected error when enqueueing to a closed queue")
+	}
+
+	// Consume returns once the queued deliveries are processed
+	var processed []string
+	queue.Consume(ctx, func(ctx context.Context, delivery *QueuedDelivery) error {
+		processed = append(processed, delivery.DeliveryID)
+		return nil
+	})
+	if got := strings.Join(processed, ","); got != "1,2,3" {
+		t.Errorf("processed %v, want 1,2,3", got)
+	}
+}
+
+func TestNewDeliveryQueueRefusesMemoryInLambda(t *testing.T) {
+	t.Setenv("DELIVERY_QUEUE", "")
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", "127.0.0.1:9001")
+
+	if _, err := newDeliveryQueue(aws.Config{}); err == nil {
+		t.Error("expected error for the memory queue inside Lambda")
+	}
+}
+
+func TestMemoryDeliveryQueueSettlesClaims(t *testing.T) {
+	store := newMemoryIdempotencyStore(time.Minute, time.Hour)
+	previous := idempotencyStore
+	idempotencyStore = store
+	defer func() { idempotencyStore = previous }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, id := range []string{"ok", "failing"} {
+		if _, err := store.Claim(ctx, id); err != nil {
+			t.Fatalf("Claim() error = %v", err)
+		}
+	}
+
+	queue := newMemoryDeliveryQueue(10)
+	seen := make(chan string)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		queue.Consume(ctx, func(ctx context.Context, delivery *QueuedDelivery) error {
+			seen <- delivery.DeliveryID
+			if delivery.DeliveryID == "failing" {
+				return errors.New("processing failed")
+			}
+			return nil
+		})
+	}()
+	// Deliveries are consumed one at a time, the earlier claims are settled once "last" is seen
+	ids := []string{"ok", "failing", "last"}
+	for _, id := range ids {
+		if err := queue.Enqueue(ctx, &QueuedDelivery{DeliveryID: id}); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+	for range ids {
+		select {
+		case <-seen:
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for the consumer")
+		}
+	}
+	cancel()
+	<-stopped
+
+	// Past the lease only completed claims still hold
+	later := time.Now().Add(2 * time.Minute)
+	store.mu.Lock()
+	store.now = func() time.Time { return later }
+	store.mu.Unlock()
+	if claimed, _ := store.Claim(context.Background(), "ok"); claimed {
+		t.Error("processed delivery was not completed")
+	}
+	if claimed, _ := store.Claim(context.Background(), "failing"); !claimed {
+		t.Error("failed delivery was not released")
+	}
+}
+
+type fakeSQS struct {
+	inputs []*sqs.SendMessageInput
+}
+
+func (f *fakeSQS) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	f.inputs = append(f.inputs, params)
+	return &sqs.SendMessageOutput{}, nil
+}
+
+func TestSQSDeliveryQueueEnqueue(t *testing.T) {
+	client := &fakeSQS{}
+	queue := newSQSDeliveryQueue(client, "https://sqs.example/queue.fifo")
+
+	delivery := &QueuedDelivery{
+		DeliveryID: "abc-123",
+		Event:      "release",
+		Repository: "owner/repo",
+		Body:       json.RawMessage(`{"action":"published"}`),
+	}
+	if err := queue.Enqueue(context.Background(), delivery); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if err := queue.Enqueue(context.Background(), &QueuedDelivery{Event: "ping", Body: json.RawMessage(`{}`)}); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	input := client.inputs[0]
+	if *input.MessageGroupId != "owner/repo" {
+		t.Errorf("MessageGroupId = %v, want owner/repo", *input.MessageGroupId)
+	}
+	if *input.MessageDeduplicationId != "abc-123" {
+		t.Errorf("MessageDeduplicationId = %v, want abc-123", *input.MessageDeduplicationId)
+	}
+
+	var roundTrip QueuedDelivery
+	if err := json.Unmarshal([]byte(*input.MessageBody), &roundTrip); err != nil {
+		t.Fatalf("failed to unmarshal message body: %v", err)
+	}
+	if roundTrip.Event != "release" || string(roundTrip.Body) != `{"action":"published"}` {
+		t.Errorf("unexpected message body %s", *input.MessageBody)
+	}
+
+	if *client.inputs[1].MessageGroupId != "no-repository" {
+		t.Errorf("MessageGroupId = %v, want no-repository", *client.inputs[1].MessageGroupId)
+	}
+	if client.inputs[1].MessageDeduplicationId != nil {
+		t.Error("expected no deduplication ID without a delivery ID")
+	}
+}
+
+func TestSQSHandlerReportsFailuresInOrder(t *testing.T) {
+	event := events.SQSEvent{
+		Records: []events.SQSMessage{
+			{MessageId: "m1", Body: `{invalid`},
+			{MessageId: "m2", Body: `{"delivery_id":"2","event":"release","body":{}}`},
+			{MessageId: "m3", Body: `{"delivery_id":"3","event":"release","body":{}}`},
+		},
+	}
+
+	response, err := sqsHandler(context.Background(), event)
+	if err != nil {
+		t.Fatalf("sqsHandler() error = %v", err)
+	}
+
+	if len(response.BatchItemFailures) != 3 {
+		t.Fatalf("expected 3 failures, got %d", len(response.BatchItemFailures))
+	}
+	for i, want := range []string{"m1", "m2", "m3"} {
+		if got := response.BatchItemFailures[i].ItemIdentifier; got != want {
+			t.Errorf("failure %d = %v, want %v", i, got, want)
+		}
+	}
+}
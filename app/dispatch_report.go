@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+
+	"go.uber.org/zap"
+)
+
+const (
+	targetStatusSent    = "sent"
+	targetStatusFailed  = "failed"
+	targetStatusSkipped = "skipped"
+	// targetStatusDeferred is a dispatch held back by a freeze window, sent once it closes
+	targetStatusDeferred = "deferred"
+
+	reportStatusProcessed = "processed"
+	reportStatusPartial   = "partial"
+	reportStatusFailed    = "failed"
+	reportStatusQueued    = "queued"
+	reportStatusDuplicate = "duplicate"
+)
+
+// DispatchReport describes what was done with a webhook delivery. It is
+// returned as the webhook response, so it shows up in GitHub's Recent
+// Deliveries view of the App.
+type DispatchReport struct {
+	DeliveryID   string         `json:"delivery_id,omitempty"`
+	Event        string         `json:"event"`
+	Action       string         `json:"action,omitempty"`
+	Repository   string         `json:"repository,omitempty"`
+	Status       string         `json:"status"`
+	Error        string         `json:"error,omitempty"`
+	MatchedRules []RuleReport   `json:"matched_rules"`
+	Targets      []TargetReport `json:"targets"`
+}
+
+// RuleReport identifies a dispatch rule of the repository config that matched
+type RuleReport struct {
+	Index int    `json:"index"`
+	Event string `json:"event"`
+}
+
+// TargetReport is the outcome of one repository dispatch
+type TargetReport struct {
+	Rule      int    `json:"rule"`
+	Repo      string `json:"repo"`
+	EventType string `json:"event_type"`
+	Status    string `json:"status"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+func newDispatchReport(deliveryID string, event Event) *DispatchReport {
+	payload := event.Envelope()
+	return &DispatchReport{
+		DeliveryID:   deliveryID,
+		Event:        event.Name(),
+		Action:       payload.Action,
+		Repository:   payload.Repository.FullName,
+		MatchedRules: []RuleReport{},
+		Targets:      []TargetReport{},
+	}
+}
+
+// addTarget records the outcome of a dispatch to target
+func (r *DispatchReport) addTarget(ruleIndex int, target Target, status, reason string) {
+	r.Targets = append(r.Targets, TargetReport{
+		Rule:      ruleIndex,
+		Repo:      target.Repo,
+		EventType: target.EventType,
+		Status:    status,
+		Reason:    reason,
+	})
+}
+
+// hasMatchedRule reports whether the rule is already listed as matched
+func (r *DispatchReport) hasMatchedRule(index int) bool {
+	for _, rule := range r.MatchedRules {
+		if rule.Index == index {
+			return true
+		}
+	}
+	return false
+}
+
+// finish derives the overall status from the target outcomes
+func (r *DispatchReport) finish() {
+	failed := r.countTargets(targetStatusFailed)
+
+	switch {
+	case failed == 0:
+		r.Status = reportStatusProcessed
+	case failed == len(r.Targets):
+		r.Status = reportStatusFailed
+	default:
+		r.Status = reportStatusPartial
+	}
+}
+
+// fail marks the delivery as not processed and returns the report with err
+func (r *DispatchReport) fail(err error) (*DispatchReport, error) {
+	r.Status = reportStatusFailed
+	r.Error = err.Error()
+	return r, err
+}
+
+// countTargets returns how many targets ended with status
+func (r *DispatchReport) countTargets(status string) int {
+	count := 0
+	for _, target := range r.Targets {
+		if target.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// jsonResponse renders v as a JSON webhook response
+func jsonResponse(statusCode int, v interface{}) WebhookResponse {
+	body, err := json.Marshal(v)
+	if err != nil {
+		logger.Error("failed to marshal response", zap.Error(err))
+		return WebhookResponse{
+			StatusCode: 500,
+			Body:       "Error: failed to marshal response",
+		}
+	}
+	return WebhookResponse{
+		StatusCode:  statusCode,
+		Body:        string(body),
+		ContentType: "application/json",
+	}
+}
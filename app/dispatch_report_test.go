@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestDispatchReportFinish(t *testing.T) {
+	target := Target{Repo: "target-repo", EventType: "deploy"}
+
+	tests := []struct {
+		name     string
+		statuses []string
+		want     string
+	}{
+		{name: "no targets", statuses: nil, want: reportStatusProcessed},
+		{name: "all sent", statuses: []string{targetStatusSent, targetStatusSent}, want: reportStatusProcessed},
+		{name: "sent and skipped", statuses: []string{targetStatusSent, targetStatusSkipped}, want: reportStatusProcessed},
+		{name: "some failed", statuses: []string{targetStatusSent, targetStatusFailed}, want: reportStatusPartial},
+		{name: "all failed", statuses: []string{targetStatusFailed, targetStatusFailed}, want: reportStatusFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := newDispatchReport("delivery-1", &ReleaseEvent{})
+			for _, status := range tt.statuses {
+				report.addTarget(0, target, status, "")
+			}
+			report.finish()
+
+			if report.Status != tt.want {
+				t.Errorf("Status = %v, want %v", report.Status, tt.want)
+			}
+		})
+	}
+}
+
+func TestDispatchReportJSON(t *testing.T) {
+	event := &ReleaseEvent{WebhookPayload: WebhookPayload{
+		Action:     "published",
+		Repository: Repository{FullName: "owner/source"},
+	}}
+	report := newDispatchReport("delivery-1", event)
+	report.MatchedRules = append(report.MatchedRules, RuleReport{Index: 0, Event: "release"})
+	report.addTarget(0, Target{Repo: "ok-repo", EventType: "deploy"}, targetStatusSent, "")
+	report.addTarget(0, Target{Repo: "bad-repo", EventType: "deploy"}, targetStatusFailed, "failed to dispatch: 404")
+	report.finish()
+
+	response := jsonResponse(200, report)
+	if response.ContentType != "application/json" {
+		t.Errorf("ContentType = %v, want application/json", response.ContentType)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(response.Body), &decoded); err != nil {
+		t.Fatalf("response is not JSON: %v", err)
+	}
+	if decoded["delivery_id"] != "delivery-1" || decoded["event"] != "release" || decoded["status"] != reportStatusPartial {
+		t.Errorf("unexpected report %s", response.Body)
+	}
+
+	targets := decoded["targets"].([]interface{})
+	failed := targets[1].(map[string]interface{})
+	if failed["status"] != targetStatusFailed || failed["reason"] != "failed to dispatch: 404" {
+		t.Errorf("unexpected failed target %v", failed)
+	}
+}
+
+func TestProcessWebhookReportsSetupFailure(t *testing.T) {
+	originalKey := githubAppPrivateKeyPem
+	githubAppPrivateKeyPem = ""
+	defer func() { githubAppPrivateKeyPem = originalKey }()
+
+	report, err := processWebhook(context.Background(), "delivery-1", &ReleaseEvent{})
+	if err == nil {
+		t.Fatal("expected error without a private key")
+	}
+	if report == nil || report.Status != reportStatusFailed || report.Error == "" {
+		t.Errorf("expected failed report with error, got %+v", report)
+	}
+	if report.DeliveryID != "delivery-1" {
+		t.Errorf("DeliveryID = %v, want delivery-1", report.DeliveryID)
+	}
+}
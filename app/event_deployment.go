@@ -0,0 +1,109 @@
+package main
+
+import "slices"
+
+// DeploymentEvent is the payload of the deployment webhook event
+type DeploymentEvent struct {
+	WebhookPayload
+	Deployment *Deployment `json:"deployment"`
+}
+
+// DeploymentStatusEvent is the payload of the deployment_status webhook event
+type DeploymentStatusEvent struct {
+	WebhookPayload
+	DeploymentStatus *DeploymentStatus `json:"deployment_status"`
+	Deployment       *Deployment       `json:"deployment"`
+}
+
+type Deployment struct {
+	ID          int64  `json:"id"`
+	SHA         string `json:"sha"`
+	Ref         string `json:"ref"`
+	Task        string `json:"task"`
+	Environment string `json:"environment"`
+	Description string `json:"description"`
+	URL         string `json:"url"`
+	Creator     User   `json:"creator"`
+}
+
+type DeploymentStatus struct {
+	ID int64 `json:"id"`
+	// State is pending, queued, in_progress, success, failure, error or inactive
+	State          string `json:"state"`
+	Environment    string `json:"environment"`
+	EnvironmentURL string `json:"environment_url"`
+	LogURL         string `json:"log_url"`
+	TargetURL      string `json:"target_url"`
+	Description    string `json:"description"`
+}
+
+func (e *DeploymentEvent) Name() string { return "deployment" }
+
+func (e *DeploymentStatusEvent) Name() string { return "deployment_status" }
+
+// MatchesFilters applies the rule's environment filter
+func (e *DeploymentEvent) MatchesFilters(rule Rule) bool {
+	if e.Deployment == nil {
+		return false
+	}
+	return len(rule.Environments) == 0 || matchGlobs(e.Deployment.Environment, rule.Environments)
+}
+
+// MatchesFilters applies the rule's environment and state filters
+func (e *DeploymentStatusEvent) MatchesFilters(rule Rule) bool {
+	if e.DeploymentStatus == nil || e.Deployment == nil {
+		return false
+	}
+	if len(rule.Environments) > 0 && !matchGlobs(e.environment(), rule.Environments) {
+		return false
+	}
+	return len(rule.States) == 0 || slices.Contains(rule.States, e.DeploymentStatus.State)
+}
+
+// environment returns the environment of the status, which GitHub sets to the
+// deployment's environment unless the status moved it
+func (e *DeploymentStatusEvent) environment() string {
+	if e.DeploymentStatus.Environment != "" {
+		return e.DeploymentStatus.Environment
+	}
+	return e.Deployment.Environment
+}
+
+func (e *DeploymentEvent) ClientPayload() map[string]interface{} {
+	return map[string]interface{}{"deployment": e.Deployment.payload()}
+}
+
+func (e *DeploymentStatusEvent) ClientPayload() map[string]interface{} {
+	payload := map[string]interface{}{"deployment": e.Deployment.payload()}
+	if status := e.DeploymentStatus; status != nil {
+		// target_url is the deprecated name of log_url, still the only one set by older integrations
+		logURL := status.LogURL
+		if logURL == "" {
+			logURL = status.TargetURL
+		}
+		payload["deployment_status"] = map[string]interface{}{
+			"id":              status.ID,
+			"state":           status.State,
+			"environment":     e.environment(),
+			"environment_url": status.EnvironmentURL,
+			"log_url":         logURL,
+			"description":     status.Description,
+		}
+	}
+	return payload
+}
+
+func (d *Deployment) payload() map[string]interface{} {
+	if d == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"id":          d.ID,
+		"environment": d.Environment,
+		"sha":         d.SHA,
+		"ref":         d.Ref,
+		"task":        d.Task,
+		"url":         d.URL,
+		"creator":     d.Creator.Login,
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// GenericEvent is an event without a registered handler. Rules match it on
+// its name and action only, targets forward its body with forward and forward-raw.
+type GenericEvent struct {
+	WebhookPayload
+	name string
+}
+
+func (e *GenericEvent) Name() string { return e.name }
+
+func (e *GenericEvent) ClientPayload() map[string]interface{} {
+	if e.Action == "" {
+		return nil
+	}
+	return map[string]interface{}{"action": e.Action}
+}
+
+// parseGenericEvent parses an event without a registered handler. Events that
+// do not belong to a repository are unsupported, there is no config to route them.
+func parseGenericEvent(eventName string, body []byte) (Event, error) {
+	if eventName == "" {
+		return nil, fmt.Errorf("%w: %q", errUnsupportedEvent, eventName)
+	}
+
+	event := &GenericEvent{name: eventName}
+	if err := json.Unmarshal(body, event); err != nil {
+		return nil, fmt.Errorf("failed to parse %s payload: %w", eventName, err)
+	}
+	if event.Repository.FullName == "" {
+		return nil, fmt.Errorf("%w: %q has no repository", errUnsupportedEvent, eventName)
+	}
+	event.raw = body
+	return event, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Event is a typed GitHub webhook event parsed by its registered handler
+type Event interface {
+	// Name returns the GitHub event name as sent in the X-GitHub-Event header
+	Name() string
+	// Envelope returns the fields shared by every webhook payload
+	Envelope() *WebhookPayload
+	// ClientPayload returns the event specific fields forwarded to dispatch targets
+	ClientPayload() map[string]interface{}
+}
+
+// ruleFilter is implemented by events supporting rule level filters on top of
+// the event name
+type ruleFilter interface {
+	MatchesFilters(rule Rule) bool
+}
+
+// EventHandler parses the raw webhook body of a single event type
+type EventHandler func(body []byte) (Event, error)
+
+var (
+	// eventHandlers maps X-GitHub-Event names to the handler parsing their payload.
+	// Supporting a new event only requires registering its handler here.
+	eventHandlers = map[string]EventHandler{
+		"release":      parseEvent[ReleaseEvent],
+		"push":         parseEvent[PushEvent],
+		"pull_request": parseEvent[PullRequestEvent],
+		"workflow_run": parseEvent[WorkflowRunEvent],
+		"create":       parseEvent[CreateEvent],
+		"delete":       parseEvent[DeleteEvent],
+
+		// Deployments created through the API or by Actions jobs with an environment
+		"deployment":        parseEvent[DeploymentEvent],
+		"deployment_status": parseEvent[DeploymentStatusEvent],
+
+		// GitHub Packages, both events are sent for container and npm packages
+		"package":          parseEvent[PackageEvent],
+		"registry_package": parseEvent[RegistryPackageEvent],
+
+		// Slash commands in comments
+		"issue_comment": parseEvent[IssueCommentEvent],
+
+		// Lifecycle events handled by the App itself
+		"ping":                      parseEvent[PingEvent],
+		"installation":              parseEvent[InstallationEvent],
+		"installation_repositories": parseEvent[InstallationRepositoriesEvent],
+	}
+
+	errUnsupportedEvent = errors.New("unsupported event type")
+)
+
+// parseWebhookEvent routes the body to the handler registered for eventName
+func parseWebhookEvent(eventName string, body []byte) (Event, error) {
+	handler, ok := eventHandlers[eventName]
+	if !ok {
+		return parseGenericEvent(eventName, body)
+	}
+
+	event, err := handler(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s payload: %w", eventName, err)
+	}
+	return event, nil
+}
+
+// parseEvent is the default handler that unmarshals the body into the event struct T
+func parseEvent[T any, PT interface {
+	*T
+	Event
+}](body []byte) (Event, error) {
+	event := PT(new(T))
+	if err := json.Unmarshal(body, event); err != nil {
+		return nil, err
+	}
+	event.Envelope().raw = body
+	return event, nil
+}
@@ -0,0 +1,647 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseWebhookEvent(t *testing.T) {
+	tests := []struct {
+		name      string
+		eventName string
+		body      string
+		wantErr   bool
+		verify    func(*testing.T, Event)
+	}{
+		{
+			name:      "release event",
+			eventName: "release",
+			body: `{
+				"action": "published",
+				"repository": {"name": "test-repo", "full_name": "owner/test-repo", "owner": {"login": "owner"}},
+				"sender": {"login": "user"},
+				"installation": {"id": 999},
+				"release": {"id": 111, "tag_name": "v1.0.0", "name": "Release 1.0.0"}
+			}`,
+			verify: func(t *testing.T, e Event) {
+				release, ok := e.(*ReleaseEvent)
+				if !ok {
+					t.Fatalf("expected *ReleaseEvent, got %T", e)
+				}
+				if release.Release == nil || release.Release.TagName != "v1.0.0" {
+					t.Errorf("Release.TagName = %v, want v1.0.0", release.Release)
+				}
+				if e.Envelope().Installation.ID != 999 {
+					t.Errorf("Installation.ID = %d, want 999", e.Envelope().Installation.ID)
+				}
+			},
+		},
+		{
+			name:      "push event",
+			eventName: "push",
+			body:      `{"ref": "refs/heads/main", "repository": {"full_name": "owner/test-repo"}}`,
+			verify: func(t *testing.T, e Event) {
+				push, ok := e.(*PushEvent)
+				if !ok {
+					t.Fatalf("expected *PushEvent, got %T", e)
+				}
+				if push.Ref != "refs/heads/main" {
+					t.Errorf("Ref = %v, want refs/heads/main", push.Ref)
+				}
+			},
+		},
+		{
+			name:      "issue_comment event",
+			eventName: "issue_comment",
+			body:      `{"action": "created", "issue": {"number": 7, "pull_request": {"url": "https://api.github.com/repos/owner/test-repo/pulls/7"}}, "comment": {"id": 42, "body": "/dispatch deploy prod"}}`,
+			verify: func(t *testing.T, e Event) {
+				comment, ok := e.(*IssueCommentEvent)
+				if !ok {
+					t.Fatalf("expected *IssueCommentEvent, got %T", e)
+				}
+				if comment.Issue.PullRequest == nil || comment.Comment.ID != 42 || len(comment.DispatchCommands()) != 1 {
+					t.Errorf("IssueCommentEvent = %+v", comment)
+				}
+			},
+		},
+		{
+			name:      "delete event",
+			eventName: "delete",
+			body:      `{"ref": "feature/login", "ref_type": "branch", "pusher_type": "user", "repository": {"full_name": "owner/test-repo"}}`,
+			verify: func(t *testing.T, e Event) {
+				deleted, ok := e.(*DeleteEvent)
+				if !ok {
+					t.Fatalf("expected *DeleteEvent, got %T", e)
+				}
+				if deleted.FullRef() != "refs/heads/feature/login" || e.Envelope().Repository.FullName != "owner/test-repo" {
+					t.Errorf("DeleteEvent = %+v", deleted)
+				}
+			},
+		},
+		{
+			name:      "registry_package event",
+			eventName: "registry_package",
+			body:      `{"action": "published", "registry_package": {"name": "api", "package_type": "CONTAINER", "package_version": {"version": "sha256:4a1b2c", "container_metadata": {"tag": {"name": "latest", "digest": "sha256:4a1b2c"}}}}}`,
+			verify: func(t *testing.T, e Event) {
+				pkg, ok := e.(*RegistryPackageEvent)
+				if !ok {
+					t.Fatalf("expected *RegistryPackageEvent, got %T", e)
+				}
+				if pkg.RegistryPackage == nil || pkg.RegistryPackage.Tag() != "latest" || pkg.RegistryPackage.Digest() != "sha256:4a1b2c" {
+					t.Errorf("RegistryPackage = %+v", pkg.RegistryPackage)
+				}
+			},
+		},
+		{
+			name:      "deployment_status event",
+			eventName: "deployment_status",
+			body:      `{"action": "created", "deployment_status": {"id": 7, "state": "success", "log_url": "https://example.com/logs/7"}, "deployment": {"id": 3, "sha": "abc123", "environment": "staging"}}`,
+			verify: func(t *testing.T, e Event) {
+				status, ok := e.(*DeploymentStatusEvent)
+				if !ok {
+					t.Fatalf("expected *DeploymentStatusEvent, got %T", e)
+				}
+				if status.DeploymentStatus.State != "success" || status.environment() != "staging" || status.Deployment.SHA != "abc123" {
+					t.Errorf("DeploymentStatusEvent = %+v", status)
+				}
+			},
+		},
+		{
+			name:      "unmodeled event",
+			eventName: "code_scanning_alert",
+			body:      `{"action": "created", "alert": {"number": 3}, "repository": {"full_name": "owner/test-repo"}}`,
+			verify: func(t *testing.T, e Event) {
+				generic, ok := e.(*GenericEvent)
+				if !ok {
+					t.Fatalf("expected *GenericEvent, got %T", e)
+				}
+				if generic.Action != "created" || len(generic.raw) == 0 || e.ClientPayload()["action"] != "created" {
+					t.Errorf("GenericEvent = %+v", generic)
+				}
+			},
+		},
+		{
+			name:      "pull_request event",
+			eventName: "pull_request",
+			body:      `{"action": "opened", "number": 42, "pull_request": {"number": 42, "title": "Add feature"}}`,
+			verify: func(t *testing.T, e Event) {
+				pr, ok := e.(*PullRequestEvent)
+				if !ok {
+					t.Fatalf("expected *PullRequestEvent, got %T", e)
+				}
+				if pr.Number != 42 || pr.Action != "opened" {
+					t.Errorf("got number %d action %q, want 42 opened", pr.Number, pr.Action)
+				}
+			},
+		},
+		{
+			name:      "workflow_run event",
+			eventName: "workflow_run",
+			body:      `{"action": "completed", "workflow_run": {"id": 7, "name": "build", "conclusion": "success"}}`,
+			verify: func(t *testing.T, e Event) {
+				run, ok := e.(*WorkflowRunEvent)
+				if !ok {
+					t.Fatalf("expected *WorkflowRunEvent, got %T", e)
+				}
+				if run.WorkflowRun.Conclusion != "success" {
+					t.Errorf("Conclusion = %v, want success", run.WorkflowRun.Conclusion)
+				}
+			},
+		},
+		{
+			name:      "release payload sent with another event header is not sniffed",
+			eventName: "push",
+			body:      `{"release": {"tag_name": "v1.0.0"}}`,
+			verify: func(t *testing.T, e Event) {
+				if e.Name() != "push" {
+					t.Errorf("Name() = %v, want push", e.Name())
+				}
+			},
+		},
+		{
+			name:      "invalid json",
+			eventName: "release",
+			body:      `{invalid json}`,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := parseWebhookEvent(tt.eventName, []byte(tt.body))
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseWebhookEvent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr {
+				if event.Name() != tt.eventName {
+					t.Errorf("Name() = %v, want %v", event.Name(), tt.eventName)
+				}
+				if tt.verify != nil {
+					tt.verify(t, event)
+				}
+			}
+		})
+	}
+}
+
+func TestUnsupportedEvents(t *testing.T) {
+	unsupported := []string{"", "issues", "fork", "star"}
+	for _, eventName := range unsupported {
+		_, err := parseWebhookEvent(eventName, []byte(`{}`))
+		if !errors.Is(err, errUnsupportedEvent) {
+			t.Errorf("event %q: error = %v, want errUnsupportedEvent", eventName, err)
+		}
+	}
+}
+
+func TestReleaseClientPayload(t *testing.T) {
+	event := &ReleaseEvent{Release: &Release{TagName: "v1.2.3", Name: "Version 1.2.3"}}
+
+	release, ok := event.ClientPayload()["release"].(map[string]interface{})
+	if !ok {
+		t.Fatal("expected release key in client payload")
+	}
+	if release["tag_name"] != "v1.2.3" {
+		t.Errorf("tag_name = %v, want v1.2.3", release["tag_name"])
+	}
+
+	if _, ok := release["published_at"]; ok {
+		t.Error("expected no published_at for an unpublished release")
+	}
+
+	publishedAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	event.Release.Prerelease = true
+	event.Release.TargetCommitish = "main"
+	event.Release.HTMLURL = "https://github.com/owner/repo/releases/tag/v1.2.3"
+	event.Release.PublishedAt = &publishedAt
+	release = event.ClientPayload()["release"].(map[string]interface{})
+	if release["prerelease"] != true || release["target_commitish"] != "main" || release["html_url"] != event.Release.HTMLURL {
+		t.Errorf("unexpected release payload: %v", release)
+	}
+	if release["published_at"] != "2025-03-01T12:00:00Z" {
+		t.Errorf("published_at = %v, want 2025-03-01T12:00:00Z", release["published_at"])
+	}
+
+	if payload := (&ReleaseEvent{}).ClientPayload(); payload != nil {
+		t.Errorf("expected nil client payload without release, got %v", payload)
+	}
+}
+
+func TestPushClientPayload(t *testing.T) {
+	event := &PushEvent{
+		Ref:        "refs/heads/main",
+		Before:     "aaa",
+		After:      "bbb",
+		HeadCommit: &Commit{ID: "bbb", Message: "Fix build", Author: CommitAuthor{Username: "octocat"}},
+		Pusher:     CommitAuthor{Name: "octocat", Email: "octocat@example.com"},
+	}
+
+	payload := event.ClientPayload()
+	if payload["ref"] != "refs/heads/main" || payload["before"] != "aaa" || payload["after"] != "bbb" {
+		t.Errorf("unexpected ref fields: %v", payload)
+	}
+	headCommit, ok := payload["head_commit"].(map[string]interface{})
+	if !ok || headCommit["id"] != "bbb" || headCommit["message"] != "Fix build" {
+		t.Errorf("head_commit = %v", payload["head_commit"])
+	}
+	if pusher := payload["pusher"].(map[string]interface{}); pusher["name"] != "octocat" {
+		t.Errorf("pusher = %v", pusher)
+	}
+
+	deleted := (&PushEvent{Ref: "refs/heads/old", Deleted: true}).ClientPayload()
+	if _, ok := deleted["head_commit"]; ok {
+		t.Error("expected no head_commit for a deleted ref")
+	}
+}
+
+func TestPushChangesAppConfig(t *testing.T) {
+	push := func(ref string, commits ...Commit) *PushEvent {
+		return &PushEvent{
+			WebhookPayload: WebhookPayload{Repository: Repository{DefaultBranch: "main"}},
+			Ref:            ref,
+			Commits:        commits,
+		}
+	}
+	config := Commit{Modified: []string{"README.md", configFilePath}}
+	other := Commit{Added: []string{".github/workflows/ci.yml"}}
+
+	tests := []struct {
+		name  string
+		event *PushEvent
+		want  bool
+	}{
+		{"config modified", push("refs/heads/main", other, config), true},
+		{"config removed", push("refs/heads/main", Commit{Removed: []string{configFilePath}}), true},
+		{"other files", push("refs/heads/main", other), false},
+		{"other branch", push("refs/heads/feature", config), false},
+		{"tag", push("refs/tags/v1.0.0", config), false},
+		{"too many commits to tell", push("refs/heads/main", slices.Repeat([]Commit{other}, maxPushPayloadCommits)...), true},
+		{"forced", &PushEvent{WebhookPayload: WebhookPayload{Repository: Repository{DefaultBranch: "main"}}, Ref: "refs/heads/main", Forced: true}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.event.changesAppConfig(); got != tt.want {
+				t.Errorf("changesAppConfig() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleApplies(t *testing.T) {
+	push := &PushEvent{Ref: "refs/tags/v1.0.0"}
+
+	if !ruleApplies(Rule{Event: "push", Tags: []string{"v*"}}, push) {
+		t.Error("expected tag rule to apply")
+	}
+	if ruleApplies(Rule{Event: "push", Branches: []string{"main"}}, push) {
+		t.Error("expected branch rule not to apply to a tag push")
+	}
+	if ruleApplies(Rule{Event: "release", Tags: []string{"v*"}}, push) {
+		t.Error("expected rule for another event not to apply")
+	}
+
+	alert := &GenericEvent{WebhookPayload: WebhookPayload{Action: "created"}, name: "code_scanning_alert"}
+	if !ruleApplies(Rule{Event: "code_scanning_alert", Types: []string{"created", "reopened"}}, alert) {
+		t.Error("expected action rule to apply")
+	}
+	if ruleApplies(Rule{Event: "code_scanning_alert", Types: []string{"fixed"}}, alert) {
+		t.Error("expected rule for another action not to apply")
+	}
+}
+
+func TestPullRequestMatchesFilters(t *testing.T) {
+	yes, no := true, false
+	event := &PullRequestEvent{
+		WebhookPayload: WebhookPayload{Action: "closed"},
+		Number:         7,
+		PullRequest: PullRequest{
+			Merged: true,
+			Head:   GitRef{Ref: "feature/login", SHA: "abc123"},
+			Base:   GitRef{Ref: "main"},
+			Labels: []Label{{Name: "Deploy"}},
+		},
+	}
+
+	tests := []struct {
+		name string
+		rule Rule
+		want bool
+	}{
+		{"no filters", Rule{Event: "pull_request"}, true},
+		{"types match", Rule{Event: "pull_request", Types: []string{"opened", "closed"}}, true},
+		{"types miss", Rule{Event: "pull_request", Types: []string{"opened", "synchronize"}}, false},
+		{"base branch match", Rule{Event: "pull_request", Branches: []string{"main"}}, true},
+		{"base branch miss", Rule{Event: "pull_request", Branches: []string{"release/*"}}, false},
+		{"base branch ignored", Rule{Event: "pull_request", BranchesIgnore: []string{"main"}}, false},
+		{"head branch match", Rule{Event: "pull_request", HeadBranches: []string{"feature/**"}}, true},
+		{"head branch ignored", Rule{Event: "pull_request", HeadBranchesIgnore: []string{"feature/*"}}, false},
+		{"merged", Rule{Event: "pull_request", Merged: &yes}, true},
+		{"not merged", Rule{Event: "pull_request", Merged: &no}, false},
+		{"draft only", Rule{Event: "pull_request", Draft: &yes}, false},
+		{"ready only", Rule{Event: "pull_request", Draft: &no}, true},
+		{"label match ignores case", Rule{Event: "pull_request", Labels: []string{"deploy"}}, true},
+		{"label miss", Rule{Event: "pull_request", Labels: []string{"preview"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ruleApplies(tt.rule, event); got != tt.want {
+				t.Errorf("ruleApplies() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	pr := event.ClientPayload()["pull_request"].(map[string]interface{})
+	if pr["number"] != 7 || pr["head_sha"] != "abc123" || pr["base_ref"] != "main" || pr["merged"] != true {
+		t.Errorf("unexpected pull_request payload: %v", pr)
+	}
+}
+
+func TestWorkflowRunMatchesFilters(t *testing.T) {
+	event := &WorkflowRunEvent{
+		WebhookPayload: WebhookPayload{Action: "completed"},
+		WorkflowRun: WorkflowRun{
+			ID:         30433642,
+			Name:       "build",
+			Path:       ".github/workflows/build.yml",
+			Conclusion: "success",
+			HeadBranch: "main",
+			HeadSHA:    "acb5820ced9479c074f688cc328bf03f341a511d",
+			HTMLURL:    "https://github.com/owner/repo/actions/runs/30433642",
+		},
+	}
+
+	tests := []struct {
+		name string
+		rule Rule
+		want bool
+	}{
+		{"no filters", Rule{Event: "workflow_run"}, true},
+		{"workflow name", Rule{Event: "workflow_run", Workflows: []string{"build"}}, true},
+		{"workflow path", Rule{Event: "workflow_run", Workflows: []string{".github/workflows/build.yml"}}, true},
+		{"workflow miss", Rule{Event: "workflow_run", Workflows: []string{"deploy"}}, false},
+		{"conclusion match", Rule{Event: "workflow_run", Conclusions: []string{"success"}}, true},
+		{"conclusion miss", Rule{Event: "workflow_run", Conclusions: []string{"failure"}}, false},
+		{"branch match", Rule{Event: "workflow_run", Branches: []string{"main"}}, true},
+		{"branch ignored", Rule{Event: "workflow_run", BranchesIgnore: []string{"main"}}, false},
+		{"requested action", Rule{Event: "workflow_run", Types: []string{"requested"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ruleApplies(tt.rule, event); got != tt.want {
+				t.Errorf("ruleApplies() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	run := event.ClientPayload()["workflow_run"].(map[string]interface{})
+	if run["id"] != int64(30433642) || run["url"] != event.WorkflowRun.HTMLURL || run["head_sha"] != event.WorkflowRun.HeadSHA || run["conclusion"] != "success" {
+		t.Errorf("unexpected workflow_run payload: %v", run)
+	}
+
+	inProgress := &WorkflowRunEvent{WebhookPayload: WebhookPayload{Action: "in_progress"}, WorkflowRun: event.WorkflowRun}
+	if ruleApplies(Rule{Event: "workflow_run"}, inProgress) {
+		t.Error("rule without types applies to an in_progress run")
+	}
+	if !ruleApplies(Rule{Event: "workflow_run", Types: []string{"in_progress"}}, inProgress) {
+		t.Error("rule with types [in_progress] does not apply to an in_progress run")
+	}
+}
+
+func TestReleaseMatchesFilters(t *testing.T) {
+	yes, no := true, false
+	published := &Release{TagName: "v1.0.0"}
+	prerelease := &Release{TagName: "v1.1.0-rc.1", Prerelease: true}
+	draft := &Release{TagName: "v2.0.0", Draft: true}
+
+	tests := []struct {
+		name    string
+		rule    Rule
+		action  string
+		release *Release
+		want    bool
+	}{
+		{"published", Rule{Event: "release"}, "published", published, true},
+		{"types match", Rule{Event: "release", Types: []string{"published", "released"}}, "released", published, true},
+		{"types miss", Rule{Event: "release", Types: []string{"published"}}, "edited", published, false},
+		{"prerelease included by default", Rule{Event: "release"}, "prereleased", prerelease, true},
+		{"prerelease excluded", Rule{Event: "release", Prerelease: "exclude"}, "published", prerelease, false},
+		{"exclude keeps releases", Rule{Event: "release", Prerelease: "exclude"}, "published", published, true},
+		{"prerelease only", Rule{Event: "release", Prerelease: "only"}, "published", prerelease, true},
+		{"only skips releases", Rule{Event: "release", Prerelease: "only"}, "published", published, false},
+		{"unknown prerelease mode", Rule{Event: "release", Prerelease: "sometimes"}, "published", published, false},
+		{"draft skipped by default", Rule{Event: "release"}, "created", draft, false},
+		{"draft skipped with draft false", Rule{Event: "release", Draft: &no}, "created", draft, false},
+		{"draft requested", Rule{Event: "release", Draft: &yes}, "created", draft, true},
+		{"draft true skips published", Rule{Event: "release", Draft: &yes}, "published", published, false},
+		{"no release", Rule{Event: "release"}, "published", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &ReleaseEvent{WebhookPayload: WebhookPayload{Action: tt.action}, Release: tt.release}
+			if got := ruleApplies(tt.rule, event); got != tt.want {
+				t.Errorf("ruleApplies() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVersionClientPayload(t *testing.T) {
+	release := (&ReleaseEvent{Release: &Release{TagName: "v2.1.0-rc.1"}}).ClientPayload()
+	version, ok := release["version"].(map[string]interface{})
+	if !ok {
+		t.Fatal("expected version key for a semver release tag")
+	}
+	if version["major"] != int64(2) || version["minor"] != int64(1) || version["patch"] != int64(0) || version["prerelease"] != "rc.1" {
+		t.Errorf("unexpected version payload: %v", version)
+	}
+
+	if _, ok := (&ReleaseEvent{Release: &Release{TagName: "nightly"}}).ClientPayload()["version"]; ok {
+		t.Error("expected no version key for a tag that is not a semantic version")
+	}
+	if _, ok := (&PushEvent{Ref: "refs/tags/v1.0.0"}).ClientPayload()["version"]; !ok {
+		t.Error("expected version key for a tag push")
+	}
+	if _, ok := (&PushEvent{Ref: "refs/heads/1.0.0"}).ClientPayload()["version"]; ok {
+		t.Error("expected no version key for a branch push")
+	}
+}
+
+func TestRefEventMatchesFilters(t *testing.T) {
+	branch := RefEvent{Ref: "feature/login", RefType: "branch"}
+	tag := RefEvent{Ref: "v2.1.0", RefType: "tag"}
+
+	tests := []struct {
+		name string
+		rule Rule
+		ref  RefEvent
+		want bool
+	}{
+		{"no filters", Rule{Event: "create"}, branch, true},
+		{"ref-types match", Rule{Event: "create", RefTypes: []string{"tag"}}, tag, true},
+		{"ref-types miss", Rule{Event: "create", RefTypes: []string{"tag"}}, branch, false},
+		{"branch filter", Rule{Event: "create", Branches: []string{"feature/**"}}, branch, true},
+		{"branch filter skips tags", Rule{Event: "create", Branches: []string{"feature/**"}}, tag, false},
+		{"branches-ignore", Rule{Event: "create", BranchesIgnore: []string{"feature/*"}}, branch, false},
+		{"tag filter", Rule{Event: "create", Tags: []string{"v*"}}, tag, true},
+		{"semver", Rule{Event: "create", Semver: ">=2.0.0"}, tag, true},
+		{"semver miss", Rule{Event: "create", Semver: "<2.0.0"}, tag, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ruleApplies(tt.rule, &CreateEvent{RefEvent: tt.ref}); got != tt.want {
+				t.Errorf("ruleApplies() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	payload := (&CreateEvent{RefEvent: tag}).ClientPayload()
+	if payload["ref"] != "refs/tags/v2.1.0" || payload["ref_name"] != "v2.1.0" || payload["ref_type"] != "tag" || payload["version"] == nil {
+		t.Errorf("unexpected create payload: %v", payload)
+	}
+}
+
+func TestTeardownRule(t *testing.T) {
+	rule := Rule{
+		Event:    "create",
+		RefTypes: []string{"branch"},
+		Branches: []string{"feature/**"},
+		Targets: []Target{
+			{Repo: "previews", EventType: "preview-create", TeardownEventType: "preview-teardown"},
+			{Repo: "notify", EventType: "branch-created"},
+		},
+	}
+	deleted := &DeleteEvent{RefEvent: RefEvent{Ref: "feature/login", RefType: "branch"}}
+
+	if ruleApplies(rule, deleted) {
+		t.Fatal("a create rule must not apply to a delete event")
+	}
+
+	teardown, ok := teardownRule(rule, deleted)
+	if !ok {
+		t.Fatal("teardownRule() = false, want the teardown targets")
+	}
+	if len(teardown.Targets) != 1 || teardown.Targets[0].Repo != "previews" || teardown.Targets[0].EventType != "preview-teardown" {
+		t.Errorf("teardown targets = %+v", teardown.Targets)
+	}
+	if rule.Targets[0].EventType != "preview-create" {
+		t.Errorf("teardownRule() modified the rule: %+v", rule.Targets[0])
+	}
+
+	if _, ok := teardownRule(rule, &DeleteEvent{RefEvent: RefEvent{Ref: "main", RefType: "branch"}}); ok {
+		t.Error("teardownRule() matched a branch outside the rule's filters")
+	}
+	if _, ok := teardownRule(rule, &CreateEvent{RefEvent: deleted.RefEvent}); ok {
+		t.Error("teardownRule() matched a create event")
+	}
+	if _, ok := teardownRule(Rule{Event: "push", Targets: rule.Targets}, deleted); ok {
+		t.Error("teardownRule() matched a push rule")
+	}
+}
+
+func TestPackageMatchesFilters(t *testing.T) {
+	image := &Package{
+		Name:        "api",
+		Namespace:   "my-org",
+		Ecosystem:   "CONTAINER",
+		PackageType: "CONTAINER",
+		PackageVersion: &PackageVersion{
+			Version:           "sha256:4a1b2c",
+			PackageURL:        "ghcr.io/my-org/api:v1.4.0",
+			ContainerMetadata: &ContainerMetadata{Tag: ContainerTag{Name: "v1.4.0", Digest: "sha256:4a1b2c"}},
+		},
+	}
+	npm := &Package{Name: "@my-org/client", PackageType: "npm", PackageVersion: &PackageVersion{Version: "2.0.1"}}
+
+	tests := []struct {
+		name string
+		rule Rule
+		pkg  *Package
+		want bool
+	}{
+		{"no filters", Rule{Event: "registry_package"}, image, true},
+		{"type case insensitive", Rule{Event: "registry_package", PackageTypes: []string{"container"}}, image, true},
+		{"type miss", Rule{Event: "registry_package", PackageTypes: []string{"npm"}}, image, false},
+		{"name", Rule{Event: "registry_package", PackageNames: []string{"api", "web"}}, image, true},
+		{"name miss", Rule{Event: "registry_package", PackageNames: []string{"web"}}, image, false},
+		{"scoped name", Rule{Event: "registry_package", PackageNames: []string{"@my-org/*"}}, npm, true},
+		{"container tag", Rule{Event: "registry_package", PackageVersions: []string{"v1.*"}}, image, true},
+		{"container digest", Rule{Event: "registry_package", PackageVersions: []string{"sha256:*"}}, image, true},
+		{"version miss", Rule{Event: "registry_package", PackageVersions: []string{"v2.*"}}, image, false},
+		{"npm version", Rule{Event: "registry_package", PackageVersions: []string{"2.*"}}, npm, true},
+		{"no package", Rule{Event: "registry_package"}, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ruleApplies(tt.rule, &RegistryPackageEvent{RegistryPackage: tt.pkg}); got != tt.want {
+				t.Errorf("ruleApplies() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	rule := Rule{Event: "package", Types: []string{"published"}, PackageNames: []string{"api"}}
+	if !ruleApplies(rule, &PackageEvent{WebhookPayload: WebhookPayload{Action: "published"}, Package: image}) {
+		t.Error("package rule did not match the published image")
+	}
+
+	payload := (&PackageEvent{Package: image}).ClientPayload()["package"].(map[string]interface{})
+	if payload["type"] != "container" || payload["tag"] != "v1.4.0" || payload["digest"] != "sha256:4a1b2c" || payload["url"] != "ghcr.io/my-org/api:v1.4.0" || payload["namespace"] != "my-org" {
+		t.Errorf("unexpected package payload: %v", payload)
+	}
+	if digest := npm.Digest(); digest != "" {
+		t.Errorf("npm Digest() = %q, want none", digest)
+	}
+}
+
+func TestDeploymentMatchesFilters(t *testing.T) {
+	deployment := &Deployment{ID: 3, SHA: "abc123", Ref: "main", Task: "deploy", Environment: "staging-eu"}
+	status := func(state string) *DeploymentStatusEvent {
+		return &DeploymentStatusEvent{
+			DeploymentStatus: &DeploymentStatus{ID: 7, State: state, TargetURL: "https://example.com/logs/7"},
+			Deployment:       deployment,
+		}
+	}
+
+	tests := []struct {
+		name  string
+		rule  Rule
+		event Event
+		want  bool
+	}{
+		{"deployment no filters", Rule{Event: "deployment"}, &DeploymentEvent{Deployment: deployment}, true},
+		{"deployment environment", Rule{Event: "deployment", Environments: []string{"staging-*"}}, &DeploymentEvent{Deployment: deployment}, true},
+		{"deployment environment miss", Rule{Event: "deployment", Environments: []string{"production"}}, &DeploymentEvent{Deployment: deployment}, false},
+		{"status state", Rule{Event: "deployment_status", States: []string{"success"}}, status("success"), true},
+		{"status state miss", Rule{Event: "deployment_status", States: []string{"success"}}, status("in_progress"), false},
+		{"status environment and state", Rule{Event: "deployment_status", Environments: []string{"staging-*"}, States: []string{"failure", "error"}}, status("failure"), true},
+		{"status environment miss", Rule{Event: "deployment_status", Environments: []string{"production"}}, status("success"), false},
+		{"no deployment", Rule{Event: "deployment"}, &DeploymentEvent{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ruleApplies(tt.rule, tt.event); got != tt.want {
+				t.Errorf("ruleApplies() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	payload := status("success").ClientPayload()
+	dep := payload["deployment"].(map[string]interface{})
+	if dep["id"] != int64(3) || dep["sha"] != "abc123" || dep["environment"] != "staging-eu" {
+		t.Errorf("unexpected deployment payload: %v", dep)
+	}
+	st := payload["deployment_status"].(map[string]interface{})
+	if st["state"] != "success" || st["log_url"] != "https://example.com/logs/7" || st["environment"] != "staging-eu" {
+		t.Errorf("unexpected deployment_status payload: %v", st)
+	}
+}
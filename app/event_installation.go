@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// InstallationEvent is sent when the App is installed, uninstalled, suspended or unsuspended
+type InstallationEvent struct {
+	WebhookPayload
+	Repositories []Repository `json:"repositories"`
+}
+
+func (e *InstallationEvent) Name() string { return "installation" }
+
+func (e *InstallationEvent) ClientPayload() map[string]interface{} { return nil }
+
+// Handle records the installation change in the installation registry
+func (e *InstallationEvent) Handle(ctx context.Context, req *WebhookRequest) WebhookResponse {
+	record, err := applyInstallationEvent(ctx, installationRegistry, e)
+	if err != nil {
+		logger.Error("failed to update installation registry", zap.Error(err))
+		return jsonResponse(500, newLifecycleResponse(req, e, "failed", err.Error()))
+	}
+
+	logger.Info("installation updated",
+		zap.String("action", e.Action),
+		zap.Int64("installationId", e.Installation.ID),
+		zap.String("account", e.Installation.Account.Login),
+	)
+	return jsonResponse(200, newLifecycleResponse(req, e, installationStatus(record), ""))
+}
+
+// InstallationRepositoriesEvent is sent when repositories are added to or removed from an installation
+type InstallationRepositoriesEvent struct {
+	WebhookPayload
+	RepositorySelection string       `json:"repository_selection"`
+	RepositoriesAdded   []Repository `json:"repositories_added"`
+	RepositoriesRemoved []Repository `json:"repositories_removed"`
+}
+
+func (e *InstallationRepositoriesEvent) Name() string { return "installation_repositories" }
+
+func (e *InstallationRepositoriesEvent) ClientPayload() map[string]interface{} { return nil }
+
+// Handle records the repository changes in the installation registry
+func (e *InstallationRepositoriesEvent) Handle(ctx context.Context, req *WebhookRequest) WebhookResponse {
+	record, err := applyInstallationRepositoriesEvent(ctx, installationRegistry, e)
+	if err != nil {
+		logger.Error("failed to update installation registry", zap.Error(err))
+		return jsonResponse(500, newLifecycleResponse(req, e, "failed", err.Error()))
+	}
+
+	logger.Info("installation repositories updated",
+		zap.String("action", e.Action),
+		zap.Int64("installationId", e.Installation.ID),
+		zap.Int("added", len(e.RepositoriesAdded)),
+		zap.Int("removed", len(e.RepositoriesRemoved)),
+	)
+	return jsonResponse(200, newLifecycleResponse(req, e, installationStatus(record), ""))
+}
+
+// installationStatus summarizes a registry record for the webhook response
+func installationStatus(record *InstallationRecord) string {
+	switch {
+	case record == nil:
+		return "removed"
+	case record.Suspended:
+		return "suspended"
+	default:
+		return "active"
+	}
+}
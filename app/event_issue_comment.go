@@ -0,0 +1,71 @@
+package main
+
+import "strings"
+
+// IssueCommentEvent is the payload of the issue_comment webhook event, sent
+// for comments on issues and pull requests
+type IssueCommentEvent struct {
+	WebhookPayload
+	Issue   Issue        `json:"issue"`
+	Comment IssueComment `json:"comment"`
+}
+
+type Issue struct {
+	ID      int64   `json:"id"`
+	Number  int     `json:"number"`
+	Title   string  `json:"title"`
+	State   string  `json:"state"`
+	HTMLURL string  `json:"html_url"`
+	User    User    `json:"user"`
+	Labels  []Label `json:"labels"`
+	// PullRequest is set when the issue is a pull request
+	PullRequest *IssuePullRequest `json:"pull_request,omitempty"`
+}
+
+type IssuePullRequest struct {
+	URL     string `json:"url"`
+	HTMLURL string `json:"html_url"`
+}
+
+type IssueComment struct {
+	ID      int64  `json:"id"`
+	Body    string `json:"body"`
+	HTMLURL string `json:"html_url"`
+	User    User   `json:"user"`
+}
+
+func (e *IssueCommentEvent) Name() string { return "issue_comment" }
+
+// DispatchCommands returns the /dispatch commands of a new comment. Edited
+// comments and comments by bots, including the App's own replies, are ignored.
+func (e *IssueCommentEvent) DispatchCommands() []DispatchCommand {
+	if e.Action != "created" || e.Sender.Type == "Bot" || strings.HasSuffix(e.Sender.Login, "[bot]") {
+		return nil
+	}
+	return parseDispatchCommands(e.Comment.Body)
+}
+
+// OverrideSignals returns the issue labels and the comment
+func (e *IssueCommentEvent) OverrideSignals() ([]string, []string) {
+	labels := make([]string, 0, len(e.Issue.Labels))
+	for _, label := range e.Issue.Labels {
+		labels = append(labels, label.Name)
+	}
+	return labels, []string{e.Comment.Body}
+}
+
+// ClientPayload returns the issue and the comment
+func (e *IssueCommentEvent) ClientPayload() map[string]interface{} {
+	return map[string]interface{}{
+		"issue": map[string]interface{}{
+			"number":       e.Issue.Number,
+			"title":        e.Issue.Title,
+			"html_url":     e.Issue.HTMLURL,
+			"pull_request": e.Issue.PullRequest != nil,
+		},
+		"comment": map[string]interface{}{
+			"id":       e.Comment.ID,
+			"html_url": e.Comment.HTMLURL,
+		},
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"slices"
+	"strings"
+)
+
+// PackageEvent is the payload of the package webhook event, sent for GitHub Packages
+type PackageEvent struct {
+	WebhookPayload
+	Package *Package `json:"package"`
+}
+
+// RegistryPackageEvent is the payload of the registry_package webhook event,
+// sent alongside package events for the container and npm registries
+type RegistryPackageEvent struct {
+	WebhookPayload
+	RegistryPackage *Package `json:"registry_package"`
+}
+
+type Package struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Ecosystem string `json:"ecosystem"`
+	// PackageType is e.g. container, npm, maven; registry_package events send it upper case
+	PackageType    string          `json:"package_type"`
+	HTMLURL        string          `json:"html_url"`
+	PackageVersion *PackageVersion `json:"package_version"`
+}
+
+type PackageVersion struct {
+	ID int64 `json:"id"`
+	// Version is the version of the package, the manifest digest for containers
+	Version           string             `json:"version"`
+	Name              string             `json:"name"`
+	HTMLURL           string             `json:"html_url"`
+	PackageURL        string             `json:"package_url"`
+	TargetCommitish   string             `json:"target_commitish"`
+	ContainerMetadata *ContainerMetadata `json:"container_metadata"`
+}
+
+type ContainerMetadata struct {
+	Tag ContainerTag `json:"tag"`
+}
+
+type ContainerTag struct {
+	Name   string `json:"name"`
+	Digest string `json:"digest"`
+}
+
+func (e *PackageEvent) Name() string { return "package" }
+
+func (e *RegistryPackageEvent) Name() string { return "registry_package" }
+
+// MatchesFilters applies the rule's package type, name and version filters
+func (e *PackageEvent) MatchesFilters(rule Rule) bool {
+	return e.Package.matchesFilters(rule)
+}
+
+// MatchesFilters applies the rule's package type, name and version filters
+func (e *RegistryPackageEvent) MatchesFilters(rule Rule) bool {
+	return e.RegistryPackage.matchesFilters(rule)
+}
+
+func (e *PackageEvent) ClientPayload() map[string]interface{} {
+	return map[string]interface{}{"package": e.Package.payload()}
+}
+
+func (e *RegistryPackageEvent) ClientPayload() map[string]interface{} {
+	return map[string]interface{}{"package": e.RegistryPackage.payload()}
+}
+
+// Tag returns the container tag of the published version, "" for other packages
+func (p *Package) Tag() string {
+	if p.PackageVersion == nil || p.PackageVersion.ContainerMetadata == nil {
+		return ""
+	}
+	return p.PackageVersion.ContainerMetadata.Tag.Name
+}
+
+// Digest returns the manifest digest of a published container image
+func (p *Package) Digest() string {
+	if p.PackageVersion == nil {
+		return ""
+	}
+	if metadata := p.PackageVersion.ContainerMetadata; metadata != nil && metadata.Tag.Digest != "" {
+		return metadata.Tag.Digest
+	}
+	if strings.HasPrefix(p.PackageVersion.Version, "sha256:") {
+		return p.PackageVersion.Version
+	}
+	return ""
+}
+
+func (p *Package) matchesFilters(rule Rule) bool {
+	if p == nil {
+		return false
+	}
+
+	if len(rule.PackageTypes) > 0 && !slices.ContainsFunc(rule.PackageTypes, func(t string) bool { return strings.EqualFold(t, p.PackageType) }) {
+		return false
+	}
+	if len(rule.PackageNames) > 0 && !matchGlobs(p.Name, rule.PackageNames) {
+		return false
+	}
+	if len(rule.PackageVersions) > 0 {
+		// Container images match on their tag as well as on the digest
+		version := ""
+		if p.PackageVersion != nil {
+			version = p.PackageVersion.Version
+		}
+		if !matchGlobs(version, rule.PackageVersions) && (p.Tag() == "" || !matchGlobs(p.Tag(), rule.PackageVersions)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Package) payload() map[string]interface{} {
+	if p == nil {
+		return nil
+	}
+
+	payload := map[string]interface{}{
+		"name":      p.Name,
+		"namespace": p.Namespace,
+		"ecosystem": p.Ecosystem,
+		"type":      strings.ToLower(p.PackageType),
+		"html_url":  p.HTMLURL,
+		"tag":       p.Tag(),
+		"digest":    p.Digest(),
+	}
+	if version := p.PackageVersion; version != nil {
+		payload["version"] = version.Version
+		payload["url"] = version.PackageURL
+		payload["target_commitish"] = version.TargetCommitish
+	}
+	return payload
+}
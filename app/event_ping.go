@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+// PingEvent is sent when the App webhook is created or pinged from the settings page
+type PingEvent struct {
+	WebhookPayload
+	Zen    string `json:"zen"`
+	HookID int64  `json:"hook_id"`
+	Hook   Hook   `json:"hook"`
+}
+
+type Hook struct {
+	ID     int64    `json:"id"`
+	Type   string   `json:"type"`
+	AppID  int64    `json:"app_id"`
+	Active bool     `json:"active"`
+	Events []string `json:"events"`
+}
+
+func (e *PingEvent) Name() string { return "ping" }
+
+func (e *PingEvent) ClientPayload() map[string]interface{} { return nil }
+
+// Handle answers the ping after checking it is meant for this App's webhook
+func (e *PingEvent) Handle(ctx context.Context, req *WebhookRequest) WebhookResponse {
+	if e.Hook.Type == "App" && githubAppID != 0 && e.Hook.AppID != githubAppID {
+		logger.Warn("ping for another app",
+			zap.Int64("appId", e.Hook.AppID),
+			zap.Int64("expectedAppId", githubAppID),
+		)
+		return jsonResponse(400, newLifecycleResponse(req, e, "rejected", "ping is for app "+strconv.FormatInt(e.Hook.AppID, 10)))
+	}
+
+	if header := req.Headers.Get("X-GitHub-Hook-ID"); header != "" && header != strconv.FormatInt(e.HookID, 10) {
+		logger.Warn("ping hook id does not match header",
+			zap.Int64("hookId", e.HookID),
+			zap.String("header", header),
+		)
+		return jsonResponse(400, newLifecycleResponse(req, e, "rejected", "hook_id does not match X-GitHub-Hook-ID"))
+	}
+
+	logger.Info("ping received",
+		zap.Int64("hookId", e.HookID),
+		zap.Int64("appId", e.Hook.AppID),
+		zap.Strings("events", e.Hook.Events),
+	)
+	return jsonResponse(200, newLifecycleResponse(req, e, "pong", e.Zen))
+}
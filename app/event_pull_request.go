@@ -0,0 +1,97 @@
+package main
+
+import "strings"
+
+// PullRequestEvent is the payload of the pull_request webhook event
+type PullRequestEvent struct {
+	WebhookPayload
+	Number      int         `json:"number"`
+	PullRequest PullRequest `json:"pull_request"`
+	// Label is the label added or removed by labeled and unlabeled actions
+	Label *Label `json:"label,omitempty"`
+}
+
+type PullRequest struct {
+	ID      int64   `json:"id"`
+	Number  int     `json:"number"`
+	Title   string  `json:"title"`
+	Body    string  `json:"body"`
+	State   string  `json:"state"`
+	HTMLURL string  `json:"html_url"`
+	Draft   bool    `json:"draft"`
+	Merged  bool    `json:"merged"`
+	User    User    `json:"user"`
+	Head    GitRef  `json:"head"`
+	Base    GitRef  `json:"base"`
+	Labels  []Label `json:"labels"`
+}
+
+// GitRef is the head or base of a pull request
+type GitRef struct {
+	Ref string `json:"ref"`
+	SHA string `json:"sha"`
+}
+
+type Label struct {
+	Name string `json:"name"`
+}
+
+func (e *PullRequestEvent) Name() string { return "pull_request" }
+
+// OverrideSignals returns the pull request labels, title and body
+func (e *PullRequestEvent) OverrideSignals() ([]string, []string) {
+	labels := make([]string, 0, len(e.PullRequest.Labels))
+	for _, label := range e.PullRequest.Labels {
+		labels = append(labels, label.Name)
+	}
+	return labels, []string{e.PullRequest.Title, e.PullRequest.Body}
+}
+
+// MatchesFilters applies the rule's base branch, head branch, merged, draft and label filters
+func (e *PullRequestEvent) MatchesFilters(rule Rule) bool {
+	if !matchIncludeIgnore(e.PullRequest.Base.Ref, rule.Branches, rule.BranchesIgnore) {
+		return false
+	}
+	if !matchIncludeIgnore(e.PullRequest.Head.Ref, rule.HeadBranches, rule.HeadBranchesIgnore) {
+		return false
+	}
+	if rule.Merged != nil && e.PullRequest.Merged != *rule.Merged {
+		return false
+	}
+	if rule.Draft != nil && e.PullRequest.Draft != *rule.Draft {
+		return false
+	}
+	if len(rule.Labels) > 0 && !e.hasAnyLabel(rule.Labels) {
+		return false
+	}
+	return true
+}
+
+// hasAnyLabel reports whether the pull request carries one of the labels, ignoring case
+func (e *PullRequestEvent) hasAnyLabel(labels []string) bool {
+	for _, label := range e.PullRequest.Labels {
+		for _, want := range labels {
+			if strings.EqualFold(label.Name, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (e *PullRequestEvent) ClientPayload() map[string]interface{} {
+	return map[string]interface{}{
+		"pull_request": map[string]interface{}{
+			"number":   e.Number,
+			"title":    e.PullRequest.Title,
+			"action":   e.Action,
+			"url":      e.PullRequest.HTMLURL,
+			"author":   e.PullRequest.User.Login,
+			"head_sha": e.PullRequest.Head.SHA,
+			"head_ref": e.PullRequest.Head.Ref,
+			"base_ref": e.PullRequest.Base.Ref,
+			"draft":    e.PullRequest.Draft,
+			"merged":   e.PullRequest.Merged,
+		},
+	}
+}
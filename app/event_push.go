@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// maxPushPayloadCommits is the number of commits GitHub lists in a push payload at most
+const maxPushPayloadCommits = 20
+
+// PushEvent is the payload of the push webhook event
+type PushEvent struct {
+	WebhookPayload
+	Ref        string       `json:"ref"`
+	Before     string       `json:"before"`
+	After      string       `json:"after"`
+	Created    bool         `json:"created"`
+	Deleted    bool         `json:"deleted"`
+	Forced     bool         `json:"forced"`
+	HeadCommit *Commit      `json:"head_commit"`
+	Commits    []Commit     `json:"commits"`
+	Pusher     CommitAuthor `json:"pusher"`
+}
+
+func (e *PushEvent) Name() string { return "push" }
+
+// changesAppConfig reports whether the push may have changed the app config
+// of the default branch. Pushes listing too many commits to tell, and forced
+// pushes, are assumed to change it.
+func (e *PushEvent) changesAppConfig() bool {
+	if e.Deleted || e.Repository.DefaultBranch == "" || e.Ref != "refs/heads/"+e.Repository.DefaultBranch {
+		return false
+	}
+	if e.Forced || len(e.Commits) >= maxPushPayloadCommits {
+		return true
+	}
+	for _, commit := range e.Commits {
+		if slices.Contains(commit.Added, configFilePath) || slices.Contains(commit.Modified, configFilePath) || slices.Contains(commit.Removed, configFilePath) {
+			return true
+		}
+	}
+	return false
+}
+
+// OverrideSignals returns the head commit message
+func (e *PushEvent) OverrideSignals() ([]string, []string) {
+	if e.HeadCommit == nil {
+		return nil, nil
+	}
+	return nil, []string{e.HeadCommit.Message}
+}
+
+// MatchesFilters applies the rule's branch filters and tag conditions
+func (e *PushEvent) MatchesFilters(rule Rule) bool {
+	return matchRefFilters(rule, e.Ref)
+}
+
+// CompareRange compares the commits before and after the push. As in GitHub
+// Actions, paths filters are not evaluated for tag pushes. A new branch is
+// compared with the default branch.
+func (e *PushEvent) CompareRange(ctx context.Context, client *github.Client) (string, string, error) {
+	branch, ok := strings.CutPrefix(e.Ref, "refs/heads/")
+	if !ok {
+		return "", "", nil
+	}
+
+	switch {
+	case e.Deleted || isNullSHA(e.After):
+		return e.Ref, "", nil
+	case e.Created || isNullSHA(e.Before):
+		if e.Repository.DefaultBranch == "" || e.Repository.DefaultBranch == branch {
+			return "", "", nil
+		}
+		return e.Repository.DefaultBranch, e.After, nil
+	default:
+		return e.Before, e.After, nil
+	}
+}
+
+func (e *PushEvent) ClientPayload() map[string]interface{} {
+	payload := map[string]interface{}{
+		"ref":    e.Ref,
+		"before": e.Before,
+		"after":  e.After,
+		"pusher": map[string]interface{}{
+			"name":  e.Pusher.Name,
+			"email": e.Pusher.Email,
+		},
+	}
+
+	// Pushes deleting a ref have no head commit
+	if e.HeadCommit != nil {
+		payload["head_commit"] = map[string]interface{}{
+			"id":        e.HeadCommit.ID,
+			"message":   e.HeadCommit.Message,
+			"timestamp": e.HeadCommit.Timestamp,
+			"url":       e.HeadCommit.URL,
+			"author":    e.HeadCommit.Author.Username,
+		}
+	}
+
+	if tag, ok := strings.CutPrefix(e.Ref, "refs/tags/"); ok {
+		if version := versionPayload(tag); version != nil {
+			payload["version"] = version
+		}
+	}
+
+	return payload
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"slices"
+)
+
+// RefEvent holds the fields of the create and delete webhook events, sent
+// when a branch or tag is created or deleted
+type RefEvent struct {
+	WebhookPayload
+	// Ref is the short branch or tag name
+	Ref     string `json:"ref"`
+	RefType string `json:"ref_type"`
+	// MasterBranch and Description are only sent for created refs
+	MasterBranch string `json:"master_branch"`
+	Description  string `json:"description"`
+	PusherType   string `json:"pusher_type"`
+}
+
+// CreateEvent is the payload of the create webhook event
+type CreateEvent struct {
+	RefEvent
+}
+
+// DeleteEvent is the payload of the delete webhook event
+type DeleteEvent struct {
+	RefEvent
+}
+
+func (e *CreateEvent) Name() string { return "create" }
+
+func (e *DeleteEvent) Name() string { return "delete" }
+
+// TeardownOf returns the event whose rules set up what a deleted ref tears down
+func (e *DeleteEvent) TeardownOf() string { return "create" }
+
+// FullRef returns the git ref of the branch or tag, e.g. refs/heads/main
+func (e *RefEvent) FullRef() string {
+	if e.RefType == "tag" {
+		return "refs/tags/" + e.Ref
+	}
+	return "refs/heads/" + e.Ref
+}
+
+// MatchesFilters applies the rule's ref-types filter, then its branch filters
+// and tag conditions to the created or deleted ref
+func (e *RefEvent) MatchesFilters(rule Rule) bool {
+	if len(rule.RefTypes) > 0 && !slices.Contains(rule.RefTypes, e.RefType) {
+		return false
+	}
+	return matchRefFilters(rule, e.FullRef())
+}
+
+func (e *RefEvent) ClientPayload() map[string]interface{} {
+	payload := map[string]interface{}{
+		"ref":         e.FullRef(),
+		"ref_name":    e.Ref,
+		"ref_type":    e.RefType,
+		"pusher_type": e.PusherType,
+	}
+	if e.MasterBranch != "" {
+		payload["master_branch"] = e.MasterBranch
+	}
+
+	if e.RefType == "tag" {
+		if version := versionPayload(e.Ref); version != nil {
+			payload["version"] = version
+		}
+	}
+	return payload
+}
+
+// teardownSource is implemented by events tearing down what the rules of
+// another event set up, e.g. a deleted branch removing its preview environment
+type teardownSource interface {
+	TeardownOf() string
+}
+
+// teardownRule returns the rule with only its teardown targets, their event
+// type replaced by teardown-event-type, when the event tears down what the
+// rule set up and the rule's filters match
+func teardownRule(rule Rule, event Event) (Rule, bool) {
+	source, ok := event.(teardownSource)
+	if !ok || rule.Event != source.TeardownOf() {
+		return rule, false
+	}
+	if filter, ok := event.(ruleFilter); ok && !filter.MatchesFilters(rule) {
+		return rule, false
+	}
+
+	teardown := rule
+	teardown.Targets = nil
+	for _, target := range rule.Targets {
+		if target.TeardownEventType != "" {
+			target.EventType = target.TeardownEventType
+			teardown.Targets = append(teardown.Targets, target)
+		}
+	}
+	return teardown, len(teardown.Targets) > 0
+}
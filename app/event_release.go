@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+
+	"go.uber.org/zap"
+)
+
+const (
+	prereleaseInclude = "include"
+	prereleaseExclude = "exclude"
+	prereleaseOnly    = "only"
+)
+
+// ReleaseEvent is the payload of the release webhook event
+type ReleaseEvent struct {
+	WebhookPayload
+	Release *Release `json:"release"`
+}
+
+func (e *ReleaseEvent) Name() string { return "release" }
+
+// OverrideSignals returns the release name and notes
+func (e *ReleaseEvent) OverrideSignals() ([]string, []string) {
+	if e.Release == nil {
+		return nil, nil
+	}
+	return nil, []string{e.Release.Name, e.Release.Body}
+}
+
+// MatchesFilters applies the rule's tag, prerelease and draft filters. Drafts
+// only match rules asking for them with draft: true.
+func (e *ReleaseEvent) MatchesFilters(rule Rule) bool {
+	if e.Release == nil {
+		return false
+	}
+
+	if !matchTagConditions(rule, e.Release.TagName) {
+		return false
+	}
+
+	wantDraft := rule.Draft != nil && *rule.Draft
+	if e.Release.Draft != wantDraft {
+		return false
+	}
+
+	switch rule.Prerelease {
+	case "", prereleaseInclude:
+		return true
+	case prereleaseExclude:
+		return !e.Release.Prerelease
+	case prereleaseOnly:
+		return e.Release.Prerelease
+	default:
+		logger.Warn("unknown prerelease filter, rule skipped", zap.String("prerelease", rule.Prerelease))
+		return false
+	}
+}
+
+// CompareRange compares the release with the previous release. The first
+// release of a repository has nothing to compare with, so paths filters do not apply.
+func (e *ReleaseEvent) CompareRange(ctx context.Context, client *github.Client) (string, string, error) {
+	if e.Release == nil || e.Release.Draft {
+		return "", "", nil
+	}
+
+	previous, err := findPreviousRelease(ctx, client, e.Repository.Owner.Login, e.Repository.Name, e.Release)
+	if err != nil {
+		return "", "", err
+	}
+	return previous, e.Release.TagName, nil
+}
+
+func (e *ReleaseEvent) ClientPayload() map[string]interface{} {
+	if e.Release == nil {
+		return nil
+	}
+
+	release := map[string]interface{}{
+		"tag_name":         e.Release.TagName,
+		"name":             e.Release.Name,
+		"draft":            e.Release.Draft,
+		"prerelease":       e.Release.Prerelease,
+		"target_commitish": e.Release.TargetCommitish,
+		"html_url":         e.Release.HTMLURL,
+		"body":             e.Release.Body,
+	}
+	// Drafts are not published yet
+	if e.Release.PublishedAt != nil {
+		release["published_at"] = e.Release.PublishedAt.Format(time.RFC3339)
+	}
+
+	payload := map[string]interface{}{
+		"release": release,
+	}
+	if version := versionPayload(e.Release.TagName); version != nil {
+		payload["version"] = version
+	}
+	return payload
+}
@@ -0,0 +1,60 @@
+package main
+
+import "slices"
+
+// WorkflowRunEvent is the payload of the workflow_run webhook event
+type WorkflowRunEvent struct {
+	WebhookPayload
+	WorkflowRun WorkflowRun `json:"workflow_run"`
+}
+
+type WorkflowRun struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	Path       string `json:"path"`
+	Event      string `json:"event"`
+	Status     string `json:"status"`
+	Conclusion string `json:"conclusion"`
+	HeadBranch string `json:"head_branch"`
+	HeadSHA    string `json:"head_sha"`
+	RunNumber  int    `json:"run_number"`
+	RunAttempt int    `json:"run_attempt"`
+	HTMLURL    string `json:"html_url"`
+}
+
+func (e *WorkflowRunEvent) Name() string { return "workflow_run" }
+
+// MatchesFilters applies the rule's workflows, conclusions and branch filters.
+// Rules without types only match completed runs.
+func (e *WorkflowRunEvent) MatchesFilters(rule Rule) bool {
+	if len(rule.Types) == 0 && e.Action != "completed" {
+		return false
+	}
+	if len(rule.Workflows) > 0 && !e.matchesWorkflow(rule.Workflows) {
+		return false
+	}
+	if len(rule.Conclusions) > 0 && !slices.Contains(rule.Conclusions, e.WorkflowRun.Conclusion) {
+		return false
+	}
+	return matchIncludeIgnore(e.WorkflowRun.HeadBranch, rule.Branches, rule.BranchesIgnore)
+}
+
+// matchesWorkflow matches the patterns against the workflow name or its file path
+func (e *WorkflowRunEvent) matchesWorkflow(patterns []string) bool {
+	return matchGlobs(e.WorkflowRun.Name, patterns) || matchGlobs(e.WorkflowRun.Path, patterns)
+}
+
+func (e *WorkflowRunEvent) ClientPayload() map[string]interface{} {
+	return map[string]interface{}{
+		"workflow_run": map[string]interface{}{
+			"id":          e.WorkflowRun.ID,
+			"name":        e.WorkflowRun.Name,
+			"path":        e.WorkflowRun.Path,
+			"conclusion":  e.WorkflowRun.Conclusion,
+			"url":         e.WorkflowRun.HTMLURL,
+			"head_sha":    e.WorkflowRun.HeadSHA,
+			"head_branch": e.WorkflowRun.HeadBranch,
+			"run_number":  e.WorkflowRun.RunNumber,
+		},
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	// Freeze windows name IANA time zones, the Lambda runtime has no zoneinfo
+	_ "time/tzdata"
+
+	"github.com/google/go-github/v57/github"
+	"go.uber.org/zap"
+)
+
+const (
+	freezeModeSkip  = "skip"
+	freezeModeDefer = "defer"
+
+	// maxFreezeChain bounds the overlapping windows followed to find when a target is released
+	maxFreezeChain = 100
+
+	defaultFreezeOverridePermission = "maintain"
+)
+
+// FreezeWindow is a period during which dispatches are held back, e.g. a
+// change freeze over the holidays or no deploys on Friday afternoons
+type FreezeWindow struct {
+	Name string `yaml:"name" mapstructure:"name"`
+	// Cron matches the minutes inside the window, "* 12-23 * * FRI" freezes Friday afternoons
+	Cron string `yaml:"cron" mapstructure:"cron"`
+	// From and To bound the window by date (2025-12-20, To inclusive) or time (2025-12-20T18:00)
+	From string `yaml:"from" mapstructure:"from"`
+	To   string `yaml:"to" mapstructure:"to"`
+	// Timezone is the IANA zone Cron, From and To are evaluated in, UTC by default
+	Timezone string `yaml:"timezone" mapstructure:"timezone"`
+	// Mode is skip (default) to drop frozen dispatches or defer to send them once the window closes
+	Mode string `yaml:"mode" mapstructure:"mode"`
+	// Targets limits the window to these target repos, all targets by default
+	Targets []string `yaml:"targets" mapstructure:"targets"`
+}
+
+// FreezeOverride lets emergency changes through every freeze window
+type FreezeOverride struct {
+	// Labels on the pull request that trigger the event
+	Labels []string `yaml:"labels" mapstructure:"labels"`
+	// Keywords in the pull request title or body, commit message or release
+	// notes. Anyone can type them, so they only count when the sender has
+	// Permission on the source repository.
+	Keywords []string `yaml:"keywords" mapstructure:"keywords"`
+	// Permission is the minimum repository role for keyword overrides, maintain by default
+	Permission string `yaml:"permission" mapstructure:"permission"`
+}
+
+// freezeOverrideSource is implemented by events that can carry a freeze override
+type freezeOverrideSource interface {
+	// OverrideSignals returns the labels and texts searched for override labels and keywords
+	OverrideSignals() (labels []string, texts []string)
+}
+
+// freezeWindow is a validated FreezeWindow
+type freezeWindow struct {
+	FreezeWindow
+	location *time.Location
+	cron     *cronSchedule
+	from, to time.Time
+}
+
+func compileFreezeWindow(w FreezeWindow) (*freezeWindow, error) {
+	fw := &freezeWindow{FreezeWindow: w, location: time.UTC}
+
+	if w.Timezone != "" {
+		location, err := time.LoadLocation(w.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", w.Timezone, err)
+		}
+		fw.location = location
+	}
+
+	switch w.Mode {
+	case "":
+		fw.Mode = freezeModeSkip
+	case freezeModeSkip, freezeModeDefer:
+	default:
+		return nil, fmt.Errorf("invalid mode %q, expected skip or defer", w.Mode)
+	}
+
+	if w.Cron != "" {
+		schedule, err := parseCron(w.Cron)
+		if err != nil {
+			return nil, err
+		}
+		fw.cron = schedule
+	}
+
+	var err error
+	if w.From != "" {
+		if fw.from, err = parseFreezeTime(w.From, fw.location, false); err != nil {
+			return nil, err
+		}
+	}
+	if w.To != "" {
+		if fw.to, err = parseFreezeTime(w.To, fw.location, true); err != nil {
+			return nil, err
+		}
+	}
+
+	if fw.cron == nil && fw.to.IsZero() {
+		return nil, fmt.Errorf("a freeze window needs a cron expression or an end date")
+	}
+	if !fw.from.IsZero() && !fw.to.IsZero() && !fw.from.Before(fw.to) {
+		return nil, fmt.Errorf("from %s is not before to %s", w.From, w.To)
+	}
+	return fw, nil
+}
+
+// parseFreezeTime parses a date or a date and time in the location. An end
+// date is inclusive, so it is moved to the start of the next day.
+func parseFreezeTime(value string, location *time.Location, end bool) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, value, location); err == nil {
+			return t, nil
+		}
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", value, location)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD or YYYY-MM-DDTHH:MM", value)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// appliesTo reports whether the window covers the target repo
+func (w *freezeWindow) appliesTo(target Target) bool {
+	if len(w.Targets) == 0 {
+		return true
+	}
+	for _, repo := range w.Targets {
+		if strings.EqualFold(repo, target.Repo) {
+			return true
+		}
+	}
+	return false
+}
+
+// activeAt reports whether t falls inside the window
+func (w *freezeWindow) activeAt(t time.Time) bool {
+	t = t.In(w.location)
+	if !w.from.IsZero() && t.Before(w.from) {
+		return false
+	}
+	if !w.to.IsZero() && !t.Before(w.to) {
+		return false
+	}
+	return w.cron == nil || w.cron.Matches(t)
+}
+
+// closesAt returns when the window active at t closes, the zero time if it
+// does not close within a year
+func (w *freezeWindow) closesAt(t time.Time) time.Time {
+	end := w.to
+	if w.cron != nil {
+		cronEnd := w.cron.NextNonMatching(t.In(w.location))
+		if cronEnd.IsZero() && end.IsZero() {
+			return time.Time{}
+		}
+		if end.IsZero() || (!cronEnd.IsZero() && cronEnd.Before(end)) {
+			end = cronEnd
+		}
+	}
+	return end
+}
+
+// freezeGate decides for each target of a delivery whether a freeze window holds it back
+type freezeGate struct {
+	windows    []*freezeWindow
+	err        error
+	overridden bool
+	now        time.Time
+
+	// keyword is the override keyword found in the event, it overrides once
+	// the sender's permission is checked
+	keyword  string
+	override *FreezeOverride
+	client   *github.Client
+	event    Event
+}
+
+func newFreezeGate(config *AppConfig, event Event, client *github.Client, now time.Time) *freezeGate {
+	gate := &freezeGate{now: now, override: config.FreezeOverride, client: client, event: event}
+
+	for i, w := range config.Freezes {
+		fw, err := compileFreezeWindow(w)
+		if err != nil {
+			gate.err = fmt.Errorf("invalid freeze window %s: %w", freezeWindowName(w, i), err)
+			return gate
+		}
+		if fw.Name == "" {
+			fw.Name = freezeWindowName(w, i)
+		}
+		gate.windows = append(gate.windows, fw)
+	}
+
+	if len(gate.windows) > 0 && config.FreezeOverride != nil {
+		gate.overridden, gate.keyword = freezeOverridden(config.FreezeOverride, event)
+	}
+	return gate
+}
+
+func freezeWindowName(w FreezeWindow, index int) string {
+	if w.Name != "" {
+		return w.Name
+	}
+	return fmt.Sprintf("#%d", index)
+}
+
+// Check returns the freeze window holding the target back and when the target
+// is released, after every overlapping window closed. Skip windows take
+// precedence over defer windows. An error means the freeze configuration is
+// invalid, the sender's permission could not be checked or the target stays
+// frozen for over a year.
+func (g *freezeGate) Check(ctx context.Context, target Target) (*freezeWindow, time.Time, error) {
+	if g.err != nil {
+		return nil, time.Time{}, g.err
+	}
+
+	var active *freezeWindow
+	for _, w := range g.windows {
+		if w.appliesTo(target) && w.activeAt(g.now) && (active == nil || (active.Mode == freezeModeDefer && w.Mode == freezeModeSkip)) {
+			active = w
+		}
+	}
+	if active == nil {
+		return nil, time.Time{}, nil
+	}
+
+	if !g.overridden && g.keyword != "" {
+		overridden, err := g.authorizeKeyword(ctx)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		g.overridden, g.keyword = overridden, ""
+	}
+	if g.overridden {
+		logger.Warn("freeze window overridden",
+			zap.String("freeze", active.Name),
+			zap.String("target", target.Repo),
+		)
+		return nil, time.Time{}, nil
+	}
+
+	// Follow overlapping windows until none is active
+	release := g.now
+	for i := 0; i < maxFreezeChain; i++ {
+		moved := false
+		for _, w := range g.windows {
+			if !w.appliesTo(target) || !w.activeAt(release) {
+				continue
+			}
+			end := w.closesAt(release)
+			if end.IsZero() {
+				return active, time.Time{}, fmt.Errorf("freeze window %s does not close within a year", w.Name)
+			}
+			release = end
+			moved = true
+		}
+		if !moved {
+			return active, release, nil
+		}
+	}
+	return active, time.Time{}, fmt.Errorf("freeze windows for %s do not close", target.Repo)
+}
+
+// authorizeKeyword reports whether the sender has the permission needed for
+// keyword overrides
+func (g *freezeGate) authorizeKeyword(ctx context.Context) (bool, error) {
+	required := defaultFreezeOverridePermission
+	if g.override.Permission != "" {
+		required = strings.ToLower(g.override.Permission)
+	}
+	if _, ok := permissionRanks[required]; !ok || required == "none" {
+		return false, fmt.Errorf("invalid freeze-override permission %q", required)
+	}
+
+	payload := g.event.Envelope()
+	permission, err := repositoryPermission(ctx, g.client, payload.Repository.Owner.Login, payload.Repository.Name, payload.Sender.Login)
+	if err != nil {
+		return false, err
+	}
+	if permissionRanks[permission] < permissionRanks[required] {
+		logger.Info("freeze override keyword ignored",
+			zap.String("keyword", g.keyword),
+			zap.String("sender", payload.Sender.Login),
+			zap.String("permission", permission),
+		)
+		return false, nil
+	}
+	return true, nil
+}
+
+// freezeOverridden reports whether the event carries an override label, or
+// else returns the override keyword it carries
+func freezeOverridden(override *FreezeOverride, event Event) (bool, string) {
+	source, ok := event.(freezeOverrideSource)
+	if !ok {
+		return false, ""
+	}
+
+	labels, texts := source.OverrideSignals()
+	for _, label := range labels {
+		for _, want := range override.Labels {
+			if strings.EqualFold(label, want) {
+				return true, ""
+			}
+		}
+	}
+	for _, text := range texts {
+		for _, keyword := range override.Keywords {
+			if keyword != "" && strings.Contains(strings.ToLower(text), strings.ToLower(keyword)) {
+				return false, keyword
+			}
+		}
+	}
+	return false, ""
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+func TestCompileFreezeWindow(t *testing.T) {
+	tests := []struct {
+		name    string
+		window  FreezeWindow
+		wantErr string
+	}{
+		{name: "cron", window: FreezeWindow{Cron: "* 12-23 * * FRI"}},
+		{name: "date range", window: FreezeWindow{From: "2025-12-20", To: "2026-01-02", Mode: "defer"}},
+		{name: "datetime end", window: FreezeWindow{To: "2025-12-20T18:00"}},
+		{name: "rfc3339 end", window: FreezeWindow{To: "2025-12-20T18:00:00+01:00"}},
+		{name: "no end", window: FreezeWindow{From: "2025-12-20"}, wantErr: "needs a cron expression or an end date"},
+		{name: "bad cron", window: FreezeWindow{Cron: "* * *"}, wantErr: "expected 5 fields"},
+		{name: "bad date", window: FreezeWindow{To: "20/12/2025"}, wantErr: "invalid date"},
+		{name: "bad timezone", window: FreezeWindow{Cron: "* * * * *", Timezone: "Mars/Olympus"}, wantErr: "invalid timezone"},
+		{name: "bad mode", window: FreezeWindow{Cron: "* * * * *", Mode: "queue"}, wantErr: "invalid mode"},
+		{name: "empty range", window: FreezeWindow{From: "2025-12-20", To: "2025-12-19"}, wantErr: "is not before"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileFreezeWindow(tt.window)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("compileFreezeWindow() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("compileFreezeWindow() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFreezeGateCheck(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("LoadLocation() error = %v", err)
+	}
+
+	fridays := FreezeWindow{Name: "fridays", Cron: "* 12-23 * * FRI", Timezone: "Europe/Berlin", Targets: []string{"prod"}}
+	holidays := FreezeWindow{Name: "holidays", From: "2025-12-20", To: "2026-01-02", Timezone: "Europe/Berlin", Mode: "defer"}
+
+	tests := []struct {
+		name        string
+		windows     []FreezeWindow
+		now         time.Time
+		target      string
+		wantWindow  string
+		wantRelease time.Time
+		wantErr     bool
+	}{
+		{
+			name:        "friday afternoon",
+			windows:     []FreezeWindow{fridays},
+			now:         time.Date(2025, 12, 12, 15, 0, 0, 0, berlin),
+			target:      "prod",
+			wantWindow:  "fridays",
+			wantRelease: time.Date(2025, 12, 13, 0, 0, 0, 0, berlin),
+		},
+		{
+			name:    "friday morning",
+			windows: []FreezeWindow{fridays},
+			now:     time.Date(2025, 12, 12, 11, 59, 0, 0, berlin),
+			target:  "prod",
+		},
+		{
+			name:    "other target",
+			windows: []FreezeWindow{fridays},
+			now:     time.Date(2025, 12, 12, 15, 0, 0, 0, berlin),
+			target:  "staging",
+		},
+		{
+			name:    "time zone applied",
+			windows: []FreezeWindow{fridays},
+			// 11:30 UTC is 12:30 in Berlin
+			now:         time.Date(2025, 12, 12, 11, 30, 0, 0, time.UTC),
+			target:      "PROD",
+			wantWindow:  "fridays",
+			wantRelease: time.Date(2025, 12, 13, 0, 0, 0, 0, berlin),
+		},
+		{
+			name:        "inclusive end date",
+			windows:     []FreezeWindow{holidays},
+			now:         time.Date(2026, 1, 2, 23, 0, 0, 0, berlin),
+			target:      "prod",
+			wantWindow:  "holidays",
+			wantRelease: time.Date(2026, 1, 3, 0, 0, 0, 0, berlin),
+		},
+		{
+			name:        "overlapping windows chain",
+			windows:     []FreezeWindow{holidays, {Name: "new year", From: "2026-01-02", To: "2026-01-05"}},
+			now:         time.Date(2025, 12, 24, 10, 0, 0, 0, berlin),
+			target:      "prod",
+			wantWindow:  "holidays",
+			wantRelease: time.Date(2026, 1, 6, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "skip window takes precedence",
+			windows:    []FreezeWindow{holidays, fridays},
+			now:        time.Date(2025, 12, 26, 15, 0, 0, 0, berlin),
+			target:     "prod",
+			wantWindow: "fridays",
+			// The holidays still hold the target after Friday
+			wantRelease: time.Date(2026, 1, 3, 0, 0, 0, 0, berlin),
+		},
+		{
+			name:    "never closes",
+			windows: []FreezeWindow{{Name: "forever", Cron: "* * * * *"}},
+			now:     time.Date(2025, 12, 26, 15, 0, 0, 0, berlin),
+			target:  "prod",
+			wantErr: true,
+		},
+		{
+			name:    "invalid window",
+			windows: []FreezeWindow{{Name: "broken", Cron: "nope"}},
+			now:     time.Date(2025, 12, 26, 15, 0, 0, 0, berlin),
+			target:  "prod",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gate := newFreezeGate(&AppConfig{Freezes: tt.windows}, &PushEvent{}, nil, tt.now)
+			window, release, err := gate.Check(context.Background(), Target{Repo: tt.target, EventType: "deploy"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			name := ""
+			if window != nil {
+				name = window.Name
+			}
+			if name != tt.wantWindow {
+				t.Errorf("Check() window = %q, want %q", name, tt.wantWindow)
+			}
+			if !release.Equal(tt.wantRelease) {
+				t.Errorf("Check() release = %v, want %v", release, tt.wantRelease)
+			}
+		})
+	}
+}
+
+func TestFreezeOverride(t *testing.T) {
+	override := &FreezeOverride{Labels: []string{"emergency"}, Keywords: []string{"[hotfix]"}}
+
+	tests := []struct {
+		name        string
+		event       Event
+		wantLabel   bool
+		wantKeyword string
+	}{
+		{
+			name:      "pull request label",
+			event:     &PullRequestEvent{PullRequest: PullRequest{Labels: []Label{{Name: "Emergency"}}}},
+			wantLabel: true,
+		},
+		{
+			name:        "pull request title",
+			event:       &PullRequestEvent{PullRequest: PullRequest{Title: "[HOTFIX] restore login"}},
+			wantKeyword: "[hotfix]",
+		},
+		{
+			name:        "commit message",
+			event:       &PushEvent{HeadCommit: &Commit{Message: "fix: restore login [hotfix]"}},
+			wantKeyword: "[hotfix]",
+		},
+		{
+			name:        "release notes",
+			event:       &ReleaseEvent{Release: &Release{Body: "[hotfix] restore login"}},
+			wantKeyword: "[hotfix]",
+		},
+		{
+			name:  "no signal",
+			event: &PushEvent{HeadCommit: &Commit{Message: "feat: new login"}},
+		},
+		{
+			name:  "push without head commit",
+			event: &PushEvent{},
+		},
+		{
+			name:  "event without signals",
+			event: &WorkflowRunEvent{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			label, keyword := freezeOverridden(override, tt.event)
+			if label != tt.wantLabel || keyword != tt.wantKeyword {
+				t.Errorf("freezeOverridden() = %v, %q, want %v, %q", label, keyword, tt.wantLabel, tt.wantKeyword)
+			}
+		})
+	}
+}
+
+func TestFreezeGateOverride(t *testing.T) {
+	lookups := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		login := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/repos/my-org/app/collaborators/"), "/permission")
+		role := map[string]string{"alice": "maintain", "bob": "write"}[login]
+		if role == "" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message": "Not Found"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"permission": "write", "user": map[string]interface{}{"role_name": role}})
+	}))
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	push := func(sender, message string) *PushEvent {
+		return &PushEvent{
+			WebhookPayload: WebhookPayload{
+				Repository: Repository{Name: "app", Owner: User{Login: "my-org"}},
+				Sender:     User{Login: sender},
+			},
+			HeadCommit: &Commit{Message: message},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		override    FreezeOverride
+		event       Event
+		wantFrozen  bool
+		wantErr     bool
+		wantLookups int
+	}{
+		{"keyword by maintainer", FreezeOverride{Keywords: []string{"[hotfix]"}}, push("alice", "[hotfix]"), false, false, 1},
+		{"keyword by writer", FreezeOverride{Keywords: []string{"[hotfix]"}}, push("bob", "[hotfix]"), true, false, 1},
+		{"keyword by outside collaborator", FreezeOverride{Keywords: []string{"[hotfix]"}}, push("mallory", "[hotfix]"), true, false, 1},
+		{"lowered permission", FreezeOverride{Keywords: []string{"[hotfix]"}, Permission: "write"}, push("bob", "[hotfix]"), false, false, 1},
+		{"invalid permission", FreezeOverride{Keywords: []string{"[hotfix]"}, Permission: "owner"}, push("alice", "[hotfix]"), false, true, 0},
+		{"no keyword", FreezeOverride{Keywords: []string{"[hotfix]"}}, push("alice", "fix: login"), true, false, 0},
+		{
+			name:     "label",
+			override: FreezeOverride{Labels: []string{"emergency"}},
+			event:    &PullRequestEvent{PullRequest: PullRequest{Labels: []Label{{Name: "emergency"}}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookups = 0
+			config := &AppConfig{
+				Freezes:        []FreezeWindow{{Name: "all", Cron: "* * * * *", To: "2030-01-01"}},
+				FreezeOverride: &tt.override,
+			}
+			gate := newFreezeGate(config, tt.event, client, time.Date(2025, 12, 24, 0, 0, 0, 0, time.UTC))
+
+			// The permission is looked up once per delivery
+			for _, repo := range []string{"prod", "staging"} {
+				window, _, err := gate.Check(context.Background(), Target{Repo: repo})
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Check() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if (window != nil) != tt.wantFrozen {
+					t.Errorf("Check() window = %v, want frozen %v", window, tt.wantFrozen)
+				}
+			}
+			if lookups != tt.wantLookups {
+				t.Errorf("permission looked up %d times, want %d", lookups, tt.wantLookups)
+			}
+		})
+	}
+}
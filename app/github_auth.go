@@ -3,6 +3,9 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"net/url"
+	"os"
+	"strings"
 
 	"github.com/bradleyfalzon/ghinstallation/v2"
 	"github.com/google/go-github/v57/github"
@@ -10,6 +13,10 @@ import (
 
 var (
 	defaultOwner string = "salsiy"
+
+	// githubAPIURL overrides the GitHub API base URL, for GitHub Enterprise
+	// Server (https://ghe.example.com/api/v3) or a fake GitHub when running locally
+	githubAPIURL = os.Getenv("GITHUB_API_URL")
 )
 
 func createGitHubClient(installationID int64) (*github.Client, error) {
@@ -30,8 +37,60 @@ func createGitHubClient(installationID int64) (*github.Client, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create installation transport: %w", err)
 	}
+	if githubAPIURL != "" {
+		installationTransport.BaseURL = strings.TrimSuffix(githubAPIURL, "/")
+	}
 
-	client := github.NewClient(&http.Client{Transport: installationTransport})
+	client, err := newGitHubClient(&http.Client{Transport: installationTransport})
+	if err != nil {
+		return nil, err
+	}
 	logger.Info("created GitHub client for installation")
 	return client, nil
 }
+
+// createGitHubAppClient creates a client authenticated as the App itself with a
+// JWT signed by the App private key, for the /app endpoints
+func createGitHubAppClient() (*github.Client, error) {
+	if githubAppPrivateKeyPem == "" {
+		return nil, fmt.Errorf("GitHub App private key not loaded")
+	}
+
+	if githubAppID == 0 {
+		return nil, fmt.Errorf("GitHub App ID not configured")
+	}
+
+	appTransport, err := ghinstallation.NewAppsTransport(
+		http.DefaultTransport,
+		githubAppID,
+		[]byte(githubAppPrivateKeyPem),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create app transport: %w", err)
+	}
+	if githubAPIURL != "" {
+		appTransport.BaseURL = strings.TrimSuffix(githubAPIURL, "/")
+	}
+
+	client, err := newGitHubClient(&http.Client{Transport: appTransport})
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("created GitHub client for app")
+	return client, nil
+}
+
+// newGitHubClient creates a go-github client, pointed at githubAPIURL when set
+func newGitHubClient(httpClient *http.Client) (*github.Client, error) {
+	client := github.NewClient(httpClient)
+	if githubAPIURL == "" {
+		return client, nil
+	}
+
+	baseURL, err := url.Parse(strings.TrimSuffix(githubAPIURL, "/") + "/")
+	if err != nil {
+		return nil, fmt.Errorf("invalid GITHUB_API_URL: %w", err)
+	}
+	client.BaseURL = baseURL
+	return client, nil
+}
@@ -9,42 +9,52 @@ import (
 	"go.uber.org/zap"
 )
 
-// sendRepositoryDispatch sends a repository dispatch event to the target repository
-func sendRepositoryDispatch(ctx context.Context, client *github.Client, target Target, payload *WebhookPayload) error {
-
-	owner := payload.Repository.Owner.Login
+// sendRepositoryDispatch sends a repository dispatch event to the target repository.
+// fields are rule specific client_payload keys, e.g. the matched paths.
+func sendRepositoryDispatch(ctx context.Context, client *github.Client, target Target, event Event, fields map[string]interface{}) error {
+	clientPayload, err := buildClientPayload(event, fields)
+	if err != nil {
+		return err
+	}
+	return dispatchClientPayload(ctx, client, event.Envelope().Repository.Owner.Login, target, clientPayload)
+}
 
-	logger.Info("sending repository dispatch",
-		zap.String("target", fmt.Sprintf("%s/%s", owner, target.Repo)),
-		zap.String("eventType", target.EventType),
-	)
+// buildClientPayload builds the client_payload of the dispatches sent for an event
+func buildClientPayload(event Event, fields map[string]interface{}) (json.RawMessage, error) {
+	payload := event.Envelope()
 
-	// Build the client payload
-	sourceEvent, _ := determineEventType(payload) 
 	clientPayload := map[string]interface{}{
 		"source_repo":  payload.Repository.FullName,
-		"source_event": sourceEvent,
+		"source_event": event.Name(),
 		"sender":       payload.Sender.Login,
 	}
 
-	// Add release info if available
-	if payload.Release != nil {
-		clientPayload["release"] = map[string]interface{}{
-			"tag_name": payload.Release.TagName,
-			"name":     payload.Release.Name,
-			"draft":    payload.Release.Draft,
-		}
+	// Add the event specific fields
+	for key, value := range event.ClientPayload() {
+		clientPayload[key] = value
 	}
-	
+	for key, value := range fields {
+		clientPayload[key] = value
+	}
+
 	payloadBytes, err := json.Marshal(clientPayload)
 	if err != nil {
-		return fmt.Errorf("failed to marshal payload: %w", err)
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
 	}
-	rawPayload := json.RawMessage(payloadBytes)
+	return json.RawMessage(payloadBytes), nil
+}
+
+// dispatchClientPayload sends a repository dispatch with a prepared client_payload
+// to the target repository of owner
+func dispatchClientPayload(ctx context.Context, client *github.Client, owner string, target Target, clientPayload json.RawMessage) error {
+	logger.Info("sending repository dispatch",
+		zap.String("target", fmt.Sprintf("%s/%s", owner, target.Repo)),
+		zap.String("eventType", target.EventType),
+	)
 
-	_, _, err = client.Repositories.Dispatch(ctx, owner, target.Repo, github.DispatchRequestOptions{
+	_, _, err := client.Repositories.Dispatch(ctx, owner, target.Repo, github.DispatchRequestOptions{
 		EventType:     target.EventType,
-		ClientPayload: &rawPayload,
+		ClientPayload: &clientPayload,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to dispatch: %w", err)
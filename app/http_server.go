@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultListenAddr = ":8080"
+	// GitHub caps webhook payloads at 25 MB
+	maxWebhookBodySize = 25 << 20
+	shutdownTimeout    = 30 * time.Second
+)
+
+// runHTTPServer serves webhooks over plain HTTP until SIGINT or SIGTERM is
+// received, then stops accepting requests and waits for in-flight ones and
+// queued deliveries
+func runHTTPServer(addr string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// The in-memory queue is consumed in-process; stop consuming only after shutdown
+	consumerCtx, stopConsumer := context.WithCancel(context.Background())
+	defer stopConsumer()
+	queue, _ := deliveryQueue.(*memoryDeliveryQueue)
+	consumed := make(chan struct{})
+	if queue != nil {
+		go func() {
+			defer close(consumed)
+			queue.Consume(consumerCtx, processQueuedDelivery)
+		}()
+	}
+	// Without an EventBridge schedule the server sends deferred dispatches itself
+	go sendDeferredDispatchesEvery(consumerCtx, time.Minute)
+	scheduleInterval, err := scheduleIntervalFromEnv()
+	if err != nil {
+		return err
+	}
+	go dispatchSchedulesEvery(consumerCtx, scheduleInterval)
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           newHTTPHandler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+	logger.Info("http server listening", zap.String("addr", addr))
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Info("shutting down http server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	// Deliveries acknowledged with a 202 may still be queued, drain them within the same timeout
+	if queue != nil {
+		queue.Close()
+		select {
+		case <-consumed:
+		case <-shutdownCtx.Done():
+			logger.Warn("shutdown timed out before the delivery queue was drained",
+				zap.Int("remaining", len(queue.deliveries)),
+			)
+		}
+	}
+	return nil
+}
+
+// newHTTPHandler routes health checks and webhook deliveries
+func newHTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, "ok")
+	})
+	mux.HandleFunc("POST /", serveWebhook)
+	return mux
+}
+
+// serveWebhook adapts an HTTP request to the webhook pipeline
+func serveWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodySize))
+	if err != nil {
+		logger.Warn("failed to read request body", zap.Error(err))
+		http.Error(w, "Error: failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	request := &WebhookRequest{
+		RequestID: r.Header.Get("X-Request-Id"),
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		SourceIP:  r.RemoteAddr,
+		UserAgent: r.UserAgent(),
+		Headers:   r.Header,
+		Body:      body,
+	}
+
+	// Keep processing even if GitHub gives up waiting and closes the connection
+	response := handleWebhook(context.WithoutCancel(r.Context()), request)
+
+	w.Header().Set("Content-Type", response.contentTypeHeader())
+	w.WriteHeader(response.StatusCode)
+	io.WriteString(w, response.Body)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	originalSecret := githubAppWebhookSecret
+	githubAppWebhookSecret = "test-secret"
+	defer func() { githubAppWebhookSecret = originalSecret }()
+
+	sign := func(body string) string {
+		mac := hmac.New(sha256.New, []byte(githubAppWebhookSecret))
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	server := httptest.NewServer(newHTTPHandler())
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		headers    map[string]string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "health check",
+			method:     http.MethodGet,
+			path:       "/healthz",
+			wantStatus: http.StatusOK,
+			wantBody:   "ok",
+		},
+		{
+			name:       "missing signature",
+			method:     http.MethodPost,
+			path:       "/",
+			headers:    map[string]string{"X-GitHub-Event": "release"},
+			body:       `{}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "Error: missing signature header",
+		},
+		{
+			name:   "invalid signature",
+			method: http.MethodPost,
+			path:   "/webhook",
+			headers: map[string]string{
+				"X-GitHub-Event":      "release",
+				"X-Hub-Signature-256": sign(`{"other":"body"}`),
+			},
+			body:       `{}`,
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   "Error: invalid signature",
+		},
+		{
+			name:   "unsupported event",
+			method: http.MethodPost,
+			path:   "/",
+			headers: map[string]string{
+				"x-github-event":      "star",
+				"x-hub-signature-256": sign(`{}`),
+			},
+			body:       `{}`,
+			wantStatus: http.StatusOK,
+			wantBody:   "Event type not supported",
+		},
+		{
+			name:       "get on webhook path",
+			method:     http.MethodGet,
+			path:       "/",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, server.URL+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+
+			body, _ := io.ReadAll(resp.Body)
+			if tt.wantBody != "" && string(body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	defaultIdempotencyTTL = 72 * time.Hour
+	// defaultIdempotencyLease outlasts the function timeout, a delivery whose
+	// processing was cut short is claimable again once its lease expires
+	defaultIdempotencyLease = 5 * time.Minute
+)
+
+// IdempotencyStore records webhook delivery IDs so that redelivered
+// webhooks are not processed (and dispatched) a second time
+type IdempotencyStore interface {
+	// Claim records the delivery ID as in progress for the lease duration and
+	// reports false if it is in progress or was completed
+	Claim(ctx context.Context, deliveryID string) (bool, error)
+	// Complete marks the delivery as processed, keeping it for the TTL
+	Complete(ctx context.Context, deliveryID string) error
+	// Release forgets the delivery ID so a later redelivery is processed again
+	Release(ctx context.Context, deliveryID string) error
+}
+
+// newIdempotencyStore builds the store selected by the IDEMPOTENCY_STORE env var
+func newIdempotencyStore(cfg aws.Config) (IdempotencyStore, error) {
+	ttl := defaultIdempotencyTTL
+	if value := os.Getenv("IDEMPOTENCY_TTL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IDEMPOTENCY_TTL: %w", err)
+		}
+		ttl = parsed
+	}
+	lease := defaultIdempotencyLease
+	if value := os.Getenv("IDEMPOTENCY_LEASE"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IDEMPOTENCY_LEASE: %w", err)
+		}
+		lease = parsed
+	}
+
+	switch store := os.Getenv("IDEMPOTENCY_STORE"); store {
+	case "", "memory":
+		return newMemoryIdempotencyStore(lease, ttl), nil
+	case "file":
+		dir := os.Getenv("IDEMPOTENCY_FILE_DIR")
+		if dir == "" {
+			dir = filepath.Join(os.TempDir(), "github-app-deliveries")
+		}
+		return newFileIdempotencyStore(dir, lease, ttl)
+	case "dynamodb":
+		table := os.Getenv("IDEMPOTENCY_TABLE")
+		if table == "" {
+			return nil, fmt.Errorf("IDEMPOTENCY_TABLE is required for the dynamodb store")
+		}
+		return newDynamoIdempotencyStore(newDynamoDBClient(cfg), table, lease, ttl), nil
+	default:
+		return nil, fmt.Errorf("unknown idempotency store %q", store)
+	}
+}
+
+// newDynamoDBClient creates a DynamoDB client, honouring DYNAMODB_ENDPOINT
+// so DynamoDB Local can stand in for the real service
+func newDynamoDBClient(cfg aws.Config) *dynamodb.Client {
+	return dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+		if endpoint := os.Getenv("DYNAMODB_ENDPOINT"); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+}
+
+// memoryIdempotencyStore keeps delivery IDs for the lifetime of the process
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	lease   time.Duration
+	ttl     time.Duration
+	claimed map[string]time.Time
+	now     func() time.Time
+}
+
+func newMemoryIdempotencyStore(lease, ttl time.Duration) *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{
+		lease:   lease,
+		ttl:     ttl,
+		claimed: make(map[string]time.Time),
+		now:     time.Now,
+	}
+}
+
+func (s *memoryIdempotencyStore) Claim(ctx context.Context, deliveryID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if expiresAt, ok := s.claimed[deliveryID]; ok && now.Before(expiresAt) {
+		return false, nil
+	}
+
+	// Drop expired entries so a warm Lambda does not grow without bound
+	for id, expiresAt := range s.claimed {
+		if !now.Before(expiresAt) {
+			delete(s.claimed, id)
+		}
+	}
+
+	s.claimed[deliveryID] = now.Add(s.lease)
+	return true, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(ctx context.Context, deliveryID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.claimed[deliveryID] = s.now().Add(s.ttl)
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(ctx context.Context, deliveryID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.claimed, deliveryID)
+	return nil
+}
+
+// fileIdempotencyStore keeps one marker file per delivery ID in a directory,
+// relying on exclusive file creation to claim a delivery. The marker's
+// modification time is set to when the claim expires.
+type fileIdempotencyStore struct {
+	dir   string
+	lease time.Duration
+	ttl   time.Duration
+}
+
+func newFileIdempotencyStore(dir string, lease, ttl time.Duration) (*fileIdempotencyStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create idempotency directory: %w", err)
+	}
+	return &fileIdempotencyStore{dir: dir, lease: lease, ttl: ttl}, nil
+}
+
+func (s *fileIdempotencyStore) Claim(ctx context.Context, deliveryID string) (bool, error) {
+	path := s.path(deliveryID)
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		info, statErr := os.Stat(path)
+		if statErr != nil || time.Now().Before(info.ModTime()) {
+			return false, nil
+		}
+
+		// The marker has expired, reclaim it
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, fmt.Errorf("failed to remove expired delivery marker: %w", err)
+		}
+		return s.Claim(ctx, deliveryID)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to create delivery marker: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return false, fmt.Errorf("failed to create delivery marker: %w", err)
+	}
+	return true, s.expireAt(path, time.Now().Add(s.lease))
+}
+
+func (s *fileIdempotencyStore) Complete(ctx context.Context, deliveryID string) error {
+	return s.expireAt(s.path(deliveryID), time.Now().Add(s.ttl))
+}
+
+func (s *fileIdempotencyStore) expireAt(path string, expiresAt time.Time) error {
+	if err := os.Chtimes(path, expiresAt, expiresAt); err != nil {
+		return fmt.Errorf("failed to update delivery marker: %w", err)
+	}
+	return nil
+}
+
+func (s *fileIdempotencyStore) Release(ctx context.Context, deliveryID string) error {
+	if err := os.Remove(s.path(deliveryID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove delivery marker: %w", err)
+	}
+	return nil
+}
+
+func (s *fileIdempotencyStore) path(deliveryID string) string {
+	// Delivery IDs are GUIDs, but never let a header value escape the directory
+	return filepath.Join(s.dir, strings.NewReplacer("/", "_", "\\", "_", ".", "_").Replace(deliveryID))
+}
+
+// dynamoDBAPI is the subset of the DynamoDB client used by the stores
+type dynamoDBAPI interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+}
+
+// dynamoIdempotencyStore claims deliveries with a conditional put, keyed by
+// delivery_id and expired through the table's expires_at TTL attribute
+type dynamoIdempotencyStore struct {
+	client dynamoDBAPI
+	table  string
+	lease  time.Duration
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+func newDynamoIdempotencyStore(client dynamoDBAPI, table string, lease, ttl time.Duration) *dynamoIdempotencyStore {
+	return &dynamoIdempotencyStore{
+		client: client,
+		table:  table,
+		lease:  lease,
+		ttl:    ttl,
+		now:    time.Now,
+	}
+}
+
+func (s *dynamoIdempotencyStore) Claim(ctx context.Context, deliveryID string) (bool, error) {
+	now := s.now()
+
+	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item: map[string]types.AttributeValue{
+			"delivery_id": &types.AttributeValueMemberS{Value: deliveryID},
+			"status":      &types.AttributeValueMemberS{Value: "in_progress"},
+			"expires_at":  &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(s.lease).Unix(), 10)},
+		},
+		// DynamoDB TTL deletion is lazy, so treat expired items as absent
+		ConditionExpression: aws.String("attribute_not_exists(delivery_id) OR expires_at < :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+		},
+	})
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to record delivery: %w", err)
+	}
+	return true, nil
+}
+
+func (s *dynamoIdempotencyStore) Complete(ctx context.Context, deliveryID string) error {
+	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item: map[string]types.AttributeValue{
+			"delivery_id": &types.AttributeValueMemberS{Value: deliveryID},
+			"status":      &types.AttributeValueMemberS{Value: "completed"},
+			"expires_at":  &types.AttributeValueMemberN{Value: strconv.FormatInt(s.now().Add(s.ttl).Unix(), 10)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete delivery: %w", err)
+	}
+	return nil
+}
+
+func (s *dynamoIdempotencyStore) Release(ctx context.Context, deliveryID string) error {
+	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(s.table),
+		Key: map[string]types.AttributeValue{
+			"delivery_id": &types.AttributeValueMemberS{Value: deliveryID},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to release delivery: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestIdempotencyStores(t *testing.T) {
+	fileStore, err := newFileIdempotencyStore(t.TempDir(), time.Hour, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	stores := map[string]IdempotencyStore{
+		"memory":   newMemoryIdempotencyStore(time.Hour, time.Hour),
+		"file":     fileStore,
+		"dynamodb": newDynamoIdempotencyStore(newFakeDynamoDB(), "deliveries", time.Hour, time.Hour),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			claimed, err := store.Claim(ctx, "delivery-1")
+			if err != nil || !claimed {
+				t.Fatalf("first Claim() = %v, %v, want true, nil", claimed, err)
+			}
+
+			claimed, err = store.Claim(ctx, "delivery-1")
+			if err != nil || claimed {
+				t.Fatalf("duplicate Claim() = %v, %v, want false, nil", claimed, err)
+			}
+
+			claimed, err = store.Claim(ctx, "delivery-2")
+			if err != nil || !claimed {
+				t.Fatalf("other Claim() = %v, %v, want true, nil", claimed, err)
+			}
+
+			if err := store.Release(ctx, "delivery-1"); err != nil {
+				t.Fatalf("Release() error = %v", err)
+			}
+
+			claimed, err = store.Claim(ctx, "delivery-1")
+			if err != nil || !claimed {
+				t.Fatalf("Claim() after Release() = %v, %v, want true, nil", claimed, err)
+			}
+		})
+	}
+}
+
+func TestMemoryIdempotencyStoreExpiry(t *testing.T) {
+	store := newMemoryIdempotencyStore(time.Minute, time.Minute)
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	if claimed, _ := store.Claim(context.Background(), "delivery-1"); !claimed {
+		t.Fatal("expected first claim to succeed")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if claimed, _ := store.Claim(context.Background(), "delivery-1"); !claimed {
+		t.Error("expected claim to succeed once the previous one expired")
+	}
+}
+
+func TestIdempotencyLease(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	memoryStore := newMemoryIdempotencyStore(time.Minute, time.Hour)
+	memoryStore.now = clock
+	dynamoStore := newDynamoIdempotencyStore(newFakeDynamoDB(), "deliveries", time.Minute, time.Hour)
+	dynamoStore.now = clock
+	fileStore, err := newFileIdempotencyStore(t.TempDir(), time.Minute, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	stores := map[string]struct {
+		store IdempotencyStore
+		// expireLease moves the store past the lease of delivery-1
+		expireLease func()
+	}{
+		"memory":   {memoryStore, func() { now = now.Add(2 * time.Minute) }},
+		"dynamodb": {dynamoStore, func() { now = now.Add(2 * time.Minute) }},
+		"file": {fileStore, func() {
+			past := time.Now().Add(-time.Second)
+			os.Chtimes(fileStore.path("delivery-1"), past, past)
+		}},
+	}
+
+	for name, tt := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			// The first attempt timed out: claimed, never completed nor released
+			if claimed, err := tt.store.Claim(ctx, "delivery-1"); err != nil || !claimed {
+				t.Fatalf("first Claim() = %v, %v, want true, nil", claimed, err)
+			}
+			if claimed, _ := tt.store.Claim(ctx, "delivery-1"); claimed {
+				t.Fatal("Claim() during the lease succeeded, want the delivery in progress")
+			}
+
+			// The redelivery arrives once the lease expired
+			tt.expireLease()
+			if claimed, err := tt.store.Claim(ctx, "delivery-1"); err != nil || !claimed {
+				t.Fatalf("Claim() of the redelivery = %v, %v, want true, nil", claimed, err)
+			}
+
+			// Completed deliveries stay claimed past the lease
+			if err := tt.store.Complete(ctx, "delivery-1"); err != nil {
+				t.Fatalf("Complete() error = %v", err)
+			}
+			now = now.Add(2 * time.Minute)
+			if claimed, _ := tt.store.Claim(ctx, "delivery-1"); claimed {
+				t.Error("Claim() after Complete() succeeded, want a duplicate")
+			}
+		})
+	}
+}
+
+func TestFileIdempotencyStorePath(t *testing.T) {
+	dir := t.TempDir()
+	store, err := newFileIdempotencyStore(dir, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if claimed, err := store.Claim(context.Background(), "../../escape"); err != nil || !claimed {
+		t.Fatalf("Claim() = %v, %v, want true, nil", claimed, err)
+	}
+	if got, want := store.path("../../escape"), dir+"/______escape"; got != want {
+		t.Errorf("path() = %v, want %v", got, want)
+	}
+}
+
+// fakeDynamoDB emulates the conditional writes used by dynamoIdempotencyStore
+type fakeDynamoDB struct {
+	items map[string]map[string]types.AttributeValue
+}
+
+func newFakeDynamoDB() *fakeDynamoDB {
+	return &fakeDynamoDB{items: make(map[string]map[string]types.AttributeValue)}
+}
+
+func (f *fakeDynamoDB) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	key := params.Item["delivery_id"].(*types.AttributeValueMemberS).Value
+	if existing, ok := f.items[key]; ok && params.ConditionExpression != nil {
+		now := params.ExpressionAttributeValues[":now"].(*types.AttributeValueMemberN).Value
+		if existing["expires_at"].(*types.AttributeValueMemberN).Value >= now {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+	}
+	f.items[key] = params.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeDynamoDB) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	delete(f.items, params.Key["delivery_id"].(*types.AttributeValueMemberS).Value)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// InstallationRecord is what the App knows about one of its installations
+type InstallationRecord struct {
+	ID                  int64     `json:"id"`
+	Account             string    `json:"account"`
+	AccountType         string    `json:"account_type,omitempty"`
+	RepositorySelection string    `json:"repository_selection,omitempty"`
+	Suspended           bool      `json:"suspended"`
+	Repositories        []string  `json:"repositories"`
+	UpdatedAt           time.Time `json:"updated_at"`
+	// ScheduledRepositories are the repositories whose app config has
+	// schedules, the only ones the dispatch-schedules task reads the config of
+	ScheduledRepositories []string `json:"scheduled_repositories,omitempty"`
+	// SchedulesScannedAt is when every repository was last checked for schedules
+	SchedulesScannedAt time.Time `json:"schedules_scanned_at"`
+	// Version is the number of writes of the record, a Put only succeeds when
+	// the stored record still has the version the record was read with
+	Version int64 `json:"version"`
+}
+
+// maxInstallationUpdateAttempts bounds the retries of an update that raced another one
+const maxInstallationUpdateAttempts = 5
+
+// errInstallationConflict is returned by Put when the stored record changed since it was read
+var errInstallationConflict = errors.New("installation was updated concurrently")
+
+// HasRepository reports whether the installation can reach the repository
+func (r *InstallationRecord) HasRepository(fullName string) bool {
+	for _, repo := range r.Repositories {
+		if strings.EqualFold(repo, fullName) {
+			return true
+		}
+	}
+	return false
+}
+
+// InstallationRegistry persists the App installations and the repositories
+// they grant access to, kept up to date from installation webhooks
+type InstallationRegistry interface {
+	// Get returns the installation or nil if it is not registered
+	Get(ctx context.Context, id int64) (*InstallationRecord, error)
+	// Put stores the record and increments its version. It returns
+	// errInstallationConflict when the stored version is not record.Version.
+	Put(ctx context.Context, record *InstallationRecord) error
+	Delete(ctx context.Context, id int64) error
+	List(ctx context.Context) ([]*InstallationRecord, error)
+}
+
+// newInstallationRegistry builds the registry selected by the INSTALLATION_REGISTRY env var
+func newInstallationRegistry(cfg aws.Config) (InstallationRegistry, error) {
+	switch registry := os.Getenv("INSTALLATION_REGISTRY"); registry {
+	case "", "memory":
+		return newMemoryInstallationRegistry(), nil
+	case "file":
+		dir := os.Getenv("INSTALLATION_REGISTRY_DIR")
+		if dir == "" {
+			dir = filepath.Join(os.TempDir(), "github-app-installations")
+		}
+		return newFileInstallationRegistry(dir)
+	case "dynamodb":
+		table := os.Getenv("INSTALLATION_TABLE")
+		if table == "" {
+			return nil, fmt.Errorf("INSTALLATION_TABLE is required for the dynamodb registry")
+		}
+		return newDynamoInstallationRegistry(newDynamoDBClient(cfg), table), nil
+	default:
+		return nil, fmt.Errorf("unknown installation registry %q", registry)
+	}
+}
+
+// applyInstallationEvent updates the registry for an installation event and
+// returns the resulting record, nil once the installation is deleted
+func applyInstallationEvent(ctx context.Context, registry InstallationRegistry, event *InstallationEvent) (*InstallationRecord, error) {
+	id := event.Installation.ID
+
+	if event.Action == "deleted" {
+		return nil, registry.Delete(ctx, id)
+	}
+
+	return updateInstallation(ctx, registry, id, func(record *InstallationRecord) {
+		record.Account = event.Installation.Account.Login
+		record.AccountType = event.Installation.Account.Type
+		if event.Installation.RepositorySelection != "" {
+			record.RepositorySelection = event.Installation.RepositorySelection
+		}
+
+		switch event.Action {
+		case "created":
+			record.Suspended = false
+			record.Repositories = nil
+			for _, repo := range event.Repositories {
+				record.Repositories = append(record.Repositories, repo.FullName)
+			}
+		case "suspend":
+			record.Suspended = true
+		case "unsuspend":
+			record.Suspended = false
+		}
+	})
+}
+
+// applyInstallationRepositoriesEvent adds or removes the event's repositories
+// from the installation record
+func applyInstallationRepositoriesEvent(ctx context.Context, registry InstallationRegistry, event *InstallationRepositoriesEvent) (*InstallationRecord, error) {
+	return updateInstallation(ctx, registry, event.Installation.ID, func(record *InstallationRecord) {
+		if record.Account == "" {
+			// The installation predates the registry, start tracking it from here
+			record.Account = event.Installation.Account.Login
+			record.AccountType = event.Installation.Account.Type
+		}
+		if event.RepositorySelection != "" {
+			record.RepositorySelection = event.RepositorySelection
+		}
+
+		repos := make(map[string]bool, len(record.Repositories))
+		for _, repo := range record.Repositories {
+			repos[repo] = true
+		}
+		for _, repo := range event.RepositoriesAdded {
+			repos[repo.FullName] = true
+		}
+		for _, repo := range event.RepositoriesRemoved {
+			delete(repos, repo.FullName)
+			record.ScheduledRepositories = setRepository(record.ScheduledRepositories, repo.FullName, false)
+		}
+
+		record.Repositories = record.Repositories[:0]
+		for repo := range repos {
+			record.Repositories = append(record.Repositories, repo)
+		}
+		sort.Strings(record.Repositories)
+	})
+}
+
+// setRepository adds the repository to or removes it from a sorted list of repositories
+func setRepository(repos []string, fullName string, member bool) []string {
+	i, found := slices.BinarySearch(repos, fullName)
+	switch {
+	case member && !found:
+		return slices.Insert(repos, i, fullName)
+	case !member && found:
+		return slices.Delete(repos, i, i+1)
+	}
+	return repos
+}
+
+// updateInstallation applies update to the stored installation record, or to
+// a new one, and stores it. Updates racing another webhook are read and
+// applied again.
+func updateInstallation(ctx context.Context, registry InstallationRegistry, id int64, update func(record *InstallationRecord)) (*InstallationRecord, error) {
+	for attempt := 1; ; attempt++ {
+		record, err := registry.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if record == nil {
+			record = &InstallationRecord{ID: id}
+		}
+
+		update(record)
+		record.UpdatedAt = time.Now().UTC()
+
+		err = registry.Put(ctx, record)
+		if !errors.Is(err, errInstallationConflict) || attempt == maxInstallationUpdateAttempts {
+			return record, err
+		}
+	}
+}
+
+// memoryInstallationRegistry keeps installations for the lifetime of the process
+type memoryInstallationRegistry struct {
+	mu      sync.Mutex
+	records map[int64]InstallationRecord
+}
+
+func newMemoryInstallationRegistry() *memoryInstallationRegistry {
+	return &memoryInstallationRegistry{records: make(map[int64]InstallationRecord)}
+}
+
+func (r *memoryInstallationRegistry) Get(ctx context.Context, id int64) (*InstallationRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.records[id]
+	if !ok {
+		return nil, nil
+	}
+	record.Repositories = append([]string(nil), record.Repositories...)
+	record.ScheduledRepositories = append([]string(nil), record.ScheduledRepositories...)
+	return &record, nil
+}
+
+func (r *memoryInstallationRegistry) Put(ctx context.Context, record *InstallationRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.records[record.ID].Version != record.Version {
+		return errInstallationConflict
+	}
+	record.Version++
+	stored := *record
+	stored.Repositories = append([]string(nil), record.Repositories...)
+	stored.ScheduledRepositories = append([]string(nil), record.ScheduledRepositories...)
+	r.records[record.ID] = stored
+	return nil
+}
+
+func (r *memoryInstallationRegistry) Delete(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.records, id)
+	return nil
+}
+
+func (r *memoryInstallationRegistry) List(ctx context.Context) ([]*InstallationRecord, error) {
+	r.mu.Lock()
+	ids := make([]int64, 0, len(r.records))
+	for id := range r.records {
+		ids = append(ids, id)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	records := make([]*InstallationRecord, 0, len(ids))
+	for _, id := range ids {
+		if record, _ := r.Get(ctx, id); record != nil {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// fileInstallationRegistry keeps one JSON file per installation in a directory.
+// Versions are only checked within the process, it is meant for local runs.
+type fileInstallationRegistry struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func newFileInstallationRegistry(dir string) (*fileInstallationRegistry, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create installation registry directory: %w", err)
+	}
+	return &fileInstallationRegistry{dir: dir}, nil
+}
+
+func (r *fileInstallationRegistry) Get(ctx context.Context, id int64) (*InstallationRecord, error) {
+	data, err := os.ReadFile(r.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read installation: %w", err)
+	}
+
+	var record InstallationRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to decode installation: %w", err)
+	}
+	return &record, nil
+}
+
+func (r *fileInstallationRegistry) Put(ctx context.Context, record *InstallationRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, err := r.Get(ctx, record.ID)
+	if err != nil {
+		return err
+	}
+	if stored != nil && stored.Version != record.Version || stored == nil && record.Version != 0 {
+		return errInstallationConflict
+	}
+
+	next := *record
+	next.Version++
+	data, err := json.MarshalIndent(&next, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode installation: %w", err)
+	}
+
+	// Write then rename so readers never see a partial file
+	tmp := r.path(record.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write installation: %w", err)
+	}
+	if err := os.Rename(tmp, r.path(record.ID)); err != nil {
+		return fmt.Errorf("failed to write installation: %w", err)
+	}
+	record.Version = next.Version
+	return nil
+}
+
+func (r *fileInstallationRegistry) Delete(ctx context.Context, id int64) error {
+	if err := os.Remove(r.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete installation: %w", err)
+	}
+	return nil
+}
+
+func (r *fileInstallationRegistry) List(ctx context.Context) ([]*InstallationRecord, error) {
+	paths, err := filepath.Glob(filepath.Join(r.dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list installations: %w", err)
+	}
+
+	var records []*InstallationRecord
+	for _, path := range paths {
+		id, err := strconv.ParseInt(strings.TrimSuffix(filepath.Base(path), ".json"), 10, 64)
+		if err != nil {
+			continue
+		}
+		record, err := r.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if record != nil {
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	return records, nil
+}
+
+func (r *fileInstallationRegistry) path(id int64) string {
+	return filepath.Join(r.dir, strconv.FormatInt(id, 10)+".json")
+}
+
+// dynamoDBRegistryAPI is the subset of the DynamoDB client used by dynamoInstallationRegistry
+type dynamoDBRegistryAPI interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+}
+
+// dynamoInstallationRegistry stores each installation as a JSON document keyed
+// by installation_id, with its version in a version attribute for conditional writes
+type dynamoInstallationRegistry struct {
+	client dynamoDBRegistryAPI
+	table  string
+}
+
+func newDynamoInstallationRegistry(client dynamoDBRegistryAPI, table string) *dynamoInstallationRegistry {
+	return &dynamoInstallationRegistry{client: client, table: table}
+}
+
+func (r *dynamoInstallationRegistry) Get(ctx context.Context, id int64) (*InstallationRecord, error) {
+	output, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(r.table),
+		Key:            r.key(id),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get installation: %w", err)
+	}
+	if output.Item == nil {
+		return nil, nil
+	}
+	return decodeInstallationItem(output.Item)
+}
+
+func (r *dynamoInstallationRegistry) Put(ctx context.Context, record *InstallationRecord) error {
+	next := *record
+	next.Version++
+	data, err := json.Marshal(&next)
+	if err != nil {
+		return fmt.Errorf("failed to encode installation: %w", err)
+	}
+
+	item := r.key(record.ID)
+	item["record"] = &types.AttributeValueMemberS{Value: string(data)}
+	item["version"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(next.Version, 10)}
+
+	input := &dynamodb.PutItemInput{TableName: aws.String(r.table), Item: item}
+	if record.Version == 0 {
+		// Items written before versioning have no version attribute
+		input.ConditionExpression = aws.String("attribute_not_exists(installation_id) OR attribute_not_exists(version)")
+	} else {
+		input.ConditionExpression = aws.String("version = :version")
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":version": &types.AttributeValueMemberN{Value: strconv.FormatInt(record.Version, 10)},
+		}
+	}
+
+	_, err = r.client.PutItem(ctx, input)
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return errInstallationConflict
+	}
+	if err != nil {
+		return fmt.Errorf("failed to put installation: %w", err)
+	}
+	record.Version = next.Version
+	return nil
+}
+
+func (r *dynamoInstallationRegistry) Delete(ctx context.Context, id int64) error {
+	if _, err := r.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(r.table),
+		Key:       r.key(id),
+	}); err != nil {
+		return fmt.Errorf("failed to delete installation: %w", err)
+	}
+	return nil
+}
+
+func (r *dynamoInstallationRegistry) List(ctx context.Context) ([]*InstallationRecord, error) {
+	var records []*InstallationRecord
+	input := &dynamodb.ScanInput{TableName: aws.String(r.table)}
+	for {
+		output, err := r.client.Scan(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan installations: %w", err)
+		}
+		for _, item := range output.Items {
+			record, err := decodeInstallationItem(item)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, record)
+		}
+		if output.LastEvaluatedKey == nil {
+			break
+		}
+		input.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	return records, nil
+}
+
+func (r *dynamoInstallationRegistry) key(id int64) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"installation_id": &types.AttributeValueMemberN{Value: strconv.FormatInt(id, 10)},
+	}
+}
+
+func decodeInstallationItem(item map[string]types.AttributeValue) (*InstallationRecord, error) {
+	attr, ok := item["record"].(*types.AttributeValueMemberS)
+	if !ok {
+		return nil, fmt.Errorf("installation item has no record attribute")
+	}
+
+	var record InstallationRecord
+	if err := json.Unmarshal([]byte(attr.Value), &record); err != nil {
+		return nil, fmt.Errorf("failed to decode installation: %w", err)
+	}
+	return &record, nil
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestInstallationRegistryLifecycle(t *testing.T) {
+	fileRegistry, err := newFileInstallationRegistry(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	registries := map[string]InstallationRegistry{
+		"memory":   newMemoryInstallationRegistry(),
+		"file":     fileRegistry,
+		"dynamodb": newDynamoInstallationRegistry(newFakeRegistryDynamoDB(), "installations"),
+	}
+
+	installation := Installation{ID: 42, Account: User{Login: "my-org", Type: "Organization"}, RepositorySelection: "selected"}
+
+	for name, registry := range registries {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			created := &InstallationEvent{
+				WebhookPayload: WebhookPayload{Action: "created", Installation: installation},
+				Repositories:   []Repository{{FullName: "my-org/app"}, {FullName: "my-org/infra"}},
+			}
+			if _, err := applyInstallationEvent(ctx, registry, created); err != nil {
+				t.Fatalf("created: %v", err)
+			}
+			if _, err := updateInstallation(ctx, registry, 42, func(record *InstallationRecord) {
+				record.ScheduledRepositories = []string{"my-org/app", "my-org/infra"}
+			}); err != nil {
+				t.Fatalf("schedules: %v", err)
+			}
+
+			changed := &InstallationRepositoriesEvent{
+				WebhookPayload:      WebhookPayload{Action: "added", Installation: installation},
+				RepositoriesAdded:   []Repository{{FullName: "my-org/docs"}},
+				RepositoriesRemoved: []Repository{{FullName: "my-org/infra"}},
+			}
+			if _, err := applyInstallationRepositoriesEvent(ctx, registry, changed); err != nil {
+				t.Fatalf("repositories: %v", err)
+			}
+
+			suspended := &InstallationEvent{WebhookPayload: WebhookPayload{Action: "suspend", Installation: installation}}
+			if _, err := applyInstallationEvent(ctx, registry, suspended); err != nil {
+				t.Fatalf("suspend: %v", err)
+			}
+
+			record, err := registry.Get(ctx, 42)
+			if err != nil || record == nil {
+				t.Fatalf("Get() = %v, %v", record, err)
+			}
+			if want := []string{"my-org/app", "my-org/docs"}; !reflect.DeepEqual(record.Repositories, want) {
+				t.Errorf("Repositories = %v, want %v", record.Repositories, want)
+			}
+			if want := []string{"my-org/app"}; !reflect.DeepEqual(record.ScheduledRepositories, want) {
+				t.Errorf("ScheduledRepositories = %v, want %v", record.ScheduledRepositories, want)
+			}
+			if !record.Suspended || record.Account != "my-org" || record.AccountType != "Organization" {
+				t.Errorf("unexpected record %+v", record)
+			}
+			if !record.HasRepository("My-Org/App") {
+				t.Error("expected HasRepository to ignore case")
+			}
+
+			records, err := registry.List(ctx)
+			if err != nil || len(records) != 1 {
+				t.Fatalf("List() = %v, %v, want one record", records, err)
+			}
+
+			deleted := &InstallationEvent{WebhookPayload: WebhookPayload{Action: "deleted", Installation: installation}}
+			record, err = applyInstallationEvent(ctx, registry, deleted)
+			if err != nil || record != nil {
+				t.Fatalf("deleted = %v, %v, want nil, nil", record, err)
+			}
+			if record, _ := registry.Get(ctx, 42); record != nil {
+				t.Errorf("Get() after delete = %+v, want nil", record)
+			}
+		})
+	}
+}
+
+// racingInstallationRegistry applies another update right after the first
+// Get, as a concurrent webhook would
+type racingInstallationRegistry struct {
+	InstallationRegistry
+	race func()
+}
+
+func (r *racingInstallationRegistry) Get(ctx context.Context, id int64) (*InstallationRecord, error) {
+	record, err := r.InstallationRegistry.Get(ctx, id)
+	if r.race != nil {
+		race := r.race
+		r.race = nil
+		race()
+	}
+	return record, err
+}
+
+func TestConcurrentInstallationRepositoriesEvents(t *testing.T) {
+	fileRegistry, err := newFileInstallationRegistry(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	registries := map[string]InstallationRegistry{
+		"memory":   newMemoryInstallationRegistry(),
+		"file":     fileRegistry,
+		"dynamodb": newDynamoInstallationRegistry(newFakeRegistryDynamoDB(), "installations"),
+	}
+
+	added := func(repo string) *InstallationRepositoriesEvent {
+		return &InstallationRepositoriesEvent{
+			WebhookPayload:    WebhookPayload{Action: "added", Installation: Installation{ID: 42}},
+			RepositoriesAdded: []Repository{{FullName: repo}},
+		}
+	}
+
+	for name, registry := range registries {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if _, err := applyInstallationRepositoriesEvent(ctx, registry, added("my-org/app")); err != nil {
+				t.Fatalf("first event: %v", err)
+			}
+
+			racing := &racingInstallationRegistry{InstallationRegistry: registry}
+			racing.race = func() {
+				if _, err := applyInstallationRepositoriesEvent(ctx, registry, added("my-org/docs")); err != nil {
+					t.Errorf("concurrent event: %v", err)
+				}
+			}
+			if _, err := applyInstallationRepositoriesEvent(ctx, racing, added("my-org/infra")); err != nil {
+				t.Fatalf("racing event: %v", err)
+			}
+
+			record, err := registry.Get(ctx, 42)
+			if err != nil || record == nil {
+				t.Fatalf("Get() = %v, %v", record, err)
+			}
+			if want := []string{"my-org/app", "my-org/docs", "my-org/infra"}; !reflect.DeepEqual(record.Repositories, want) {
+				t.Errorf("Repositories = %v, want %v", record.Repositories, want)
+			}
+			if record.Version != 3 {
+				t.Errorf("Version = %d, want 3", record.Version)
+			}
+		})
+	}
+}
+
+func TestLifecycleEventResponses(t *testing.T) {
+	originalRegistry, originalAppID := installationRegistry, githubAppID
+	installationRegistry = newMemoryInstallationRegistry()
+	githubAppID = 1234
+	defer func() { installationRegistry, githubAppID = originalRegistry, originalAppID }()
+
+	tests := []struct {
+		name       string
+		event      string
+		hookHeader string
+		body       string
+		wantStatus int
+		wantState  string
+	}{
+		{
+			name:       "ping",
+			event:      "ping",
+			hookHeader: "99",
+			body:       `{"zen":"Keep it logically awesome.","hook_id":99,"hook":{"id":99,"type":"App","app_id":1234}}`,
+			wantStatus: 200,
+			wantState:  "pong",
+		},
+		{
+			name:       "ping for another app",
+			event:      "ping",
+			body:       `{"hook_id":99,"hook":{"id":99,"type":"App","app_id":5678}}`,
+			wantStatus: 400,
+			wantState:  "rejected",
+		},
+		{
+			name:       "ping with mismatched hook id",
+			event:      "ping",
+			hookHeader: "100",
+			body:       `{"hook_id":99,"hook":{"id":99,"type":"App","app_id":1234}}`,
+			wantStatus: 400,
+			wantState:  "rejected",
+		},
+		{
+			name:       "installation created",
+			event:      "installation",
+			body:       `{"action":"created","installation":{"id":7,"account":{"login":"my-org"}},"repositories":[{"full_name":"my-org/app"}]}`,
+			wantStatus: 200,
+			wantState:  "active",
+		},
+		{
+			name:       "installation suspended",
+			event:      "installation",
+			body:       `{"action":"suspend","installation":{"id":7,"account":{"login":"my-org"}}}`,
+			wantStatus: 200,
+			wantState:  "suspended",
+		},
+		{
+			name:       "installation deleted",
+			event:      "installation",
+			body:       `{"action":"deleted","installation":{"id":7,"account":{"login":"my-org"}}}`,
+			wantStatus: 200,
+			wantState:  "removed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := parseWebhookEvent(tt.event, []byte(tt.body))
+			if err != nil {
+				t.Fatalf("parseWebhookEvent() error = %v", err)
+			}
+			lifecycle, ok := event.(lifecycleEvent)
+			if !ok {
+				t.Fatalf("%T is not a lifecycle event", event)
+			}
+
+			headers := http.Header{}
+			if tt.hookHeader != "" {
+				headers.Set("X-GitHub-Hook-ID", tt.hookHeader)
+			}
+			resp := lifecycle.Handle(context.Background(), &WebhookRequest{Headers: headers, Body: []byte(tt.body)})
+
+			var body lifecycleResponse
+			if err := json.Unmarshal([]byte(resp.Body), &body); err != nil {
+				t.Fatalf("invalid response body %q: %v", resp.Body, err)
+			}
+			if resp.StatusCode != tt.wantStatus || body.Status != tt.wantState {
+				t.Errorf("Handle() = %d %q, want %d %q", resp.StatusCode, body.Status, tt.wantStatus, tt.wantState)
+			}
+		})
+	}
+}
+
+// fakeRegistryDynamoDB stores items keyed by installation_id for dynamoInstallationRegistry
+type fakeRegistryDynamoDB struct {
+	items map[string]map[string]types.AttributeValue
+}
+
+func newFakeRegistryDynamoDB() *fakeRegistryDynamoDB {
+	return &fakeRegistryDynamoDB{items: make(map[string]map[string]types.AttributeValue)}
+}
+
+func (f *fakeRegistryDynamoDB) id(key map[string]types.AttributeValue) string {
+	return key["installation_id"].(*types.AttributeValueMemberN).Value
+}
+
+func (f *fakeRegistryDynamoDB) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: f.items[f.id(params.Key)]}, nil
+}
+
+func (f *fakeRegistryDynamoDB) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	existing, exists := f.items[f.id(params.Item)]
+	version, versioned := existing["version"].(*types.AttributeValueMemberN)
+	switch {
+	case params.ConditionExpression == nil:
+	case *params.ConditionExpression == "version = :version":
+		if !versioned || version.Value != params.ExpressionAttributeValues[":version"].(*types.AttributeValueMemberN).Value {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+	case exists && versioned:
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	f.items[f.id(params.Item)] = params.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeRegistryDynamoDB) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	delete(f.items, f.id(params.Key))
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func (f *fakeRegistryDynamoDB) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	output := &dynamodb.ScanOutput{}
+	for _, item := range f.items {
+		output.Items = append(output.Items, item)
+	}
+	return output, nil
+}
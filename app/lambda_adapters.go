@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"go.uber.org/zap"
+)
+
+// lambdaHandler is the webhook Lambda entry point. It accepts every event shape
+// that can front the function (Function URL, API Gateway REST and HTTP APIs,
+// ALB), normalizes it into a WebhookRequest and answers in the matching shape.
+func lambdaHandler(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	var probe struct {
+		Version        string `json:"version"`
+		HTTPMethod     string `json:"httpMethod"`
+		RequestContext struct {
+			ELB *json.RawMessage `json:"elb"`
+		} `json:"requestContext"`
+	}
+	if err := json.Unmarshal(payload, &probe); err != nil {
+		return nil, fmt.Errorf("failed to decode lambda event: %w", err)
+	}
+
+	switch {
+	case probe.RequestContext.ELB != nil:
+		var request events.ALBTargetGroupRequest
+		if err := json.Unmarshal(payload, &request); err != nil {
+			return nil, fmt.Errorf("failed to decode ALB request: %w", err)
+		}
+		webhookRequest, err := newALBRequest(request)
+		return newALBResponse(request, handleLambdaRequest(ctx, webhookRequest, err)), nil
+
+	case probe.HTTPMethod != "":
+		// API Gateway REST APIs and HTTP APIs using payload format 1.0
+		var request events.APIGatewayProxyRequest
+		if err := json.Unmarshal(payload, &request); err != nil {
+			return nil, fmt.Errorf("failed to decode API Gateway request: %w", err)
+		}
+		webhookRequest, err := newAPIGatewayProxyRequest(request)
+		return newAPIGatewayProxyResponse(handleLambdaRequest(ctx, webhookRequest, err)), nil
+
+	case probe.Version == "2.0":
+		// Function URLs share the HTTP API payload format 2.0
+		var request events.APIGatewayV2HTTPRequest
+		if err := json.Unmarshal(payload, &request); err != nil {
+			return nil, fmt.Errorf("failed to decode HTTP API request: %w", err)
+		}
+		webhookRequest, err := newAPIGatewayV2HTTPRequest(request)
+		return newAPIGatewayV2HTTPResponse(handleLambdaRequest(ctx, webhookRequest, err)), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported lambda event shape")
+	}
+}
+
+// handleLambdaRequest runs an adapted request through the webhook pipeline,
+// rejecting requests whose body could not be decoded
+func handleLambdaRequest(ctx context.Context, request *WebhookRequest, err error) WebhookResponse {
+	if err != nil {
+		logger.Warn("failed to decode request body", zap.Error(err))
+		return WebhookResponse{
+			StatusCode: 400,
+			Body:       "Error: invalid body encoding",
+		}
+	}
+	return handleWebhook(ctx, request)
+}
+
+// newAPIGatewayV2HTTPRequest adapts an HTTP API (payload 2.0) or Function URL request
+func newAPIGatewayV2HTTPRequest(request events.APIGatewayV2HTTPRequest) (*WebhookRequest, error) {
+	body, err := decodeTransportBody(request.Body, request.IsBase64Encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebhookRequest{
+		RequestID: request.RequestContext.RequestID,
+		Method:    request.RequestContext.HTTP.Method,
+		Path:      request.RawPath,
+		SourceIP:  request.RequestContext.HTTP.SourceIP,
+		UserAgent: request.RequestContext.HTTP.UserAgent,
+		Headers:   normalizeHeaders(request.Headers, nil),
+		Body:      body,
+	}, nil
+}
+
+// newAPIGatewayProxyRequest adapts an API Gateway REST API (payload 1.0) request
+func newAPIGatewayProxyRequest(request events.APIGatewayProxyRequest) (*WebhookRequest, error) {
+	body, err := decodeTransportBody(request.Body, request.IsBase64Encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebhookRequest{
+		RequestID: request.RequestContext.RequestID,
+		Method:    request.HTTPMethod,
+		Path:      request.Path,
+		SourceIP:  request.RequestContext.Identity.SourceIP,
+		UserAgent: request.RequestContext.Identity.UserAgent,
+		Headers:   normalizeHeaders(request.Headers, request.MultiValueHeaders),
+		Body:      body,
+	}, nil
+}
+
+// newALBRequest adapts an ALB target group request
+func newALBRequest(request events.ALBTargetGroupRequest) (*WebhookRequest, error) {
+	headers := normalizeHeaders(request.Headers, request.MultiValueHeaders)
+	body, err := decodeTransportBody(request.Body, request.IsBase64Encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebhookRequest{
+		RequestID: headers.Get("X-Amzn-Trace-Id"),
+		Method:    request.HTTPMethod,
+		Path:      request.Path,
+		SourceIP:  headers.Get("X-Forwarded-For"),
+		UserAgent: headers.Get("User-Agent"),
+		Headers:   headers,
+		Body:      body,
+	}, nil
+}
+
+// normalizeHeaders merges single and multi value headers into an http.Header,
+// which canonicalizes names so lookups are case-insensitive whatever casing
+// the gateway forwarded
+func normalizeHeaders(single map[string]string, multi map[string][]string) http.Header {
+	headers := make(http.Header, len(single)+len(multi))
+	for name, values := range multi {
+		for _, value := range values {
+			headers.Add(name, value)
+		}
+	}
+	for name, value := range single {
+		if headers.Get(name) == "" {
+			headers.Set(name, value)
+		}
+	}
+	return headers
+}
+
+func newAPIGatewayV2HTTPResponse(response WebhookResponse) events.APIGatewayV2HTTPResponse {
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: response.StatusCode,
+		Headers:    map[string]string{"Content-Type": response.contentTypeHeader()},
+		Body:       response.Body,
+	}
+}
+
+func newAPIGatewayProxyResponse(response WebhookResponse) events.APIGatewayProxyResponse {
+	return events.APIGatewayProxyResponse{
+		StatusCode: response.StatusCode,
+		Headers:    map[string]string{"Content-Type": response.contentTypeHeader()},
+		Body:       response.Body,
+	}
+}
+
+// newALBResponse answers with multi value headers when the target group has
+// them enabled, as ALB rejects responses using the other form
+func newALBResponse(request events.ALBTargetGroupRequest, response WebhookResponse) events.ALBTargetGroupResponse {
+	albResponse := events.ALBTargetGroupResponse{
+		StatusCode:        response.StatusCode,
+		StatusDescription: fmt.Sprintf("%d %s", response.StatusCode, http.StatusText(response.StatusCode)),
+		Body:              response.Body,
+	}
+	if request.MultiValueHeaders != nil {
+		albResponse.MultiValueHeaders = map[string][]string{"Content-Type": {response.contentTypeHeader()}}
+	} else {
+		albResponse.Headers = map[string]string{"Content-Type": response.contentTypeHeader()}
+	}
+	return albResponse
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestLambdaHandlerEventShapes(t *testing.T) {
+	originalSecret := githubAppWebhookSecret
+	githubAppWebhookSecret = "test-secret"
+	defer func() { githubAppWebhookSecret = originalSecret }()
+
+	body := `{"zen":"Keep it logically awesome."}`
+	mac := hmac.New(sha256.New, []byte(githubAppWebhookSecret))
+	mac.Write([]byte(body))
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	quotedBody, _ := json.Marshal(body)
+
+	// Form encoded body, base64 encoded by a binary mode gateway
+	formBody := "payload=" + url.QueryEscape(body)
+	formMAC := hmac.New(sha256.New, []byte(githubAppWebhookSecret))
+	formMAC.Write([]byte(formBody))
+	formSignature := "sha256=" + hex.EncodeToString(formMAC.Sum(nil))
+	encodedFormBody := base64.StdEncoding.EncodeToString([]byte(formBody))
+
+	tests := []struct {
+		name   string
+		event  string
+		verify func(*testing.T, interface{})
+	}{
+		{
+			name: "function url",
+			event: `{
+				"version": "2.0",
+				"rawPath": "/",
+				"headers": {"x-github-event": "star", "x-hub-signature-256": "` + signature + `"},
+				"requestContext": {"requestId": "req-1", "http": {"method": "POST"}},
+				"body": ` + string(quotedBody) + `
+			}`,
+			verify: func(t *testing.T, response interface{}) {
+				r, ok := response.(events.APIGatewayV2HTTPResponse)
+				if !ok {
+					t.Fatalf("expected APIGatewayV2HTTPResponse, got %T", response)
+				}
+				if r.StatusCode != 200 || r.Body != "Event type not supported" {
+					t.Errorf("got %d %q", r.StatusCode, r.Body)
+				}
+			},
+		},
+		{
+			name: "api gateway rest api with mixed case headers",
+			event: `{
+				"httpMethod": "POST",
+				"path": "/webhook",
+				"headers": {"X-GitHub-Event": "star", "X-Hub-Signature-256": "` + signature + `"},
+				"multiValueHeaders": {"X-GitHub-Event": ["star"], "X-Hub-Signature-256": ["` + signature + `"]},
+				"requestContext": {"requestId": "req-2", "identity": {"sourceIp": "1.2.3.4"}},
+				"body": ` + string(quotedBody) + `
+			}`,
+			verify: func(t *testing.T, response interface{}) {
+				r, ok := response.(events.APIGatewayProxyResponse)
+				if !ok {
+					t.Fatalf("expected APIGatewayProxyResponse, got %T", response)
+				}
+				if r.StatusCode != 200 || r.Body != "Event type not supported" {
+					t.Errorf("got %d %q", r.StatusCode, r.Body)
+				}
+			},
+		},
+		{
+			name: "alb with multi value headers",
+			event: `{
+				"httpMethod": "POST",
+				"path": "/",
+				"multiValueHeaders": {"x-github-event": ["star"], "X-HUB-SIGNATURE-256": ["` + signature + `"]},
+				"requestContext": {"elb": {"targetGroupArn": "arn:aws:elasticloadbalancing:tg"}},
+				"body": ` + string(quotedBody) + `
+			}`,
+			verify: func(t *testing.T, response interface{}) {
+				r, ok := response.(events.ALBTargetGroupResponse)
+				if !ok {
+					t.Fatalf("expected ALBTargetGroupResponse, got %T", response)
+				}
+				if r.StatusCode != 200 || r.StatusDescription != "200 OK" {
+					t.Errorf("got %d %q", r.StatusCode, r.StatusDescription)
+				}
+				if r.MultiValueHeaders == nil || r.Headers != nil {
+					t.Error("expected multi value response headers")
+				}
+			},
+		},
+		{
+			name: "base64 form encoded body",
+			event: `{
+				"version": "2.0",
+				"rawPath": "/",
+				"headers": {
+					"content-type": "application/x-www-form-urlencoded",
+					"x-github-event": "star",
+					"x-hub-signature-256": "` + formSignature + `"
+				},
+				"requestContext": {"requestId": "req-3", "http": {"method": "POST"}},
+				"body": "` + encodedFormBody + `",
+				"isBase64Encoded": true
+			}`,
+			verify: func(t *testing.T, response interface{}) {
+				r := response.(events.APIGatewayV2HTTPResponse)
+				if r.StatusCode != 200 || r.Body != "Event type not supported" {
+					t.Errorf("got %d %q", r.StatusCode, r.Body)
+				}
+			},
+		},
+		{
+			name: "invalid base64 body",
+			event: `{
+				"httpMethod": "POST",
+				"path": "/",
+				"headers": {"x-github-event": "star", "x-hub-signature-256": "` + signature + `"},
+				"requestContext": {"requestId": "req-4"},
+				"body": "not base64!",
+				"isBase64Encoded": true
+			}`,
+			verify: func(t *testing.T, response interface{}) {
+				r := response.(events.APIGatewayProxyResponse)
+				if r.StatusCode != 400 || r.Body != "Error: invalid body encoding" {
+					t.Errorf("got %d %q", r.StatusCode, r.Body)
+				}
+			},
+		},
+		{
+			name: "alb with single value headers and bad signature",
+			event: `{
+				"httpMethod": "POST",
+				"path": "/",
+				"headers": {"x-github-event": "star", "x-hub-signature-256": "sha256=bad"},
+				"requestContext": {"elb": {"targetGroupArn": "arn:aws:elasticloadbalancing:tg"}},
+				"body": ` + string(quotedBody) + `
+			}`,
+			verify: func(t *testing.T, response interface{}) {
+				r, ok := response.(events.ALBTargetGroupResponse)
+				if !ok {
+					t.Fatalf("expected ALBTargetGroupResponse, got %T", response)
+				}
+				if r.StatusCode != 401 || r.StatusDescription != "401 Unauthorized" {
+					t.Errorf("got %d %q", r.StatusCode, r.StatusDescription)
+				}
+				if r.Headers == nil || r.MultiValueHeaders != nil {
+					t.Error("expected single value response headers")
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := lambdaHandler(context.Background(), json.RawMessage(tt.event))
+			if err != nil {
+				t.Fatalf("lambdaHandler() error = %v", err)
+			}
+			tt.verify(t, response)
+		})
+	}
+
+	t.Run("unknown shape", func(t *testing.T) {
+		if _, err := lambdaHandler(context.Background(), json.RawMessage(`{"detail-type":"Scheduled Event"}`)); err == nil {
+			t.Error("expected error for unsupported event shape")
+		}
+	})
+}
+
+func TestNormalizeHeaders(t *testing.T) {
+	headers := normalizeHeaders(
+		map[string]string{"x-github-event": "release", "X-GitHub-Delivery": "single"},
+		map[string][]string{"X-GITHUB-DELIVERY": {"multi"}},
+	)
+
+	if got := headers.Get("X-GitHub-Event"); got != "release" {
+		t.Errorf("X-GitHub-Event = %q, want release", got)
+	}
+	if got := headers.Get("x-github-delivery"); got != "multi" {
+		t.Errorf("X-GitHub-Delivery = %q, want multi value to take precedence", got)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+)
+
+// lifecycleEvent is implemented by events about the App itself (ping,
+// installation changes). They are handled directly instead of being routed
+// to the dispatch rules of a repository.
+type lifecycleEvent interface {
+	Event
+	Handle(ctx context.Context, req *WebhookRequest) WebhookResponse
+}
+
+// lifecycleResponse is the JSON response to a lifecycle event
+type lifecycleResponse struct {
+	DeliveryID string `json:"delivery_id,omitempty"`
+	Event      string `json:"event"`
+	Action     string `json:"action,omitempty"`
+	Status     string `json:"status"`
+	Message    string `json:"message,omitempty"`
+}
+
+func newLifecycleResponse(req *WebhookRequest, event Event, status, message string) lifecycleResponse {
+	return lifecycleResponse{
+		DeliveryID: req.Headers.Get("X-GitHub-Delivery"),
+		Event:      event.Name(),
+		Action:     event.Envelope().Action,
+		Status:     status,
+		Message:    message,
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const redactedValue = "[REDACTED]"
+
+// defaultRedactedFields are field names whose values are never logged. A
+// field matches when its name, ignoring case, '_' and '-', equals or ends
+// with one of them (e.g. webhookSecret, access_token).
+var defaultRedactedFields = []string{
+	"secret",
+	"secrets",
+	"token",
+	"password",
+	"privateKey",
+	"privateKeyPem",
+	"signature",
+	"authorization",
+	"credentials",
+}
+
+// defaultRedactedHeaders are headers whose values are masked when a header set is logged
+var defaultRedactedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Hub-Signature",
+	"X-Hub-Signature-256",
+	"X-Api-Key",
+}
+
+// defaultRedactedPatterns match token-looking strings anywhere in a logged string
+var defaultRedactedPatterns = []string{
+	`gh[pousr]_[A-Za-z0-9]{36,}`,                        // GitHub tokens
+	`github_pat_[A-Za-z0-9_]{22,}`,                      // GitHub fine-grained tokens
+	`v1\.[0-9a-f]{40}`,                                  // GitHub installation tokens (legacy format)
+	`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`, // JWTs
+	`sha(1|256)=[0-9a-fA-F]{40,64}`,                     // webhook signatures
+	`(?i)bearer\s+[A-Za-z0-9._~+/=-]+`,                  // bearer credentials
+	`AKIA[0-9A-Z]{16}`,                                  // AWS access key IDs
+	`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?(-----END [A-Z ]*PRIVATE KEY-----|$)`, // PEM private keys
+}
+
+// RedactionPolicy decides which logged values are masked
+type RedactionPolicy struct {
+	fields   []string
+	headers  map[string]bool
+	patterns []*regexp.Regexp
+}
+
+// newRedactionPolicy builds a policy from the defaults plus extra field
+// names, header names and regular expressions
+func newRedactionPolicy(fields, headers, patterns []string) (*RedactionPolicy, error) {
+	policy := &RedactionPolicy{headers: make(map[string]bool)}
+
+	for _, field := range append(append([]string{}, defaultRedactedFields...), fields...) {
+		policy.fields = append(policy.fields, normalizeFieldName(field))
+	}
+	for _, header := range append(append([]string{}, defaultRedactedHeaders...), headers...) {
+		policy.headers[http.CanonicalHeaderKey(header)] = true
+	}
+	for _, pattern := range append(append([]string{}, defaultRedactedPatterns...), patterns...) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+		}
+		policy.patterns = append(policy.patterns, re)
+	}
+
+	return policy, nil
+}
+
+// redactionPolicyFromEnv extends the default policy with the comma separated
+// REDACT_FIELDS and REDACT_HEADERS env vars and the newline separated
+// REDACT_PATTERNS (regular expressions may contain commas)
+func redactionPolicyFromEnv() (*RedactionPolicy, error) {
+	return newRedactionPolicy(
+		splitList(os.Getenv("REDACT_FIELDS"), ","),
+		splitList(os.Getenv("REDACT_HEADERS"), ","),
+		splitList(os.Getenv("REDACT_PATTERNS"), "\n"),
+	)
+}
+
+func normalizeFieldName(name string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(name))
+}
+
+// sensitiveField reports whether values logged under the key are masked
+func (p *RedactionPolicy) sensitiveField(key string) bool {
+	key = normalizeFieldName(key)
+	for _, field := range p.fields {
+		if strings.HasSuffix(key, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactString masks every token-looking substring
+func (p *RedactionPolicy) redactString(value string) string {
+	for _, re := range p.patterns {
+		value = re.ReplaceAllString(value, redactedValue)
+	}
+	return value
+}
+
+// redactHeaders returns a copy of the headers with sensitive values masked
+func (p *RedactionPolicy) redactHeaders(headers map[string][]string) http.Header {
+	redacted := make(http.Header, len(headers))
+	for name, values := range headers {
+		masked := make([]string, len(values))
+		for i, value := range values {
+			if p.headers[http.CanonicalHeaderKey(name)] {
+				masked[i] = redactedValue
+			} else {
+				masked[i] = p.redactString(value)
+			}
+		}
+		redacted[name] = masked
+	}
+	return redacted
+}
+
+// redactField masks a single zap field according to the policy
+func (p *RedactionPolicy) redactField(field zapcore.Field) zapcore.Field {
+	if field.Type != zapcore.SkipType && p.sensitiveField(field.Key) {
+		return zap.String(field.Key, redactedValue)
+	}
+
+	switch field.Type {
+	case zapcore.StringType:
+		field.String = p.redactString(field.String)
+	case zapcore.ErrorType:
+		if err, ok := field.Interface.(error); ok && err != nil {
+			return zap.String(field.Key, p.redactString(err.Error()))
+		}
+	case zapcore.StringerType:
+		if value, ok := field.Interface.(interface{ String() string }); ok {
+			return zap.String(field.Key, p.redactString(value.String()))
+		}
+	case zapcore.ReflectType:
+		switch value := field.Interface.(type) {
+		case http.Header:
+			return zap.Any(field.Key, p.redactHeaders(value))
+		case map[string][]string:
+			return zap.Any(field.Key, p.redactHeaders(value))
+		case map[string]string:
+			masked := make(map[string]string, len(value))
+			for key, v := range value {
+				if p.sensitiveField(key) || p.headers[http.CanonicalHeaderKey(key)] {
+					masked[key] = redactedValue
+				} else {
+					masked[key] = p.redactString(v)
+				}
+			}
+			return zap.Any(field.Key, masked)
+		}
+	}
+	return field
+}
+
+func (p *RedactionPolicy) redactFields(fields []zapcore.Field) []zapcore.Field {
+	redacted := make([]zapcore.Field, len(fields))
+	for i, field := range fields {
+		redacted[i] = p.redactField(field)
+	}
+	return redacted
+}
+
+// redactingCore applies a RedactionPolicy to every entry before it reaches the wrapped core
+type redactingCore struct {
+	zapcore.Core
+	policy *RedactionPolicy
+}
+
+func newRedactingCore(core zapcore.Core, policy *RedactionPolicy) zapcore.Core {
+	return &redactingCore{Core: core, policy: policy}
+}
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{Core: c.Core.With(c.policy.redactFields(fields)), policy: c.policy}
+}
+
+func (c *redactingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *redactingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message = c.policy.redactString(entry.Message)
+	return c.Core.Write(entry, c.policy.redactFields(fields))
+}
+
+// newLogger builds the production logger with the redaction policy applied,
+// at debug level when payload previews are enabled
+func newLogger(policy *RedactionPolicy, debug bool) (*zap.Logger, error) {
+	cfg := zap.NewProductionConfig()
+	if debug {
+		cfg.Level = zap.NewAtomicLevelAt(zap.DebugLevel)
+	}
+	return cfg.Build(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return newRedactingCore(core, policy)
+	}))
+}
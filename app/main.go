@@ -2,12 +2,11 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"flag"
 	"fmt"
 	"os"
 	"strconv"
 
-	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
@@ -17,8 +16,15 @@ import (
 var logger *zap.Logger
 
 func init() {
-	var err error
-	logger, err = zap.NewProduction()
+	// Payload previews may contain anything the sender put in the event, they
+	// are only logged where explicitly enabled
+	logPayloadPreviews, _ = strconv.ParseBool(os.Getenv("LOG_PAYLOAD_PREVIEWS"))
+
+	policy, err := redactionPolicyFromEnv()
+	if err != nil {
+		panic(fmt.Sprintf("failed to load log redaction policy: %v", err))
+	}
+	logger, err = newLogger(policy, logPayloadPreviews)
 	if err != nil {
 		panic(fmt.Sprintf("failed to initialize logger: %v", err))
 	}
@@ -29,8 +35,51 @@ func init() {
 		logger.Fatal("failed to load AWS config", zap.Error(err))
 	}
 
+	awsConfig = cfg
 	ssmClient = ssm.NewFromConfig(cfg)
 
+	idempotencyStore, err = newIdempotencyStore(cfg)
+	if err != nil {
+		logger.Fatal("failed to create idempotency store", zap.Error(err))
+	}
+
+	installationRegistry, err = newInstallationRegistry(cfg)
+	if err != nil {
+		logger.Fatal("failed to create installation registry", zap.Error(err))
+	}
+
+	deferredDispatchStore, err = newDeferredDispatchStore(cfg)
+	if err != nil {
+		logger.Fatal("failed to create deferred dispatch store", zap.Error(err))
+	}
+
+	processingMode = os.Getenv("PROCESSING_MODE")
+	switch processingMode {
+	case "":
+		processingMode = processingModeSync
+	case processingModeSync:
+	case processingModeAsync:
+		deliveryQueue, err = newDeliveryQueue(cfg)
+		if err != nil {
+			logger.Fatal("failed to create delivery queue", zap.Error(err))
+		}
+	default:
+		logger.Fatal("unknown processing mode", zap.String("mode", processingMode))
+	}
+
+	// Credentials can be passed directly for local runs, SSM takes precedence when configured
+	if value := os.Getenv("GITHUB_APP_ID"); value != "" {
+		if appID, err := strconv.ParseInt(value, 10, 64); err == nil {
+			githubAppID = appID
+		} else {
+			logger.Warn("failed to parse GITHUB_APP_ID", zap.Error(err))
+		}
+	}
+	githubAppPrivateKeyPem = os.Getenv("GITHUB_APP_PRIVATE_KEY")
+	githubAppWebhookSecret = os.Getenv("GITHUB_APP_WEBHOOK_SECRET")
+	githubAppPreviousWebhookSecrets = splitSecrets(os.Getenv("GITHUB_APP_WEBHOOK_SECRET_PREVIOUS"))
+	allowSHA1Signatures, _ = strconv.ParseBool(os.Getenv("ALLOW_SHA1_SIGNATURES"))
+
 	// Load GitHub App ID from SSM
 	ssmAppIDPath := os.Getenv("SSM_GITHUB_APP_ID")
 	if ssmAppIDPath != "" {
@@ -64,113 +113,49 @@ func init() {
 		} else {
 			githubAppWebhookSecret = value
 			logger.Info("Webhook secret loaded from SSM")
-			//Log the loaded webhook secret for debugging
-			logger.Info("webhook secret value (REMOVE THIS LOG!)",
-				zap.String("secret", githubAppWebhookSecret),
-				zap.Int("length", len(githubAppWebhookSecret)),
-			)
 		}
 	}
-}
 
-func handler(ctx context.Context, request events.LambdaFunctionURLRequest) (events.LambdaFunctionURLResponse, error) {
-	logger.Info("received request",
-		zap.String("requestId", request.RequestContext.RequestID),
-		zap.String("method", request.RequestContext.HTTP.Method),
-		zap.String("path", request.RawPath),
-		zap.String("sourceIp", request.RequestContext.HTTP.SourceIP),
-		zap.String("userAgent", request.RequestContext.HTTP.UserAgent),
-	)
-
-	// Debug: Log all headers to see what's actually in the request
-	logger.Info("request headers received",
-		zap.String("requestId", request.RequestContext.RequestID),
-		zap.Any("headers", request.Headers),
-	)
-
-	// Debug: Log body size and preview (first 500 chars)
-	bodyPreview := request.Body
-	if len(bodyPreview) > 500 {
-		bodyPreview = bodyPreview[:500] + "... (truncated)"
-	}
-	logger.Info("request body info",
-		zap.String("requestId", request.RequestContext.RequestID),
-		zap.Int("bodyLength", len(request.Body)),
-		zap.String("bodyPreview", bodyPreview),
-	)
-
-	// AWS Lambda Function URLs normalize headers to lowercase
-	signature := request.Headers["x-hub-signature-256"]
-	if signature == "" {
-		logger.Warn("missing x-hub-signature-256 header",
-			zap.Any("availableHeaders", request.Headers),
-		)
-		return events.LambdaFunctionURLResponse{
-			StatusCode: 400,
-			Body:       "Error: missing signature header",
-		}, nil
-	}
-
-	// Verify GitHub webhook signature
-	logger.Info("verifying signature", zap.String("signature", signature))
-	valid, err := verifyGitHubSignature([]byte(request.Body), signature)
-	if err != nil || !valid {
-		logger.Warn("invalid signature", zap.Error(err))
-		return events.LambdaFunctionURLResponse{
-			StatusCode: 401,
-			Body:       "Error: invalid signature",
-		}, nil
-	}
-
-	// Parse the webhook payload
-	var webhookPayload WebhookPayload
-	if err := json.Unmarshal([]byte(request.Body), &webhookPayload); err != nil {
-		logger.Error("failed to parse webhook payload", zap.Error(err))
-		return events.LambdaFunctionURLResponse{
-			StatusCode: 400,
-			Body:       "Error: invalid payload",
-		}, nil
-	}
-
-	// Validate event type before processing
-	eventType, err := determineEventType(&webhookPayload)
-	if err != nil {
-		logger.Warn("unsupported event type, skipping",
-			zap.Error(err),
-			zap.String("repo", webhookPayload.Repository.FullName),
-		)
-		return events.LambdaFunctionURLResponse{
-			StatusCode: 200,
-			Body:       "Event type not supported",
-		}, nil
-	}
-
-	logger.Info("webhook signature verified, processing event",
-		zap.String("event", eventType),
-		zap.String("repo", webhookPayload.Repository.FullName),
-	)
-
-	// Process the webhook and send repository dispatches
-	if err := processWebhook(ctx, &webhookPayload); err != nil {
-		logger.Error("failed to process webhook", zap.Error(err))
-		return events.LambdaFunctionURLResponse{
-			StatusCode: 500,
-			Body:       "Error: failed to process webhook",
-		}, nil
+	// Secrets replaced by a rotation, newline or comma separated
+	ssmPreviousWebhookSecretPath := os.Getenv("SSM_GITHUB_APP_WEBHOOK_SECRET_PREVIOUS")
+	if ssmPreviousWebhookSecretPath != "" {
+		if value, err := loadSSMParameter(ctx, ssmPreviousWebhookSecretPath); err != nil {
+			logger.Warn("failed to load previous webhook secrets from SSM", zap.Error(err))
+		} else {
+			githubAppPreviousWebhookSecrets = splitSecrets(value)
+			logger.Info("Previous webhook secrets loaded from SSM",
+				zap.Int("count", len(githubAppPreviousWebhookSecrets)),
+			)
+		}
 	}
-
-	logger.Info("webhook processed successfully",
-		zap.String("requestId", request.RequestContext.RequestID),
-	)
-
-	return events.LambdaFunctionURLResponse{
-		StatusCode: 200,
-		Body:       "Webhook received, verified, and processed",
-	}, nil
-
 }
 
 func main() {
 	defer logger.Sync()
-	lambda.Start(handler)
+
+	// The mode selects the entry point, the same binary serves every deployment
+	mode := flag.String("mode", os.Getenv("APP_MODE"), "entry point: webhook, consumer, server or scheduled")
+	addr := flag.String("addr", envOrDefault("LISTEN_ADDR", defaultListenAddr), "listen address in server mode")
+	task := flag.String("task", os.Getenv("SCHEDULED_TASK"), "task to run once in scheduled mode outside Lambda")
+	flag.Parse()
+
+	switch *mode {
+	case "", "webhook":
+		lambda.Start(lambdaHandler)
+	case "consumer":
+		lambda.Start(sqsHandler)
+	case "server":
+		if err := runHTTPServer(*addr); err != nil {
+			logger.Fatal("http server failed", zap.Error(err))
+		}
+	case "scheduled":
+		// Outside Lambda the task runs once, e.g. from cron or against a fake GitHub
+		if os.Getenv("AWS_LAMBDA_RUNTIME_API") != "" {
+			lambda.Start(scheduledHandler)
+		} else if err := runScheduledTask(context.Background(), *task); err != nil {
+			logger.Fatal("scheduled task failed", zap.Error(err))
+		}
+	default:
+		logger.Fatal("unknown app mode", zap.String("mode", *mode))
+	}
 }
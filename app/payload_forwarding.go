@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// maxClientPayloadSize caps the marshalled client_payload of dispatches that
+// forward the webhook body, with headroom below GitHub's limit of 65,535
+// characters. Bodies that do not fit are flagged with event._truncated and
+// only the forward pointers are sent.
+const maxClientPayloadSize = 60000
+
+// forwardedFields returns fields with the parts of the webhook body the
+// target forwards added as "event". Missing pointers are left out, the
+// same rule may route payloads of different shapes.
+func forwardedFields(target Target, event Event, fields map[string]interface{}) (map[string]interface{}, error) {
+	raw := event.Envelope().raw
+	if (!target.ForwardRaw && len(target.Forward) == 0) || len(raw) == 0 {
+		return fields, nil
+	}
+
+	forwarded := make(map[string]interface{}, len(fields)+1)
+	for key, value := range fields {
+		forwarded[key] = value
+	}
+
+	truncated := false
+	if target.ForwardRaw {
+		forwarded["event"] = raw
+		size, err := clientPayloadSize(event, forwarded)
+		if err != nil {
+			return nil, err
+		}
+		if size <= maxClientPayloadSize {
+			return forwarded, nil
+		}
+		logger.Warn("webhook body too large to forward",
+			zap.String("target", target.Repo),
+			zap.Int("size", size),
+		)
+		truncated = true
+	}
+
+	var body interface{}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return nil, fmt.Errorf("failed to parse webhook body: %w", err)
+	}
+	selected := map[string]interface{}{}
+	for _, pointer := range target.Forward {
+		tokens, err := parseJSONPointer(pointer)
+		if err != nil {
+			return nil, err
+		}
+		if value, ok := resolveJSONPointer(body, tokens); ok {
+			setJSONPath(selected, tokens, value)
+		}
+	}
+	if truncated {
+		// GitHub caps client_payload at 10 top-level properties, keep the flag inside event
+		selected["_truncated"] = true
+	}
+	forwarded["event"] = selected
+
+	size, err := clientPayloadSize(event, forwarded)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxClientPayloadSize {
+		return nil, fmt.Errorf("client_payload of %d bytes exceeds %d bytes, forward fewer fields", size, maxClientPayloadSize)
+	}
+	return forwarded, nil
+}
+
+// clientPayloadSize returns the size of the marshalled client_payload sent with fields
+func clientPayloadSize(event Event, fields map[string]interface{}) (int, error) {
+	payload, err := buildClientPayload(event, fields)
+	if err != nil {
+		return 0, err
+	}
+	return len(payload), nil
+}
+
+// parseJSONPointer splits an RFC 6901 JSON pointer into its unescaped tokens.
+// The whole document ("") is forwarded with forward-raw instead.
+func parseJSONPointer(pointer string) ([]string, error) {
+	if !strings.HasPrefix(pointer, "/") || pointer == "/" {
+		return nil, fmt.Errorf("invalid forward pointer %q: expected a path such as /alert/number", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// resolveJSONPointer returns the value at the pointer tokens of a decoded JSON document
+func resolveJSONPointer(document interface{}, tokens []string) (interface{}, bool) {
+	value := document
+	for _, token := range tokens {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			child, ok := node[token]
+			if !ok {
+				return nil, false
+			}
+			value = child
+		case []interface{}:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+			value = node[index]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// setJSONPath stores value under the nested objects named by tokens, so the
+// forwarded event keeps the shape of the webhook body. Array indexes become
+// object keys.
+func setJSONPath(object map[string]interface{}, tokens []string, value interface{}) {
+	for _, token := range tokens[:len(tokens)-1] {
+		child, ok := object[token].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			object[token] = child
+		}
+		object = child
+	}
+	object[tokens[len(tokens)-1]] = value
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestForwardedFields(t *testing.T) {
+	body := `{"action": "created", "alert": {"number": 3, "rule": {"id": "go/sql-injection", "severity": "error"}, "tags": ["security", "cwe-89"]}, "a/b": {"c~d": 1}, "repository": {"full_name": "my-org/app"}}`
+	event, err := parseWebhookEvent("code_scanning_alert", []byte(body))
+	if err != nil {
+		t.Fatalf("parseWebhookEvent() error = %v", err)
+	}
+	large := &GenericEvent{name: "code_scanning_alert"}
+	large.raw = []byte(`{"alert": {"number": 3}, "padding": "` + strings.Repeat("x", maxClientPayloadSize) + `"}`)
+
+	tests := []struct {
+		name    string
+		target  Target
+		event   Event
+		want    string
+		wantErr bool
+	}{
+		{"nothing forwarded", Target{}, event, `{"paths":["a"]}`, false},
+		{"pointers", Target{Forward: []string{"/alert/number", "/alert/rule/severity", "/alert/tags/1"}}, event, `{"event":{"alert":{"number":3,"rule":{"severity":"error"},"tags":{"1":"cwe-89"}}},"paths":["a"]}`, false},
+		{"escaped pointer", Target{Forward: []string{"/a~1b/c~0d"}}, event, `{"event":{"a/b":{"c~d":1}},"paths":["a"]}`, false},
+		{"missing pointer", Target{Forward: []string{"/alert/dismissed_by", "/alert/tags/5"}}, event, `{"event":{},"paths":["a"]}`, false},
+		{"invalid pointer", Target{Forward: []string{"alert/number"}}, event, "", true},
+		{"raw", Target{ForwardRaw: true}, event, "", false},
+		{"raw too large", Target{ForwardRaw: true, Forward: []string{"/alert/number"}}, large, `{"event":{"_truncated":true,"alert":{"number":3}},"paths":["a"]}`, false},
+		{"raw too large without pointers", Target{ForwardRaw: true}, large, `{"event":{"_truncated":true},"paths":["a"]}`, false},
+		{"pointers too large", Target{Forward: []string{"/padding"}}, large, "", true},
+		{"no body", Target{ForwardRaw: true}, &ReleaseEvent{}, `{"paths":["a"]}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := forwardedFields(tt.target, tt.event, map[string]interface{}{"paths": []string{"a"}})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("forwardedFields() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			got, _ := json.Marshal(fields)
+			if tt.target.ForwardRaw && tt.want == "" {
+				var decoded struct {
+					Event map[string]interface{} `json:"event"`
+				}
+				json.Unmarshal(got, &decoded)
+				if decoded.Event["action"] != "created" || decoded.Event["alert"] == nil {
+					t.Errorf("forwardedFields() = %s, want the whole body as event", got)
+				}
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("forwardedFields() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForwardedTagPushPayload(t *testing.T) {
+	// The body fits the cap on its own, not with the head commit message repeated in client_payload
+	message := strings.Repeat("m", 2000)
+	body := `{"ref": "refs/tags/v1.2.0", "before": "a", "after": "b", "pusher": {"name": "alice"}, "head_commit": {"id": "b", "message": "` + message + `"}, "repository": {"full_name": "my-org/app"}, "sender": {"login": "alice"}, "padding": "`
+	body += strings.Repeat("x", maxClientPayloadSize-len(body)-1000) + `"}`
+	event, err := parseWebhookEvent("push", []byte(body))
+	if err != nil {
+		t.Fatalf("parseWebhookEvent() error = %v", err)
+	}
+
+	fields, err := forwardedFields(Target{ForwardRaw: true, Forward: []string{"/head_commit/id"}}, event, nil)
+	if err != nil {
+		t.Fatalf("forwardedFields() error = %v", err)
+	}
+	payload, err := buildClientPayload(event, fields)
+	if err != nil {
+		t.Fatalf("buildClientPayload() error = %v", err)
+	}
+	if len(payload) > maxClientPayloadSize {
+		t.Errorf("client_payload is %d bytes, want at most %d", len(payload), maxClientPayloadSize)
+	}
+
+	var decoded map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		t.Fatalf("failed to decode client_payload: %v", err)
+	}
+	// GitHub rejects client_payloads with more than 10 top-level properties
+	if len(decoded) > 10 {
+		t.Errorf("client_payload has %d top-level properties, want at most 10", len(decoded))
+	}
+	if string(decoded["event"]) != `{"_truncated":true,"head_commit":{"id":"b"}}` {
+		t.Errorf("client_payload.event = %s", decoded["event"])
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultRedeliveryLookback    = time.Hour
+	defaultRedeliveryMax         = 25
+	defaultRedeliveryMaxAttempts = 3
+)
+
+// redeliveryOptions bounds a redelivery run
+type redeliveryOptions struct {
+	// Lookback is how far back failed deliveries are considered
+	Lookback time.Duration
+	// Max caps the number of redeliveries requested per run
+	Max int
+	// MaxAttempts stops redelivering a delivery once it was redelivered this many times
+	MaxAttempts int
+}
+
+// redeliveryOptionsFromEnv reads the REDELIVERY_* env vars
+func redeliveryOptionsFromEnv() (redeliveryOptions, error) {
+	opts := redeliveryOptions{
+		Lookback:    defaultRedeliveryLookback,
+		Max:         defaultRedeliveryMax,
+		MaxAttempts: defaultRedeliveryMaxAttempts,
+	}
+
+	if value := os.Getenv("REDELIVERY_LOOKBACK"); value != "" {
+		lookback, err := time.ParseDuration(value)
+		if err != nil {
+			return opts, fmt.Errorf("invalid REDELIVERY_LOOKBACK: %w", err)
+		}
+		opts.Lookback = lookback
+	}
+	if value := os.Getenv("REDELIVERY_MAX"); value != "" {
+		max, err := strconv.Atoi(value)
+		if err != nil {
+			return opts, fmt.Errorf("invalid REDELIVERY_MAX: %w", err)
+		}
+		opts.Max = max
+	}
+	if value := os.Getenv("REDELIVERY_MAX_ATTEMPTS"); value != "" {
+		attempts, err := strconv.Atoi(value)
+		if err != nil {
+			return opts, fmt.Errorf("invalid REDELIVERY_MAX_ATTEMPTS: %w", err)
+		}
+		opts.MaxAttempts = attempts
+	}
+	return opts, nil
+}
+
+// redeliverFailedDeliveries is the scheduled task requesting redelivery of
+// the App's webhook deliveries that failed within the lookback window
+func redeliverFailedDeliveries(ctx context.Context) error {
+	opts, err := redeliveryOptionsFromEnv()
+	if err != nil {
+		return err
+	}
+
+	client, err := createGitHubAppClient()
+	if err != nil {
+		return fmt.Errorf("failed to create GitHub app client: %w", err)
+	}
+
+	redelivered, err := redeliverFailed(ctx, client, opts, time.Now())
+	if err != nil {
+		return err
+	}
+
+	logger.Info("redelivery run complete", zap.Int("redelivered", redelivered))
+	return nil
+}
+
+// deliveryAttempts collects every attempt GitHub made for one delivery GUID
+type deliveryAttempts struct {
+	latest      *github.HookDelivery
+	succeeded   bool
+	redelivered int
+}
+
+// redeliverFailed lists the hook deliveries of the lookback window and
+// requests redelivery of each GUID whose attempts all failed. GUIDs that
+// already reached MaxAttempts redeliveries are left alone so a delivery
+// that keeps failing does not loop forever.
+func redeliverFailed(ctx context.Context, client *github.Client, opts redeliveryOptions, now time.Time) (int, error) {
+	since := now.Add(-opts.Lookback)
+	attempts := make(map[string]*deliveryAttempts)
+	var order []string
+
+	listOpts := &github.ListCursorOptions{PerPage: 100}
+	for {
+		deliveries, resp, err := client.Apps.ListHookDeliveries(ctx, listOpts)
+		if err != nil {
+			return 0, fmt.Errorf("failed to list hook deliveries: %w", err)
+		}
+
+		// Deliveries are listed newest first
+		reachedWindowStart := false
+		for _, delivery := range deliveries {
+			if delivery.DeliveredAt != nil && delivery.DeliveredAt.Before(since) {
+				reachedWindowStart = true
+				break
+			}
+
+			guid := delivery.GetGUID()
+			attempt, ok := attempts[guid]
+			if !ok {
+				attempt = &deliveryAttempts{latest: delivery}
+				attempts[guid] = attempt
+				order = append(order, guid)
+			}
+			if code := delivery.GetStatusCode(); code >= 200 && code < 300 {
+				attempt.succeeded = true
+			}
+			if delivery.GetRedelivery() {
+				attempt.redelivered++
+			}
+		}
+
+		if reachedWindowStart || resp.Cursor == "" {
+			break
+		}
+		listOpts.Cursor = resp.Cursor
+	}
+
+	redelivered := 0
+	for _, guid := range order {
+		attempt := attempts[guid]
+		if attempt.succeeded {
+			continue
+		}
+		if attempt.redelivered >= opts.MaxAttempts {
+			logger.Warn("delivery reached max redelivery attempts",
+				zap.String("guid", guid),
+				zap.Int("attempts", attempt.redelivered),
+			)
+			continue
+		}
+		if redelivered >= opts.Max {
+			logger.Warn("redelivery cap reached, remaining failures are left for the next run",
+				zap.Int("max", opts.Max),
+			)
+			break
+		}
+
+		if _, _, err := client.Apps.RedeliverHookDelivery(ctx, attempt.latest.GetID()); err != nil {
+			// GitHub answers 202 Accepted, which go-github reports as an AcceptedError
+			if _, ok := err.(*github.AcceptedError); !ok {
+				logger.Error("failed to request redelivery",
+					zap.Error(err),
+					zap.String("guid", guid),
+				)
+				continue
+			}
+		}
+
+		logger.Info("requested redelivery",
+			zap.String("guid", guid),
+			zap.Int64("deliveryId", attempt.latest.GetID()),
+			zap.String("event", attempt.latest.GetEvent()),
+			zap.Int("statusCode", attempt.latest.GetStatusCode()),
+		)
+		redelivered++
+	}
+
+	return redelivered, nil
+}
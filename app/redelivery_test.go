@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// fakeHookDeliveries serves the App hook deliveries API from a fixed list,
+// two deliveries per page, and records requested redeliveries
+type fakeHookDeliveries struct {
+	mu          sync.Mutex
+	deliveries  []map[string]interface{}
+	redelivered []string
+}
+
+func (f *fakeHookDeliveries) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var id int64
+	if _, err := fmt.Sscanf(r.URL.Path, "/app/hook/deliveries/%d/attempts", &id); err == nil && r.Method == http.MethodPost {
+		f.mu.Lock()
+		f.redelivered = append(f.redelivered, fmt.Sprint(id))
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{}`))
+		return
+	}
+
+	if r.URL.Path != "/app/hook/deliveries" {
+		http.NotFound(w, r)
+		return
+	}
+
+	start := 0
+	fmt.Sscanf(r.URL.Query().Get("cursor"), "%d", &start)
+	end := start + 2
+	if end < len(f.deliveries) {
+		next := url.URL{Path: "/app/hook/deliveries", RawQuery: fmt.Sprintf("cursor=%d", end)}
+		w.Header().Set("Link", fmt.Sprintf(`<http://%s%s>; rel="next"`, r.Host, next.String()))
+	} else {
+		end = len(f.deliveries)
+	}
+	json.NewEncoder(w).Encode(f.deliveries[start:end])
+}
+
+func TestRedeliverFailed(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	delivery := func(id int, guid string, statusCode int, redelivery bool, age time.Duration) map[string]interface{} {
+		return map[string]interface{}{
+			"id":           id,
+			"guid":         guid,
+			"status_code":  statusCode,
+			"redelivery":   redelivery,
+			"event":        "release",
+			"delivered_at": now.Add(-age).Format(time.RFC3339),
+		}
+	}
+
+	newFake := func() *fakeHookDeliveries {
+		return &fakeHookDeliveries{deliveries: []map[string]interface{}{
+			delivery(12, "recovered", 200, true, 1*time.Minute),
+			delivery(11, "failed", 502, false, 2*time.Minute),
+			delivery(10, "recovered", 500, false, 3*time.Minute),
+			delivery(9, "looping", 500, true, 4*time.Minute),
+			delivery(8, "looping", 500, true, 5*time.Minute),
+			delivery(7, "timeout", 0, false, 6*time.Minute),
+			delivery(6, "looping", 500, false, 7*time.Minute),
+			delivery(5, "too-old", 500, false, 2*time.Hour),
+			delivery(4, "too-old-2", 500, false, 3*time.Hour),
+		}}
+	}
+
+	tests := []struct {
+		name string
+		opts redeliveryOptions
+		want []string
+	}{
+		{
+			name: "redelivers failed deliveries in the window",
+			opts: redeliveryOptions{Lookback: time.Hour, Max: 10, MaxAttempts: 2},
+			want: []string{"11", "7"},
+		},
+		{
+			name: "respects the cap",
+			opts: redeliveryOptions{Lookback: time.Hour, Max: 1, MaxAttempts: 2},
+			want: []string{"11"},
+		},
+		{
+			name: "retries looping deliveries below max attempts",
+			opts: redeliveryOptions{Lookback: time.Hour, Max: 10, MaxAttempts: 3},
+			want: []string{"11", "9", "7"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFake()
+			server := httptest.NewServer(fake)
+			defer server.Close()
+
+			client := github.NewClient(nil)
+			client.BaseURL, _ = url.Parse(server.URL + "/")
+
+			redelivered, err := redeliverFailed(context.Background(), client, tt.opts, now)
+			if err != nil {
+				t.Fatalf("redeliverFailed() error = %v", err)
+			}
+
+			if redelivered != len(tt.want) || len(fake.redelivered) != len(tt.want) {
+				t.Fatalf("redelivered %v (%d), want %v", fake.redelivered, redelivered, tt.want)
+			}
+			for i := range tt.want {
+				if fake.redelivered[i] != tt.want[i] {
+					t.Errorf("redelivery %d = %v, want %v", i, fake.redelivered[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRunScheduledTaskUnknown(t *testing.T) {
+	if err := runScheduledTask(context.Background(), "nope"); err == nil {
+		t.Error("expected error for unknown task")
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// globPatterns caches compiled filter patterns, rules are evaluated for every delivery
+	globPatterns sync.Map
+	// tagPatterns caches compiled tag-pattern regular expressions
+	tagPatterns sync.Map
+)
+
+// globToRegexp translates a GitHub Actions filter pattern to an anchored regular expression:
+//
+//	"*"   any characters except /
+//	"**"  any characters
+//	"?"   zero or one of the preceding character, or any character but / when nothing precedes it
+//	"+"   one or more of the preceding character, or a literal + when nothing precedes it
+//	"[]"  one character of the listed range or set
+//	"\"   escapes the next character
+func globToRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	// atom is set while the last token written is a single character or set that ? and + can repeat
+	atom := false
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+			atom = false
+		case '?':
+			if atom {
+				b.WriteByte(c)
+			} else {
+				b.WriteString("[^/]")
+			}
+			atom = false
+		case '+':
+			if atom {
+				b.WriteByte(c)
+			} else {
+				b.WriteString(`\+`)
+			}
+			atom = false
+		case '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated character class in %q", pattern)
+			}
+			b.WriteString(pattern[i : i+end+1])
+			i += end
+			atom = true
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(pattern[i])))
+				atom = true
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+			atom = true
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// globMatch reports whether name matches the filter pattern. Invalid patterns never match.
+func globMatch(pattern, name string) bool {
+	cached, ok := globPatterns.Load(pattern)
+	if !ok {
+		re, err := globToRegexp(pattern)
+		if err != nil {
+			logger.Warn("invalid filter pattern", zap.String("pattern", pattern), zap.Error(err))
+		}
+		cached, _ = globPatterns.LoadOrStore(pattern, re)
+	}
+
+	re := cached.(*regexp.Regexp)
+	return re != nil && re.MatchString(name)
+}
+
+// matchGlobs reports whether name matches the patterns. As in GitHub Actions a
+// pattern starting with ! excludes names matched by earlier patterns, so the
+// last matching pattern wins.
+func matchGlobs(name string, patterns []string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		if negated, ok := strings.CutPrefix(pattern, "!"); ok {
+			if globMatch(negated, name) {
+				matched = false
+			}
+			continue
+		}
+		if globMatch(pattern, name) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// matchIncludeIgnore applies an include and an ignore filter, an empty filter does not restrict
+func matchIncludeIgnore(name string, include, ignore []string) bool {
+	if len(include) > 0 && !matchGlobs(name, include) {
+		return false
+	}
+	if len(ignore) > 0 && matchGlobs(name, ignore) {
+		return false
+	}
+	return true
+}
+
+// matchRefFilters applies the rule's branch and tag filters to a full git ref
+// with GitHub Actions semantics: when only branch filters are set tags never
+// match and the other way around, and without any filter every ref matches.
+func matchRefFilters(rule Rule, ref string) bool {
+	branchFilters := len(rule.Branches) > 0 || len(rule.BranchesIgnore) > 0
+	tagFilters := hasTagConditions(rule)
+
+	if branch, ok := strings.CutPrefix(ref, "refs/heads/"); ok {
+		if !branchFilters {
+			return !tagFilters
+		}
+		return matchIncludeIgnore(branch, rule.Branches, rule.BranchesIgnore)
+	}
+
+	if tag, ok := strings.CutPrefix(ref, "refs/tags/"); ok {
+		if !tagFilters {
+			return !branchFilters
+		}
+		return matchTagConditions(rule, tag)
+	}
+
+	return !branchFilters && !tagFilters
+}
+
+// hasTagConditions reports whether the rule restricts tag names
+func hasTagConditions(rule Rule) bool {
+	return len(rule.Tags) > 0 || len(rule.TagsIgnore) > 0 || rule.TagPattern != "" || rule.Semver != ""
+}
+
+// matchTagConditions applies the rule's tags, tags-ignore, tag-pattern and semver conditions to a tag name
+func matchTagConditions(rule Rule, tag string) bool {
+	if !matchIncludeIgnore(tag, rule.Tags, rule.TagsIgnore) {
+		return false
+	}
+	if rule.TagPattern != "" && !matchTagPattern(rule.TagPattern, tag) {
+		return false
+	}
+	if rule.Semver != "" && !matchSemverConstraint(rule, tag) {
+		return false
+	}
+	return true
+}
+
+// matchTagPattern matches the tag against a regular expression. Invalid expressions never match.
+func matchTagPattern(pattern, tag string) bool {
+	cached, ok := tagPatterns.Load(pattern)
+	if !ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			logger.Warn("invalid tag-pattern", zap.String("pattern", pattern), zap.Error(err))
+		}
+		cached, _ = tagPatterns.LoadOrStore(pattern, re)
+	}
+
+	re := cached.(*regexp.Regexp)
+	return re != nil && re.MatchString(tag)
+}
+
+// matchSemverConstraint checks the tag's semantic version against the rule's
+// semver range. Prereleases only match when their channel (rc for v2.0.0-rc.1)
+// is listed in prerelease-channels, and tags that are not semantic versions never match.
+func matchSemverConstraint(rule Rule, tag string) bool {
+	constraint, err := parseSemverConstraint(rule.Semver)
+	if err != nil {
+		logger.Warn("invalid semver constraint", zap.String("semver", rule.Semver), zap.Error(err))
+		return false
+	}
+
+	version, err := parseSemver(tag)
+	if err != nil {
+		return false
+	}
+
+	if channel := version.Channel(); channel != "" && !acceptsPrereleaseChannel(rule.PrereleaseChannels, channel) {
+		return false
+	}
+	return constraint.Matches(version)
+}
+
+func acceptsPrereleaseChannel(channels []string, channel string) bool {
+	for _, accepted := range channels {
+		if accepted == "*" || strings.EqualFold(accepted, channel) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package main
+
+import "testing"
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"main", "main", true},
+		{"main", "main2", false},
+		{"feature/*", "feature/login", true},
+		{"feature/*", "feature/login/form", false},
+		{"feature/**", "feature/login/form", true},
+		{"**", "any/thing", true},
+		{"*", "v1.0", true},
+		{"v[0-9].*", "v1.0", true},
+		{"v[0-9].*", "vx.0", false},
+		{"v2*", "v2", true},
+		{"v1.?", "v1.", true},
+		{"docs?", "doc", true},
+		{"docs?", "docss", false},
+		{"ver+", "verrr", true},
+		{"ver+", "ve", false},
+		{"releases/**-alpha", "releases/v1/beta-alpha", true},
+		{"release/**+", "release/v1+", true},
+		{"release/**+", "release/v1", false},
+		{"v*?", "v1", true},
+		{"v*?", "v", false},
+		{"v*?", "v1/2", false},
+		{"?", "a", true},
+		{"?", "", false},
+		{"?.x", "a.x", true},
+		{"+1", "+1", true},
+		{"ver?+", "vers+", false},
+		{`\*`, "*", true},
+		{`\*`, "a", false},
+		{"v1.0", "v1x0", false},
+		{"[broken", "[broken", false},
+	}
+
+	for _, tt := range tests {
+		if got := globMatch(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMatchGlobsNegation(t *testing.T) {
+	patterns := []string{"releases/**", "!releases/**-alpha", "releases/v1-alpha"}
+
+	tests := map[string]bool{
+		"releases/v2":       true,
+		"releases/v2-alpha": false,
+		"releases/v1-alpha": true,
+		"main":              false,
+	}
+	for name, want := range tests {
+		if got := matchGlobs(name, patterns); got != want {
+			t.Errorf("matchGlobs(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestMatchRefFilters(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		ref  string
+		want bool
+	}{
+		{"no filters branch", Rule{}, "refs/heads/main", true},
+		{"no filters tag", Rule{}, "refs/tags/v1.0.0", true},
+		{"branches match", Rule{Branches: []string{"main"}}, "refs/heads/main", true},
+		{"branches miss", Rule{Branches: []string{"main"}}, "refs/heads/dev", false},
+		{"branches only skips tags", Rule{Branches: []string{"main"}}, "refs/tags/v1.0.0", false},
+		{"branches-ignore", Rule{BranchesIgnore: []string{"dependabot/**"}}, "refs/heads/dependabot/npm/foo", false},
+		{"branches-ignore other branch", Rule{BranchesIgnore: []string{"dependabot/**"}}, "refs/heads/main", true},
+		{"branches-ignore skips tags", Rule{BranchesIgnore: []string{"dependabot/**"}}, "refs/tags/v1", false},
+		{"tags match", Rule{Tags: []string{"v*"}}, "refs/tags/v1.0.0", true},
+		{"tags only skips branches", Rule{Tags: []string{"v*"}}, "refs/heads/main", false},
+		{"tags-ignore", Rule{TagsIgnore: []string{"*-rc*"}}, "refs/tags/v1.0.0-rc1", false},
+		{"branches and tags tag", Rule{Branches: []string{"main"}, Tags: []string{"v*"}}, "refs/tags/v2", true},
+		{"branches and tags branch", Rule{Branches: []string{"main"}, Tags: []string{"v*"}}, "refs/heads/main", true},
+		{"other ref without filters", Rule{}, "refs/notes/commits", true},
+		{"other ref with filters", Rule{Branches: []string{"**"}}, "refs/notes/commits", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchRefFilters(tt.rule, tt.ref); got != tt.want {
+				t.Errorf("matchRefFilters() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchTagConditions(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		tag  string
+		want bool
+	}{
+		{"no conditions", Rule{}, "nightly-1", true},
+		{"glob", Rule{Tags: []string{"v*"}}, "v1.0.0", true},
+		{"glob miss", Rule{Tags: []string{"v*"}}, "nightly-1", false},
+		{"regex", Rule{TagPattern: `^v\d+\.\d+\.\d+$`}, "v1.2.3", true},
+		{"regex miss", Rule{TagPattern: `^v\d+\.\d+\.\d+$`}, "v1.2.3-rc.1", false},
+		{"invalid regex", Rule{TagPattern: `(`}, "v1.2.3", false},
+		{"semver", Rule{Semver: ">=2.0.0"}, "v2.1.0", true},
+		{"semver miss", Rule{Semver: ">=2.0.0"}, "v1.9.0", false},
+		{"semver not a version", Rule{Semver: ">=2.0.0"}, "nightly-1", false},
+		{"invalid semver", Rule{Semver: ">=two"}, "v2.1.0", false},
+		{"prerelease channel not listed", Rule{Semver: ">=2.0.0-0"}, "v2.0.0-rc.1", false},
+		{"prerelease channel listed", Rule{Semver: ">=2.0.0-0", PrereleaseChannels: []string{"rc"}}, "v2.0.0-rc.1", true},
+		{"other prerelease channel", Rule{Semver: ">=2.0.0-0", PrereleaseChannels: []string{"rc"}}, "v2.0.0-beta.1", false},
+		{"any prerelease channel", Rule{Semver: ">=2.0.0-0", PrereleaseChannels: []string{"*"}}, "v2.0.0-beta.1", true},
+		{"glob and semver", Rule{Tags: []string{"v*"}, Semver: "^2"}, "v2.3.0", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchTagConditions(tt.rule, tt.tag); got != tt.want {
+				t.Errorf("matchTagConditions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Tag conditions make a push rule ignore branches, as tag filters do
+	if matchRefFilters(Rule{Semver: ">=1.0.0"}, "refs/heads/main") {
+		t.Error("expected a semver rule not to match branch pushes")
+	}
+	if !matchRefFilters(Rule{Semver: ">=1.0.0"}, "refs/tags/v1.0.0") {
+		t.Error("expected a semver rule to match a tag push")
+	}
+}
@@ -3,8 +3,11 @@ package main
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"strings"
+	"time"
 
+	"github.com/go-viper/mapstructure/v2"
 	"github.com/google/go-github/v57/github"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
@@ -14,6 +17,29 @@ const (
 	configFilePath = ".github/app-config.yaml"
 )
 
+// appConfigDecodeHook extends viper's default decode hooks so unquoted YAML
+// dates such as freeze window bounds decode into string fields
+var appConfigDecodeHook = viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+	mapstructure.StringToTimeDurationHookFunc(),
+	mapstructure.StringToSliceHookFunc(","),
+	timeToStringHook,
+))
+
+func timeToStringHook(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	t, ok := data.(time.Time)
+	if !ok || to.Kind() != reflect.String {
+		return data, nil
+	}
+	// YAML timestamps without an offset are UTC, keep them local to the freeze window's time zone
+	if t.Location() == time.UTC {
+		if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0 {
+			return t.Format("2006-01-02"), nil
+		}
+		return t.Format("2006-01-02T15:04:05"), nil
+	}
+	return t.Format(time.RFC3339), nil
+}
+
 func loadAppConfig(ctx context.Context, client *github.Client, owner, repo string) (*AppConfig, error) {
 	logger.Info("loading app config",
 		zap.String("owner", owner),
@@ -51,12 +77,13 @@ func loadAppConfig(ctx context.Context, client *github.Client, owner, repo strin
 	}
 
 	var config AppConfig
-	if err := v.Unmarshal(&config); err != nil {
+	if err := v.Unmarshal(&config, appConfigDecodeHook); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
 	logger.Info("app config loaded successfully",
 		zap.Int("dispatches_count", len(config.Dispatches)),
+		zap.Int("schedules_count", len(config.Schedules)),
 	)
 
 	// Debug log each dispatch rule
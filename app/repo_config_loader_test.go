@@ -67,6 +67,252 @@ dispatches:
 				}
 			},
 		},
+		{
+			name: "push ref filters",
+			yaml: `
+dispatches:
+  - event: push
+    branches: [main, "releases/**"]
+    branches-ignore: ["releases/**-alpha"]
+    tags-ignore: ["*"]
+    targets:
+      - repo: repo1
+        event_type: build
+`,
+			wantErr: false,
+			verify: func(t *testing.T, config *AppConfig) {
+				rule := config.Dispatches[0]
+				if len(rule.Branches) != 2 || rule.Branches[1] != "releases/**" {
+					t.Errorf("branches = %v", rule.Branches)
+				}
+				if len(rule.BranchesIgnore) != 1 || len(rule.TagsIgnore) != 1 || len(rule.Tags) != 0 {
+					t.Errorf("branches-ignore = %v, tags = %v, tags-ignore = %v", rule.BranchesIgnore, rule.Tags, rule.TagsIgnore)
+				}
+			},
+		},
+		{
+			name: "pull request filters",
+			yaml: `
+dispatches:
+  - event: pull_request
+    types: [closed]
+    branches: [main]
+    head-branches-ignore: ["dependabot/**"]
+    merged: true
+    labels: [deploy]
+    targets:
+      - repo: repo1
+        event_type: merged
+`,
+			wantErr: false,
+			verify: func(t *testing.T, config *AppConfig) {
+				rule := config.Dispatches[0]
+				if len(rule.Types) != 1 || rule.Types[0] != "closed" {
+					t.Errorf("types = %v", rule.Types)
+				}
+				if rule.Merged == nil || !*rule.Merged {
+					t.Errorf("merged = %v, want true", rule.Merged)
+				}
+				if rule.Draft != nil {
+					t.Errorf("draft = %v, want unset", *rule.Draft)
+				}
+				if len(rule.HeadBranchesIgnore) != 1 || len(rule.Labels) != 1 {
+					t.Errorf("head-branches-ignore = %v, labels = %v", rule.HeadBranchesIgnore, rule.Labels)
+				}
+			},
+		},
+		{
+			name: "workflow run filters",
+			yaml: `
+dispatches:
+  - event: workflow_run
+    workflows: [build]
+    conclusions: success
+    branches: [main]
+    targets:
+      - repo: repo1
+        event_type: build-succeeded
+`,
+			wantErr: false,
+			verify: func(t *testing.T, config *AppConfig) {
+				rule := config.Dispatches[0]
+				if len(rule.Workflows) != 1 || rule.Workflows[0] != "build" {
+					t.Errorf("workflows = %v", rule.Workflows)
+				}
+				if len(rule.Conclusions) != 1 || rule.Conclusions[0] != "success" {
+					t.Errorf("conclusions = %v, want [success]", rule.Conclusions)
+				}
+			},
+		},
+		{
+			name: "sender policies",
+			yaml: `
+dispatches:
+  - event: release
+    senders:
+      ignore-bots: true
+      deny: [mallory]
+    targets:
+      - repo: prod
+        event_type: deploy
+        senders:
+          teams: [my-org/release-managers]
+      - repo: staging
+        event_type: deploy
+`,
+			wantErr: false,
+			verify: func(t *testing.T, config *AppConfig) {
+				rule := config.Dispatches[0]
+				if rule.Senders == nil || !rule.Senders.IgnoreBots || len(rule.Senders.Deny) != 1 {
+					t.Errorf("rule senders = %+v", rule.Senders)
+				}
+				if prod := rule.Targets[0].Senders; prod == nil || len(prod.Teams) != 1 || prod.Teams[0] != "my-org/release-managers" {
+					t.Errorf("prod senders = %+v", prod)
+				}
+				if rule.Targets[1].Senders != nil {
+					t.Errorf("staging senders = %+v, want unset", rule.Targets[1].Senders)
+				}
+			},
+		},
+		{
+			name: "create rule with teardown",
+			yaml: `
+dispatches:
+  - event: create
+    ref-types: [branch]
+    branches: ["feature/**"]
+    targets:
+      - repo: previews
+        event_type: preview-create
+        teardown-event-type: preview-teardown
+`,
+			wantErr: false,
+			verify: func(t *testing.T, config *AppConfig) {
+				rule := config.Dispatches[0]
+				if len(rule.RefTypes) != 1 || rule.RefTypes[0] != "branch" {
+					t.Errorf("ref-types = %v, want [branch]", rule.RefTypes)
+				}
+				if rule.Targets[0].TeardownEventType != "preview-teardown" {
+					t.Errorf("teardown-event-type = %q", rule.Targets[0].TeardownEventType)
+				}
+			},
+		},
+		{
+			name: "deployment status rule",
+			yaml: `
+dispatches:
+  - event: deployment_status
+    environments: staging
+    states: [success]
+    targets:
+      - repo: smoke-tests
+        event_type: staging-deployed
+`,
+			wantErr: false,
+			verify: func(t *testing.T, config *AppConfig) {
+				rule := config.Dispatches[0]
+				if len(rule.Environments) != 1 || rule.Environments[0] != "staging" {
+					t.Errorf("environments = %v, want [staging]", rule.Environments)
+				}
+				if len(rule.States) != 1 || rule.States[0] != "success" {
+					t.Errorf("states = %v, want [success]", rule.States)
+				}
+			},
+		},
+		{
+			name: "freeze windows",
+			yaml: `
+dispatches:
+  - event: push
+    targets:
+      - repo: prod
+        event_type: deploy
+freezes:
+  - name: holidays
+    from: 2025-12-20
+    to: 2026-01-02
+    timezone: Europe/Berlin
+    mode: defer
+  - name: fridays
+    cron: "* 12-23 * * FRI"
+    targets: prod
+freeze-override:
+  labels: [emergency]
+  keywords: ["[hotfix]"]
+`,
+			wantErr: false,
+			verify: func(t *testing.T, config *AppConfig) {
+				if len(config.Freezes) != 2 {
+					t.Fatalf("expected 2 freezes, got %d", len(config.Freezes))
+				}
+				holidays := config.Freezes[0]
+				if holidays.From != "2025-12-20" || holidays.To != "2026-01-02" || holidays.Mode != "defer" {
+					t.Errorf("holidays = %+v", holidays)
+				}
+				if _, err := compileFreezeWindow(holidays); err != nil {
+					t.Errorf("compileFreezeWindow() error = %v", err)
+				}
+				if fridays := config.Freezes[1]; len(fridays.Targets) != 1 || fridays.Targets[0] != "prod" {
+					t.Errorf("fridays = %+v", fridays)
+				}
+				if config.FreezeOverride == nil || config.FreezeOverride.Keywords[0] != "[hotfix]" {
+					t.Errorf("freeze override = %+v", config.FreezeOverride)
+				}
+			},
+		},
+		{
+			name: "schedules",
+			yaml: `
+schedules:
+  - name: nightly
+    cron: "0 2 * * *"
+    timezone: Europe/Berlin
+    targets:
+      - repo: e2e-tests
+        event_type: nightly
+`,
+			wantErr: false,
+			verify: func(t *testing.T, config *AppConfig) {
+				if len(config.Schedules) != 1 {
+					t.Fatalf("expected 1 schedule, got %d", len(config.Schedules))
+				}
+				schedule := config.Schedules[0]
+				if schedule.Name != "nightly" || schedule.Cron != "0 2 * * *" || schedule.Timezone != "Europe/Berlin" {
+					t.Errorf("schedule = %+v", schedule)
+				}
+				if len(schedule.Targets) != 1 || schedule.Targets[0].EventType != "nightly" {
+					t.Errorf("schedule targets = %+v", schedule.Targets)
+				}
+			},
+		},
+		{
+			name: "passthrough rule with forwarding",
+			yaml: `
+dispatches:
+  - event: code_scanning_alert
+    types: [created]
+    targets:
+      - repo: security
+        event_type: alert
+        forward: ["/alert/number", "/alert/rule/severity"]
+      - repo: audit
+        event_type: alert
+        forward-raw: true
+`,
+			wantErr: false,
+			verify: func(t *testing.T, config *AppConfig) {
+				rule := config.Dispatches[0]
+				if len(rule.Types) != 1 || rule.Types[0] != "created" {
+					t.Errorf("types = %v, want [created]", rule.Types)
+				}
+				if forward := rule.Targets[0].Forward; len(forward) != 2 || forward[1] != "/alert/rule/severity" {
+					t.Errorf("forward = %v", forward)
+				}
+				if !rule.Targets[1].ForwardRaw {
+					t.Error("forward-raw = false, want true")
+				}
+			},
+		},
 		{
 			name: "empty config",
 			yaml: `
@@ -116,7 +362,7 @@ other_key: value
 			}
 
 			var config AppConfig
-			err = v.Unmarshal(&config)
+			err = v.Unmarshal(&config, appConfigDecodeHook)
 			if err != nil {
 				t.Fatalf("unexpected error unmarshaling config: %v", err)
 			}
@@ -145,7 +391,7 @@ dispatches:
 		}
 
 		var config AppConfig
-		err = v.Unmarshal(&config)
+		err = v.Unmarshal(&config, appConfigDecodeHook)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -171,7 +417,7 @@ dispatches:
 		}
 
 		var config AppConfig
-		err = v.Unmarshal(&config)
+		err = v.Unmarshal(&config, appConfigDecodeHook)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
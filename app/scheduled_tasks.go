@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// ScheduledTaskEvent is the constant input EventBridge schedules invoke the
+// scheduled Lambda with
+type ScheduledTaskEvent struct {
+	Task string `json:"task"`
+}
+
+// scheduledTasks maps task names to the work they run
+var scheduledTasks = map[string]func(context.Context) error{
+	"redeliver":          redeliverFailedDeliveries,
+	"send-deferred":      sendDeferredDispatches,
+	"dispatch-schedules": dispatchSchedules,
+}
+
+// runScheduledTask runs the named task once
+func runScheduledTask(ctx context.Context, name string) error {
+	task, ok := scheduledTasks[name]
+	if !ok {
+		return fmt.Errorf("unknown scheduled task %q", name)
+	}
+
+	logger.Info("running scheduled task", zap.String("task", name))
+	if err := task(ctx); err != nil {
+		return fmt.Errorf("scheduled task %s failed: %w", name, err)
+	}
+	return nil
+}
+
+// scheduledHandler is the Lambda entry point for EventBridge scheduled rules
+func scheduledHandler(ctx context.Context, event ScheduledTaskEvent) error {
+	return runScheduledTask(ctx, event.Task)
+}
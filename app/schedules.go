@@ -0,0 +1,504 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultScheduleInterval is how often schedules are evaluated, it must match
+	// the EventBridge schedule of the dispatch-schedules task
+	defaultScheduleInterval = 5 * time.Minute
+
+	// scheduleRescanInterval is how often every repository of an installation
+	// is checked for schedules, pushes changing the app config update the
+	// installation registry in between
+	scheduleRescanInterval = 24 * time.Hour
+)
+
+// Schedule sends repository dispatches to its targets on a cron schedule,
+// without a GitHub event
+type Schedule struct {
+	Name string `yaml:"name" mapstructure:"name"`
+	// Cron is a five field cron expression evaluated in Timezone, UTC by default
+	Cron     string   `yaml:"cron" mapstructure:"cron"`
+	Timezone string   `yaml:"timezone" mapstructure:"timezone"`
+	Targets  []Target `yaml:"targets" mapstructure:"targets"`
+}
+
+// ScheduleEvent is the synthetic source event of the dispatches sent for a
+// schedule. It is never received as a webhook.
+type ScheduleEvent struct {
+	WebhookPayload
+	Schedule    Schedule
+	ScheduledAt time.Time
+	// Latest holds the client_payload fields of the latest release or tag
+	Latest map[string]interface{}
+}
+
+func (e *ScheduleEvent) Name() string { return "schedule" }
+
+func (e *ScheduleEvent) ClientPayload() map[string]interface{} {
+	payload := map[string]interface{}{
+		"schedule": map[string]interface{}{
+			"name":         e.Schedule.Name,
+			"cron":         e.Schedule.Cron,
+			"scheduled_at": e.ScheduledAt.UTC().Format(time.RFC3339),
+		},
+	}
+	for key, value := range e.Latest {
+		payload[key] = value
+	}
+	return payload
+}
+
+// dueAt returns the minute in (now-interval, now] at which the schedule fires,
+// or the zero time when it does not fire in the interval. Schedules firing
+// more often than the interval run once per interval.
+func (s Schedule) dueAt(now time.Time, interval time.Duration) (time.Time, error) {
+	cron, err := parseCron(s.Cron)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	location := time.UTC
+	if s.Timezone != "" {
+		if location, err = time.LoadLocation(s.Timezone); err != nil {
+			return time.Time{}, fmt.Errorf("invalid timezone %q: %w", s.Timezone, err)
+		}
+	}
+
+	now = now.Truncate(time.Minute).In(location)
+	next := cron.Next(now.Add(-interval))
+	if next.IsZero() || next.After(now) {
+		return time.Time{}, nil
+	}
+	return next, nil
+}
+
+// scheduleIntervalFromEnv reads the SCHEDULE_INTERVAL env var
+func scheduleIntervalFromEnv() (time.Duration, error) {
+	value := os.Getenv("SCHEDULE_INTERVAL")
+	if value == "" {
+		return defaultScheduleInterval, nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval < time.Minute || interval%time.Minute != 0 {
+		return 0, fmt.Errorf("invalid SCHEDULE_INTERVAL %q: expected whole minutes", value)
+	}
+	return interval, nil
+}
+
+// dispatchSchedules is the scheduled task sending the dispatches of the
+// schedules due in the current interval, across every installation of the App
+func dispatchSchedules(ctx context.Context) error {
+	interval, err := scheduleIntervalFromEnv()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	appClient, err := createGitHubAppClient()
+	if err != nil {
+		return fmt.Errorf("failed to create GitHub app client: %w", err)
+	}
+	installations, err := listAppInstallations(ctx, appClient)
+	if err != nil {
+		return err
+	}
+
+	sent := 0
+	var failures []string
+	for _, installation := range installations {
+		if installation.SuspendedAt != nil {
+			continue
+		}
+
+		client, err := createGitHubClient(installation.GetID())
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("installation %d: %v", installation.GetID(), err))
+			continue
+		}
+		n, errs := dispatchInstallationSchedules(ctx, client, installation, now, interval)
+		sent += n
+		failures = append(failures, errs...)
+	}
+
+	logger.Info("schedule run complete", zap.Int("sent", sent), zap.Int("failed", len(failures)))
+	if len(failures) > 0 {
+		return fmt.Errorf("%d repositories failed: %s", len(failures), strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// dispatchSchedulesEvery evaluates the schedules every interval until ctx is done
+func dispatchSchedulesEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := dispatchSchedules(ctx); err != nil {
+				logger.Error("failed to dispatch schedules", zap.Error(err))
+			}
+		}
+	}
+}
+
+func listAppInstallations(ctx context.Context, client *github.Client) ([]*github.Installation, error) {
+	var installations []*github.Installation
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := client.Apps.ListInstallations(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list installations: %w", err)
+		}
+		installations = append(installations, page...)
+		if resp.NextPage == 0 {
+			return installations, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func listInstallationRepositories(ctx context.Context, client *github.Client) ([]*github.Repository, error) {
+	var repos []*github.Repository
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := client.Apps.ListRepos(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list repositories: %w", err)
+		}
+		repos = append(repos, page.Repositories...)
+		if resp.NextPage == 0 {
+			return repos, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// dispatchInstallationSchedules sends the due dispatches of an installation
+// and returns how many were sent and the failures. Only the repositories the
+// installation registry lists with schedules are read, unless the registry
+// has not checked every repository within scheduleRescanInterval.
+func dispatchInstallationSchedules(ctx context.Context, client *github.Client, installation *github.Installation, now time.Time, interval time.Duration) (int, []string) {
+	id := installation.GetID()
+	record, err := installationRegistry.Get(ctx, id)
+	if err != nil {
+		return 0, []string{fmt.Sprintf("installation %d: %v", id, err)}
+	}
+	if record == nil || now.Sub(record.SchedulesScannedAt) >= scheduleRescanInterval {
+		return rescanInstallationSchedules(ctx, client, installation, now, interval)
+	}
+
+	sent := 0
+	var failures, unscheduled []string
+	for _, fullName := range record.ScheduledRepositories {
+		owner, name, _ := strings.Cut(fullName, "/")
+		repo, _, err := client.Repositories.Get(ctx, owner, name)
+		if err != nil {
+			var errResp *github.ErrorResponse
+			if errors.As(err, &errResp) && errResp.Response.StatusCode == http.StatusNotFound {
+				unscheduled = append(unscheduled, fullName)
+				continue
+			}
+			failures = append(failures, fmt.Sprintf("%s: %v", fullName, err))
+			continue
+		}
+		if repo.GetArchived() {
+			continue
+		}
+
+		n, scheduled, err := dispatchRepositorySchedules(ctx, client, id, repo, now, interval)
+		sent += n
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", fullName, err))
+		}
+		if !scheduled {
+			unscheduled = append(unscheduled, fullName)
+		}
+	}
+
+	if len(unscheduled) > 0 {
+		if _, err := updateInstallation(ctx, installationRegistry, id, func(record *InstallationRecord) {
+			for _, fullName := range unscheduled {
+				record.ScheduledRepositories = setRepository(record.ScheduledRepositories, fullName, false)
+			}
+		}); err != nil {
+			failures = append(failures, fmt.Sprintf("installation %d: %v", id, err))
+		}
+	}
+	return sent, failures
+}
+
+// rescanInstallationSchedules sends the due dispatches of every repository of
+// the installation and records the repositories with schedules
+func rescanInstallationSchedules(ctx context.Context, client *github.Client, installation *github.Installation, now time.Time, interval time.Duration) (int, []string) {
+	id := installation.GetID()
+	repos, err := listInstallationRepositories(ctx, client)
+	if err != nil {
+		return 0, []string{fmt.Sprintf("installation %d: %v", id, err)}
+	}
+
+	sent := 0
+	var failures, scheduledRepos []string
+	for _, repo := range repos {
+		if repo.GetArchived() {
+			continue
+		}
+		n, scheduled, err := dispatchRepositorySchedules(ctx, client, id, repo, now, interval)
+		sent += n
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", repo.GetFullName(), err))
+		}
+		if scheduled {
+			scheduledRepos = setRepository(scheduledRepos, repo.GetFullName(), true)
+		}
+	}
+
+	logger.Info("installation scanned for schedules",
+		zap.Int64("installationId", id),
+		zap.Int("repositories", len(repos)),
+		zap.Int("scheduled", len(scheduledRepos)),
+	)
+	if _, err := updateInstallation(ctx, installationRegistry, id, func(record *InstallationRecord) {
+		if record.Account == "" {
+			record.Account = installation.GetAccount().GetLogin()
+			record.AccountType = installation.GetAccount().GetType()
+		}
+		record.ScheduledRepositories = scheduledRepos
+		record.SchedulesScannedAt = now
+	}); err != nil {
+		failures = append(failures, fmt.Sprintf("installation %d: %v", id, err))
+	}
+	return sent, failures
+}
+
+// trackScheduledRepository records whether the repository has schedules in
+// the installation registry when the event is a push that changed the app
+// config of the default branch. loadErr is the error loading the config, a
+// missing config has no schedules.
+func trackScheduledRepository(ctx context.Context, event Event, config *AppConfig, loadErr error) {
+	push, ok := event.(*PushEvent)
+	if !ok || !push.changesAppConfig() {
+		return
+	}
+	payload := push.Envelope()
+
+	var errResp *github.ErrorResponse
+	scheduled := false
+	switch {
+	case loadErr == nil:
+		scheduled = len(config.Schedules) > 0
+	case errors.As(loadErr, &errResp) && errResp.Response.StatusCode == http.StatusNotFound:
+	default:
+		// The schedules are unknown, the next rescan checks them
+		return
+	}
+
+	_, err := updateInstallation(ctx, installationRegistry, payload.Installation.ID, func(record *InstallationRecord) {
+		if record.Account == "" {
+			record.Account = payload.Repository.Owner.Login
+			record.AccountType = payload.Repository.Owner.Type
+		}
+		record.ScheduledRepositories = setRepository(record.ScheduledRepositories, payload.Repository.FullName, scheduled)
+	})
+	if err != nil {
+		logger.Warn("failed to record repository schedules",
+			zap.String("repo", payload.Repository.FullName),
+			zap.Error(err),
+		)
+	}
+}
+
+// dispatchRepositorySchedules sends the dispatches of the repository's
+// schedules due at now. It returns how many were sent and whether the
+// repository has schedules; repositories without an app config have none.
+func dispatchRepositorySchedules(ctx context.Context, client *github.Client, installationID int64, repo *github.Repository, now time.Time, interval time.Duration) (int, bool, error) {
+	owner, name := repo.GetOwner().GetLogin(), repo.GetName()
+
+	config, err := loadAppConfig(ctx, client, owner, name)
+	if err != nil {
+		var errResp *github.ErrorResponse
+		if errors.As(err, &errResp) && errResp.Response.StatusCode == http.StatusNotFound {
+			return 0, false, nil
+		}
+		// Keep the repository scheduled until its config can be read
+		return 0, true, err
+	}
+	if len(config.Schedules) == 0 {
+		return 0, false, nil
+	}
+
+	sent := 0
+	var latest map[string]interface{}
+	latestResolved := false
+	var failures []string
+	for i, schedule := range config.Schedules {
+		scheduledAt, err := schedule.dueAt(now, interval)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("schedule %d: %v", i, err))
+			continue
+		}
+		if scheduledAt.IsZero() {
+			continue
+		}
+
+		// EventBridge may invoke the task twice and Lambda retries failed runs
+		runID := fmt.Sprintf("schedule:%s:%d:%d", repo.GetFullName(), i, scheduledAt.Unix())
+		claimed, err := idempotencyStore.Claim(ctx, runID)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("schedule %d: %v", i, err))
+			continue
+		}
+		if !claimed {
+			logger.Info("schedule already dispatched", zap.String("runId", runID))
+			continue
+		}
+
+		if !latestResolved {
+			if latest, err = latestVersion(ctx, client, owner, name); err != nil {
+				failures = append(failures, fmt.Sprintf("schedule %d: %v", i, err))
+				releaseScheduleRun(ctx, runID)
+				continue
+			}
+			latestResolved = true
+		}
+
+		event := &ScheduleEvent{
+			WebhookPayload: WebhookPayload{
+				Repository: Repository{
+					ID:            repo.GetID(),
+					Name:          name,
+					FullName:      repo.GetFullName(),
+					Owner:         User{Login: owner, ID: repo.GetOwner().GetID(), Type: repo.GetOwner().GetType()},
+					DefaultBranch: repo.GetDefaultBranch(),
+				},
+				Installation: Installation{ID: installationID},
+			},
+			Schedule:    schedule,
+			ScheduledAt: scheduledAt,
+			Latest:      latest,
+		}
+		report := runSchedule(ctx, client, config, runID, i, event)
+		sent += report.countTargets(targetStatusSent)
+
+		if report.Status == reportStatusFailed {
+			// Nothing was sent, let a retried run try again
+			releaseScheduleRun(ctx, runID)
+		} else {
+			completeDelivery(ctx, runID)
+		}
+		if failed := report.countTargets(targetStatusFailed); failed > 0 {
+			failures = append(failures, fmt.Sprintf("schedule %d: %d dispatches failed", i, failed))
+		}
+	}
+
+	if len(failures) > 0 {
+		return sent, true, errors.New(strings.Join(failures, ", "))
+	}
+	return sent, true, nil
+}
+
+// runSchedule sends the dispatches of a due schedule. Freeze windows apply as
+// for webhook dispatches, sender policies do not since nobody triggered it.
+func runSchedule(ctx context.Context, client *github.Client, config *AppConfig, runID string, index int, event *ScheduleEvent) *DispatchReport {
+	report := newDispatchReport(runID, event)
+	d := newDispatcher(runID, event, client, config, report)
+
+	rule := Rule{Event: event.Name()}
+	for j, target := range event.Schedule.Targets {
+		target.Senders = nil
+		d.dispatch(ctx, index, j, rule, target, nil)
+	}
+	report.finish()
+
+	logger.Info("schedule dispatched",
+		zap.String("runId", runID),
+		zap.String("schedule", event.Schedule.Name),
+		zap.String("status", report.Status),
+		zap.Int("dispatchesSent", report.countTargets(targetStatusSent)),
+		zap.Int("dispatchesFailed", report.countTargets(targetStatusFailed)),
+		zap.Int("dispatchesDeferred", report.countTargets(targetStatusDeferred)),
+	)
+	return report
+}
+
+func releaseScheduleRun(ctx context.Context, runID string) {
+	if err := idempotencyStore.Release(ctx, runID); err != nil {
+		logger.Warn("failed to release schedule run", zap.String("runId", runID), zap.Error(err))
+	}
+}
+
+// latestVersion returns the client_payload fields of the repository's latest
+// release, shaped like those of release events. Repositories without releases
+// fall back to their highest stable semver tag. It returns nil when neither exists.
+func latestVersion(ctx context.Context, client *github.Client, owner, repo string) (map[string]interface{}, error) {
+	release, _, err := client.Repositories.GetLatestRelease(ctx, owner, repo)
+	if err == nil {
+		event := &ReleaseEvent{Release: &Release{
+			ID:              release.GetID(),
+			TagName:         release.GetTagName(),
+			Name:            release.GetName(),
+			Draft:           release.GetDraft(),
+			Prerelease:      release.GetPrerelease(),
+			TargetCommitish: release.GetTargetCommitish(),
+			HTMLURL:         release.GetHTMLURL(),
+			Body:            release.GetBody(),
+		}}
+		if release.PublishedAt != nil {
+			event.Release.PublishedAt = &release.PublishedAt.Time
+		}
+		return event.ClientPayload(), nil
+	}
+	var errResp *github.ErrorResponse
+	if !errors.As(err, &errResp) || errResp.Response.StatusCode != http.StatusNotFound {
+		return nil, fmt.Errorf("failed to get latest release: %w", err)
+	}
+
+	// Tags are listed in name order, not version order, so every page is read
+	var latest *github.RepositoryTag
+	var latestSemver *semVersion
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		tags, resp, err := client.Repositories.ListTags(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags: %w", err)
+		}
+		for _, tag := range tags {
+			v, err := parseSemver(tag.GetName())
+			if err != nil || len(v.Prerelease) > 0 {
+				continue
+			}
+			if latestSemver == nil || v.Compare(latestSemver) > 0 {
+				latest, latestSemver = tag, v
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	if latest == nil {
+		return nil, nil
+	}
+
+	return map[string]interface{}{
+		"tag": map[string]interface{}{
+			"name": latest.GetName(),
+			"sha":  latest.GetCommit().GetSHA(),
+		},
+		"version": versionPayload(latest.GetName()),
+	}, nil
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+func TestScheduleDueAt(t *testing.T) {
+	// Wednesday 2025-06-04 02:03:30 UTC
+	now := time.Date(2025, 6, 4, 2, 3, 30, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		schedule Schedule
+		interval time.Duration
+		want     time.Time
+		wantErr  bool
+	}{
+		{"nightly", Schedule{Cron: "0 2 * * *"}, 5 * time.Minute, time.Date(2025, 6, 4, 2, 0, 0, 0, time.UTC), false},
+		{"window end is inclusive", Schedule{Cron: "3 2 * * *"}, 5 * time.Minute, time.Date(2025, 6, 4, 2, 3, 0, 0, time.UTC), false},
+		{"window start is exclusive", Schedule{Cron: "58 1 * * *"}, 5 * time.Minute, time.Time{}, false},
+		{"not yet", Schedule{Cron: "4 2 * * *"}, 5 * time.Minute, time.Time{}, false},
+		{"once per interval", Schedule{Cron: "* * * * *"}, 5 * time.Minute, time.Date(2025, 6, 4, 1, 59, 0, 0, time.UTC), false},
+		{"other weekday", Schedule{Cron: "0 2 * * MON"}, 5 * time.Minute, time.Time{}, false},
+		{"timezone", Schedule{Cron: "0 4 * * *", Timezone: "Europe/Berlin"}, 5 * time.Minute, time.Date(2025, 6, 4, 2, 0, 0, 0, time.UTC), false},
+		{"invalid cron", Schedule{Cron: "0 2 * *"}, 5 * time.Minute, time.Time{}, true},
+		{"invalid timezone", Schedule{Cron: "0 2 * * *", Timezone: "Mars/Olympus"}, 5 * time.Minute, time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.schedule.dueAt(now, tt.interval)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("dueAt() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("dueAt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeScheduleGitHub serves the app config, releases and pages of tags of
+// my-org/app next to my-org/docs without a config, and records the config
+// reads and dispatches
+type fakeScheduleGitHub struct {
+	mu          sync.Mutex
+	config      string
+	release     string
+	tags        []string
+	configReads []string
+	dispatches  []string
+	payloads    []map[string]interface{}
+}
+
+func (f *fakeScheduleGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	if strings.HasSuffix(r.URL.Path, "/contents/.github/app-config.yaml") {
+		f.configReads = append(f.configReads, strings.Split(r.URL.Path, "/")[3])
+	}
+	switch {
+	case r.URL.Path == "/installation/repositories":
+		w.Write([]byte(`{"total_count": 2, "repositories": [{"name": "app", "full_name": "my-org/app", "owner": {"login": "my-org"}}, {"name": "docs", "full_name": "my-org/docs", "owner": {"login": "my-org"}}]}`))
+	case r.URL.Path == "/repos/my-org/app":
+		w.Write([]byte(`{"name": "app", "full_name": "my-org/app", "owner": {"login": "my-org"}}`))
+	case r.URL.Path == "/repos/my-org/app/contents/.github/app-config.yaml" && f.config != "":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"type":     "file",
+			"encoding": "base64",
+			"content":  base64.StdEncoding.EncodeToString([]byte(f.config)),
+		})
+	case r.URL.Path == "/repos/my-org/app/releases/latest" && f.release != "":
+		w.Write([]byte(f.release))
+	case r.URL.Path == "/repos/my-org/app/tags":
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		page = max(page, 1)
+		if page < len(f.tags) {
+			w.Header().Set("Link", fmt.Sprintf(`<%s?page=%d>; rel="next"`, r.URL.Path, page+1))
+		}
+		if page > len(f.tags) {
+			w.Write([]byte(`[]`))
+			return
+		}
+		w.Write([]byte(f.tags[page-1]))
+	case strings.HasSuffix(r.URL.Path, "/dispatches"):
+		var request struct {
+			EventType     string                 `json:"event_type"`
+			ClientPayload map[string]interface{} `json:"client_payload"`
+		}
+		json.Unmarshal(body, &request)
+		f.dispatches = append(f.dispatches, strings.TrimPrefix(strings.TrimSuffix(r.URL.Path, "/dispatches"), "/repos/")+" "+request.EventType)
+		f.payloads = append(f.payloads, request.ClientPayload)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message": "Not Found"}`))
+	}
+}
+
+func TestDispatchRepositorySchedules(t *testing.T) {
+	config := `
+schedules:
+  - name: nightly
+    cron: "0 2 * * *"
+    targets:
+      - repo: e2e-tests
+        event_type: nightly
+  - name: weekly
+    cron: "0 2 * * SUN"
+    targets:
+      - repo: reports
+        event_type: weekly
+`
+	now := time.Date(2025, 6, 4, 2, 3, 30, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		config         string
+		release        string
+		tags           []string
+		wantDispatches []string
+		wantTag        string
+	}{
+		{
+			name:           "latest release",
+			config:         config,
+			release:        `{"id": 1, "tag_name": "v1.4.0", "name": "1.4.0", "html_url": "https://github.com/my-org/app/releases/v1.4.0", "published_at": "2025-06-01T10:00:00Z"}`,
+			wantDispatches: []string{"my-org/e2e-tests nightly"},
+			wantTag:        "v1.4.0",
+		},
+		{
+			name:           "highest stable tag without releases",
+			config:         config,
+			tags:           []string{`[{"name": "v1.10.0", "commit": {"sha": "abc"}}, {"name": "v2.0.0-rc.1", "commit": {"sha": "def"}}, {"name": "v1.9.0", "commit": {"sha": "123"}}, {"name": "nightly"}]`},
+			wantDispatches: []string{"my-org/e2e-tests nightly"},
+			wantTag:        "v1.10.0",
+		},
+		{
+			name:           "highest tag on a later page",
+			config:         config,
+			tags:           []string{`[{"name": "v1.10.0"}, {"name": "v1.9.0"}]`, `[{"name": "v10.0.0"}, {"name": "v9.0.0"}]`},
+			wantDispatches: []string{"my-org/e2e-tests nightly"},
+			wantTag:        "v10.0.0",
+		},
+		{
+			name:           "no releases or tags",
+			config:         config,
+			tags:           []string{`[]`},
+			wantDispatches: []string{"my-org/e2e-tests nightly"},
+		},
+		{
+			name: "no config",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := idempotencyStore
+			idempotencyStore = newMemoryIdempotencyStore(time.Minute, time.Hour)
+			defer func() { idempotencyStore = previous }()
+
+			fake := &fakeScheduleGitHub{config: tt.config, release: tt.release, tags: tt.tags}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+
+			client := github.NewClient(nil)
+			client.BaseURL, _ = url.Parse(server.URL + "/")
+
+			repo := &github.Repository{
+				Name:     github.String("app"),
+				FullName: github.String("my-org/app"),
+				Owner:    &github.User{Login: github.String("my-org")},
+			}
+			sent, scheduled, err := dispatchRepositorySchedules(context.Background(), client, 1, repo, now, 5*time.Minute)
+			if err != nil {
+				t.Fatalf("dispatchRepositorySchedules() error = %v", err)
+			}
+			if scheduled != (tt.config != "") {
+				t.Errorf("scheduled = %v, want %v", scheduled, tt.config != "")
+			}
+			if sent != len(tt.wantDispatches) || strings.Join(fake.dispatches, ",") != strings.Join(tt.wantDispatches, ",") {
+				t.Errorf("sent %d dispatches %v, want %v", sent, fake.dispatches, tt.wantDispatches)
+			}
+
+			if len(fake.payloads) > 0 {
+				payload := fake.payloads[0]
+				schedule, _ := payload["schedule"].(map[string]interface{})
+				if payload["source_event"] != "schedule" || payload["source_repo"] != "my-org/app" || schedule["name"] != "nightly" || schedule["scheduled_at"] != "2025-06-04T02:00:00Z" {
+					t.Errorf("unexpected payload: %v", payload)
+				}
+
+				var tag interface{}
+				if release, ok := payload["release"].(map[string]interface{}); ok {
+					tag = release["tag_name"]
+				} else if ref, ok := payload["tag"].(map[string]interface{}); ok {
+					tag = ref["name"]
+				}
+				if tt.wantTag == "" && tag != nil || tt.wantTag != "" && tag != tt.wantTag {
+					t.Errorf("latest tag = %v, want %q", tag, tt.wantTag)
+				}
+			}
+
+			// A second run in the same interval sends nothing
+			if sent, _, err := dispatchRepositorySchedules(context.Background(), client, 1, repo, now, 5*time.Minute); sent != 0 || err != nil {
+				t.Errorf("second run sent %d, error = %v", sent, err)
+			}
+		})
+	}
+}
+
+func TestDispatchInstallationSchedules(t *testing.T) {
+	previousStore, previousRegistry := idempotencyStore, installationRegistry
+	idempotencyStore = newMemoryIdempotencyStore(time.Minute, time.Hour)
+	installationRegistry = newMemoryInstallationRegistry()
+	defer func() { idempotencyStore, installationRegistry = previousStore, previousRegistry }()
+
+	fake := &fakeScheduleGitHub{
+		config: "schedules:\n  - cron: \"0 2 * * *\"\n    targets:\n      - repo: e2e-tests\n        event_type: nightly\n",
+		tags:   []string{`[]`},
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	ctx := context.Background()
+	installation := &github.Installation{ID: github.Int64(1), Account: &github.User{Login: github.String("my-org")}}
+	now := time.Date(2025, 6, 4, 2, 3, 30, 0, time.UTC)
+
+	run := func(at time.Time, wantReads ...string) *InstallationRecord {
+		t.Helper()
+		fake.configReads = nil
+		if _, failures := dispatchInstallationSchedules(ctx, client, installation, at, 5*time.Minute); len(failures) > 0 {
+			t.Fatalf("dispatchInstallationSchedules() failures = %v", failures)
+		}
+		if strings.Join(fake.configReads, ",") != strings.Join(wantReads, ",") {
+			t.Errorf("config reads = %v, want %v", fake.configReads, wantReads)
+		}
+		record, _ := installationRegistry.Get(ctx, 1)
+		return record
+	}
+
+	// The first run reads every repository and records the one with schedules
+	record := run(now, "app", "docs")
+	if len(fake.dispatches) != 1 || !slices.Equal(record.ScheduledRepositories, []string{"my-org/app"}) || !record.SchedulesScannedAt.Equal(now) || record.Account != "my-org" {
+		t.Fatalf("dispatches = %v, record = %+v", fake.dispatches, record)
+	}
+
+	// Later runs only read the repositories with schedules
+	run(now.Add(5*time.Minute), "app")
+
+	// A repository whose schedules were removed is no longer read
+	fake.config = ""
+	if record := run(now.Add(10*time.Minute), "app"); len(record.ScheduledRepositories) != 0 {
+		t.Errorf("ScheduledRepositories = %v, want none", record.ScheduledRepositories)
+	}
+	run(now.Add(15 * time.Minute))
+
+	// Every repository is read again once per scheduleRescanInterval
+	run(now.Add(scheduleRescanInterval), "app", "docs")
+}
+
+func TestTrackScheduledRepository(t *testing.T) {
+	previous := installationRegistry
+	installationRegistry = newMemoryInstallationRegistry()
+	defer func() { installationRegistry = previous }()
+
+	ctx := context.Background()
+	push := func(ref string) *PushEvent {
+		return &PushEvent{
+			WebhookPayload: WebhookPayload{
+				Repository:   Repository{Name: "app", FullName: "my-org/app", DefaultBranch: "main", Owner: User{Login: "my-org", Type: "Organization"}},
+				Installation: Installation{ID: 1},
+			},
+			Ref:     ref,
+			Commits: []Commit{{Modified: []string{configFilePath}}},
+		}
+	}
+	notFound := fmt.Errorf("failed to get config file: %w", &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusNotFound}})
+	scheduled := &AppConfig{Schedules: []Schedule{{Name: "nightly", Cron: "0 2 * * *"}}}
+
+	// A schedule added on another branch does not run until it is merged
+	trackScheduledRepository(ctx, push("refs/heads/feature"), scheduled, nil)
+	if record, _ := installationRegistry.Get(ctx, 1); record != nil {
+		t.Fatalf("push to another branch registered %+v", record)
+	}
+
+	tests := []struct {
+		name    string
+		config  *AppConfig
+		loadErr error
+		want    []string
+	}{
+		{"schedules added", scheduled, nil, []string{"my-org/app"}},
+		{"config unreadable", nil, errors.New("failed to parse config"), []string{"my-org/app"}},
+		{"schedules removed", &AppConfig{}, nil, nil},
+		{"schedules added again", scheduled, nil, []string{"my-org/app"}},
+		{"config deleted", nil, notFound, nil},
+	}
+
+	for _, tt := range tests {
+		trackScheduledRepository(ctx, push("refs/heads/main"), tt.config, tt.loadErr)
+		record, err := installationRegistry.Get(ctx, 1)
+		if err != nil || record == nil {
+			t.Fatalf("%s: Get() = %v, %v", tt.name, record, err)
+		}
+		if !slices.Equal(record.ScheduledRepositories, tt.want) || record.Account != "my-org" {
+			t.Errorf("%s: record = %+v, want scheduled repositories %v", tt.name, record, tt.want)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// semVersion is a parsed semantic version (https://semver.org)
+type semVersion struct {
+	Major      int64
+	Minor      int64
+	Patch      int64
+	Prerelease []string
+	Build      string
+}
+
+// parseSemver parses MAJOR.MINOR.PATCH[-PRERELEASE][+BUILD] with an optional v prefix
+func parseSemver(value string) (*semVersion, error) {
+	v, parts, err := parsePartialSemver(value)
+	if err != nil {
+		return nil, err
+	}
+	if parts < 3 {
+		return nil, fmt.Errorf("invalid semantic version %q: expected MAJOR.MINOR.PATCH", value)
+	}
+	return v, nil
+}
+
+// parsePartialSemver parses a version that may omit the minor and patch
+// numbers or use x/X/* wildcards for them, as used in constraints. It returns
+// the number of leading numeric parts present.
+func parsePartialSemver(value string) (*semVersion, int, error) {
+	s := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(value), "v"), "V")
+	v := &semVersion{}
+
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		v.Build = s[i+1:]
+		s = s[:i]
+		if v.Build == "" {
+			return nil, 0, fmt.Errorf("invalid semantic version %q: empty build metadata", value)
+		}
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		v.Prerelease = strings.Split(s[i+1:], ".")
+		s = s[:i]
+		for _, id := range v.Prerelease {
+			if id == "" {
+				return nil, 0, fmt.Errorf("invalid semantic version %q: empty prerelease identifier", value)
+			}
+		}
+	}
+
+	numbers := strings.Split(s, ".")
+	if len(numbers) > 3 {
+		return nil, 0, fmt.Errorf("invalid semantic version %q", value)
+	}
+
+	parts := 0
+	targets := []*int64{&v.Major, &v.Minor, &v.Patch}
+	for i, number := range numbers {
+		if number == "x" || number == "X" || number == "*" {
+			break
+		}
+		n, err := strconv.ParseInt(number, 10, 64)
+		if err != nil || n < 0 || (len(number) > 1 && number[0] == '0') {
+			return nil, 0, fmt.Errorf("invalid semantic version %q", value)
+		}
+		*targets[i] = n
+		parts++
+	}
+	if parts == 0 && numbers[0] != "x" && numbers[0] != "X" && numbers[0] != "*" {
+		return nil, 0, fmt.Errorf("invalid semantic version %q", value)
+	}
+	if parts < 3 && len(v.Prerelease) > 0 {
+		return nil, 0, fmt.Errorf("invalid semantic version %q: prerelease needs MAJOR.MINOR.PATCH", value)
+	}
+
+	return v, parts, nil
+}
+
+func (v *semVersion) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.Prerelease) > 0 {
+		s += "-" + strings.Join(v.Prerelease, ".")
+	}
+	return s
+}
+
+// Channel returns the prerelease channel, the first prerelease identifier
+// without trailing digits ("rc" for 1.0.0-rc.1 and 1.0.0-rc1), or "" for releases
+func (v *semVersion) Channel() string {
+	if len(v.Prerelease) == 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimRight(v.Prerelease[0], "0123456789"))
+}
+
+// Compare returns -1, 0 or 1 following semver precedence, build metadata is ignored
+func (v *semVersion) Compare(other *semVersion) int {
+	for _, pair := range [][2]int64{{v.Major, other.Major}, {v.Minor, other.Minor}, {v.Patch, other.Patch}} {
+		if pair[0] != pair[1] {
+			if pair[0] < pair[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	// A prerelease has lower precedence than the release itself
+	switch {
+	case len(v.Prerelease) == 0 && len(other.Prerelease) == 0:
+		return 0
+	case len(v.Prerelease) == 0:
+		return 1
+	case len(other.Prerelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(v.Prerelease) && i < len(other.Prerelease); i++ {
+		if c := comparePrereleaseIdentifier(v.Prerelease[i], other.Prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(v.Prerelease) < len(other.Prerelease):
+		return -1
+	case len(v.Prerelease) > len(other.Prerelease):
+		return 1
+	}
+	return 0
+}
+
+// comparePrereleaseIdentifier compares numeric identifiers numerically and
+// others lexically, numeric identifiers having lower precedence
+func comparePrereleaseIdentifier(a, b string) int {
+	an, aErr := strconv.ParseUint(a, 10, 64)
+	bn, bErr := strconv.ParseUint(b, 10, 64)
+	switch {
+	case aErr == nil && bErr == nil:
+		if an < bn {
+			return -1
+		} else if an > bn {
+			return 1
+		}
+		return 0
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// semverComparator is a single operator and version, e.g. >=2.0.0
+type semverComparator struct {
+	op      string
+	version *semVersion
+}
+
+func (c semverComparator) matches(v *semVersion) bool {
+	cmp := v.Compare(c.version)
+	switch c.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "!=":
+		return cmp != 0
+	default:
+		return cmp == 0
+	}
+}
+
+// semverConstraint is a union of comparator sets: ">=1.2.0 <2.0.0 || ^3.1"
+type semverConstraint struct {
+	sets [][]semverComparator
+}
+
+// parseSemverConstraint parses ranges made of comparators (=, !=, <, <=, >,
+// >=) joined by spaces or commas, caret (^1.2) and tilde (~1.2) ranges,
+// wildcards (1.x, 1.2.*) and alternatives separated by ||
+func parseSemverConstraint(value string) (*semverConstraint, error) {
+	constraint := &semverConstraint{}
+	for _, alternative := range strings.Split(value, "||") {
+		terms := strings.Fields(strings.ReplaceAll(alternative, ",", " "))
+		if len(terms) == 0 {
+			return nil, fmt.Errorf("invalid semver constraint %q: empty range", value)
+		}
+
+		// An empty set (e.g. from *) matches every version
+		set := []semverComparator{}
+		for _, term := range terms {
+			comparators, err := parseSemverTerm(term)
+			if err != nil {
+				return nil, fmt.Errorf("invalid semver constraint %q: %w", value, err)
+			}
+			set = append(set, comparators...)
+		}
+		constraint.sets = append(constraint.sets, set)
+	}
+	return constraint, nil
+}
+
+// parseSemverTerm expands one term of a range to plain comparators
+func parseSemverTerm(term string) ([]semverComparator, error) {
+	op := ""
+	for _, candidate := range []string{">=", "<=", "!=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(term, candidate) {
+			op = candidate
+			break
+		}
+	}
+
+	v, parts, err := parsePartialSemver(strings.TrimPrefix(term, op))
+	if err != nil {
+		return nil, err
+	}
+	lower := func(op string) []semverComparator { return []semverComparator{{op, v}} }
+	upper := func(major, minor, patch int64) semverComparator {
+		// -0 is the lowest prerelease, so prereleases of the bound stay excluded
+		return semverComparator{"<", &semVersion{Major: major, Minor: minor, Patch: patch, Prerelease: []string{"0"}}}
+	}
+
+	switch op {
+	case "^":
+		switch {
+		case v.Major > 0 || parts == 1:
+			return append(lower(">="), upper(v.Major+1, 0, 0)), nil
+		case v.Minor > 0 || parts == 2:
+			return append(lower(">="), upper(0, v.Minor+1, 0)), nil
+		default:
+			return append(lower(">="), upper(0, 0, v.Patch+1)), nil
+		}
+	case "~":
+		if parts == 1 {
+			return append(lower(">="), upper(v.Major+1, 0, 0)), nil
+		}
+		return append(lower(">="), upper(v.Major, v.Minor+1, 0)), nil
+	case ">":
+		// >1 and >1.2 exclude every 1.x and 1.2.x version
+		switch parts {
+		case 0:
+			return []semverComparator{upper(0, 0, 0)}, nil // matches nothing
+		case 1:
+			return []semverComparator{{">=", &semVersion{Major: v.Major + 1}}}, nil
+		case 2:
+			return []semverComparator{{">=", &semVersion{Major: v.Major, Minor: v.Minor + 1}}}, nil
+		}
+		return lower(">"), nil
+	case "<=":
+		switch parts {
+		case 0:
+			return nil, nil
+		case 1:
+			return []semverComparator{upper(v.Major+1, 0, 0)}, nil
+		case 2:
+			return []semverComparator{upper(v.Major, v.Minor+1, 0)}, nil
+		}
+		return lower("<="), nil
+	case "", "=":
+		// A partial version is a range: 1.2 is >=1.2.0 <1.3.0
+		switch parts {
+		case 0:
+			return nil, nil
+		case 1:
+			return append(lower(">="), upper(v.Major+1, 0, 0)), nil
+		case 2:
+			return append(lower(">="), upper(v.Major, v.Minor+1, 0)), nil
+		}
+		return lower("="), nil
+	default:
+		if parts == 0 {
+			if op == ">=" {
+				return nil, nil
+			}
+			// <* and !=* exclude every version
+			return []semverComparator{upper(0, 0, 0)}, nil
+		}
+		return lower(op), nil
+	}
+}
+
+// Matches reports whether the version satisfies one of the alternatives
+func (c *semverConstraint) Matches(v *semVersion) bool {
+	for _, set := range c.sets {
+		matched := true
+		for _, comparator := range set {
+			if !comparator.matches(v) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// versionPayload returns the parsed version of a tag for the client_payload,
+// nil when the tag is not a semantic version
+func versionPayload(tag string) map[string]interface{} {
+	v, err := parseSemver(tag)
+	if err != nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"major":      v.Major,
+		"minor":      v.Minor,
+		"patch":      v.Patch,
+		"prerelease": strings.Join(v.Prerelease, "."),
+		"build":      v.Build,
+	}
+}
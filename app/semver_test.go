@@ -0,0 +1,130 @@
+package main
+
+import "testing"
+
+func TestParseSemver(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		channel string
+		wantErr bool
+	}{
+		{value: "1.2.3", want: "1.2.3"},
+		{value: "v2.0.0", want: "2.0.0"},
+		{value: "v2.0.0-rc.1", want: "2.0.0-rc.1", channel: "rc"},
+		{value: "1.0.0-Beta2+build.5", want: "1.0.0-Beta2", channel: "beta"},
+		{value: "1.2", wantErr: true},
+		{value: "01.2.3", wantErr: true},
+		{value: "1.2.3-", wantErr: true},
+		{value: "1.2.3.4", wantErr: true},
+		{value: "nightly-2025-01-01", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		v, err := parseSemver(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseSemver(%q) = %v, want error", tt.value, v)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseSemver(%q) error = %v", tt.value, err)
+			continue
+		}
+		if v.String() != tt.want || v.Channel() != tt.channel {
+			t.Errorf("parseSemver(%q) = %s channel %q, want %s channel %q", tt.value, v, v.Channel(), tt.want, tt.channel)
+		}
+	}
+}
+
+func TestSemverPrecedence(t *testing.T) {
+	// Ordered as in the semver specification
+	ordered := []string{
+		"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta",
+		"1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.1.0", "2.0.0",
+	}
+	for i := 0; i < len(ordered)-1; i++ {
+		a, _ := parseSemver(ordered[i])
+		b, _ := parseSemver(ordered[i+1])
+		if a.Compare(b) != -1 || b.Compare(a) != 1 {
+			t.Errorf("expected %s < %s", ordered[i], ordered[i+1])
+		}
+	}
+
+	a, _ := parseSemver("1.0.0+build.1")
+	b, _ := parseSemver("1.0.0+build.2")
+	if a.Compare(b) != 0 {
+		t.Error("build metadata must not affect precedence")
+	}
+}
+
+func TestSemverConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{">=2.0.0", "2.0.0", true},
+		{">=2.0.0", "1.9.9", false},
+		{">=2.0.0", "2.0.0-rc.1", false},
+		{">=2.0.0-0", "2.0.0-rc.1", true},
+		{">=1.2.0 <2.0.0", "1.5.0", true},
+		{">=1.2.0, <2.0.0", "2.0.0", false},
+		{"<2.0.0", "2.0.0-rc.1", true},
+		{"^1.2.3", "1.9.0", true},
+		{"^1.2.3", "2.0.0", false},
+		{"^1.2.3", "2.0.0-rc.1", false},
+		{"^0.2.3", "0.2.9", true},
+		{"^0.2.3", "0.3.0", false},
+		{"^0.0.3", "0.0.4", false},
+		{"~1.2.3", "1.2.9", true},
+		{"~1.2.3", "1.3.0", false},
+		{"~1", "1.9.0", true},
+		{"1.x", "1.4.2", true},
+		{"1.x", "2.0.0", false},
+		{"1.2", "1.2.7", true},
+		{"1.2.*", "1.3.0", false},
+		{"*", "0.0.1", true},
+		{">*", "1.0.0", false},
+		{">*", "0.0.0-rc.1", false},
+		{"<*", "1.0.0", false},
+		{"<*", "0.0.0-rc.1", false},
+		{"!=*", "1.0.0", false},
+		{"!=x", "0.0.0", false},
+		{">=*", "0.0.1", true},
+		{">1", "1.9.0", false},
+		{">1", "2.0.0", true},
+		{">1.2", "1.2.9", false},
+		{"<=1.2", "1.2.9", true},
+		{"<=1.2", "1.3.0", false},
+		{"!=1.0.0", "1.0.0", false},
+		{"=1.0.0", "1.0.0", true},
+		{"<1.0.0 || >=3.0.0", "3.1.0", true},
+		{"<1.0.0 || >=3.0.0", "2.0.0", false},
+	}
+
+	for _, tt := range tests {
+		constraint, err := parseSemverConstraint(tt.constraint)
+		if err != nil {
+			t.Errorf("parseSemverConstraint(%q) error = %v", tt.constraint, err)
+			continue
+		}
+		v, err := parseSemver(tt.version)
+		if err != nil {
+			t.Fatalf("parseSemver(%q) error = %v", tt.version, err)
+		}
+		if got := constraint.Matches(v); got != tt.want {
+			t.Errorf("%q matches %s = %v, want %v", tt.constraint, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestSemverConstraintInvalid(t *testing.T) {
+	for _, constraint := range []string{"", ">=", "1.2.3 ||", ">=abc", "^1.x-rc"} {
+		if _, err := parseSemverConstraint(constraint); err == nil {
+			t.Errorf("parseSemverConstraint(%q) expected an error", constraint)
+		}
+	}
+}
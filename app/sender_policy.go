@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+	"go.uber.org/zap"
+)
+
+// SenderPolicy restricts who can trigger dispatches, on a rule or on a single target
+type SenderPolicy struct {
+	// Allow and Teams list the senders allowed to trigger, a sender matching
+	// either qualifies. When both are empty every sender is allowed.
+	Allow []string `yaml:"allow" mapstructure:"allow"`
+	Teams []string `yaml:"teams" mapstructure:"teams"`
+	// Deny lists senders that never trigger, it wins over Allow and Teams
+	Deny []string `yaml:"deny" mapstructure:"deny"`
+	// IgnoreBots skips events sent by bot accounts (GitHub Apps, Dependabot)
+	IgnoreBots bool `yaml:"ignore-bots" mapstructure:"ignore-bots"`
+}
+
+// senderAuthorizer checks the sender of a delivery against sender policies,
+// caching team memberships for the delivery
+type senderAuthorizer struct {
+	client *github.Client
+	org    string
+	sender User
+	teams  map[string]bool
+}
+
+func newSenderAuthorizer(client *github.Client, payload *WebhookPayload) *senderAuthorizer {
+	return &senderAuthorizer{
+		client: client,
+		org:    payload.Repository.Owner.Login,
+		sender: payload.Sender,
+		teams:  make(map[string]bool),
+	}
+}
+
+// Authorize returns why the sender may not trigger under the policy, "" when it may.
+// An error means team membership could not be checked.
+func (a *senderAuthorizer) Authorize(ctx context.Context, policy *SenderPolicy) (string, error) {
+	if policy == nil {
+		return "", nil
+	}
+
+	login := a.sender.Login
+	if policy.IgnoreBots && (a.sender.Type == "Bot" || strings.HasSuffix(login, "[bot]")) {
+		return fmt.Sprintf("sender %s is a bot", login), nil
+	}
+	if containsLogin(policy.Deny, login) {
+		return fmt.Sprintf("sender %s is denied", login), nil
+	}
+	if len(policy.Allow) == 0 && len(policy.Teams) == 0 {
+		return "", nil
+	}
+	if containsLogin(policy.Allow, login) {
+		return "", nil
+	}
+
+	for _, team := range policy.Teams {
+		member, err := a.isTeamMember(ctx, team)
+		if err != nil {
+			return "", err
+		}
+		if member {
+			return "", nil
+		}
+	}
+
+	if len(policy.Teams) == 0 {
+		return fmt.Sprintf("sender %s is not allowed", login), nil
+	}
+	return fmt.Sprintf("sender %s is not allowed or a member of %s", login, strings.Join(policy.Teams, ", ")), nil
+}
+
+// isTeamMember checks the sender's active membership of a team, given as
+// org/team-slug or as a team slug of the source repository owner
+func (a *senderAuthorizer) isTeamMember(ctx context.Context, team string) (bool, error) {
+	if member, ok := a.teams[team]; ok {
+		return member, nil
+	}
+
+	org, slug, ok := strings.Cut(team, "/")
+	if !ok {
+		org, slug = a.org, team
+	}
+
+	membership, _, err := a.client.Teams.GetTeamMembershipBySlug(ctx, org, slug, a.sender.Login)
+	var errResp *github.ErrorResponse
+	switch {
+	case errors.As(err, &errResp) && errResp.Response.StatusCode == http.StatusNotFound:
+		// Not a member, or the team does not exist
+		a.teams[team] = false
+	case err != nil:
+		return false, fmt.Errorf("failed to check membership of team %s: %w", team, err)
+	default:
+		a.teams[team] = membership.GetState() == "active"
+	}
+
+	logger.Info("checked sender team membership",
+		zap.String("sender", a.sender.Login),
+		zap.String("team", team),
+		zap.Bool("member", a.teams[team]),
+	)
+	return a.teams[team], nil
+}
+
+func containsLogin(logins []string, login string) bool {
+	for _, candidate := range logins {
+		if strings.EqualFold(candidate, login) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v57/github"
+)
+
+func TestSenderAuthorizer(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/orgs/my-org/teams/release-managers/memberships/alice":
+			w.Write([]byte(`{"state": "active", "role": "member"}`))
+		case "/orgs/my-org/teams/release-managers/memberships/carol":
+			w.Write([]byte(`{"state": "pending", "role": "member"}`))
+		case "/orgs/other-org/teams/sre/memberships/alice":
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message": "Resource not accessible by integration"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message": "Not Found"}`))
+		}
+	}))
+	defer server.Close()
+
+	client := github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	sender := func(login, userType string) *senderAuthorizer {
+		return newSenderAuthorizer(client, &WebhookPayload{
+			Repository: Repository{Owner: User{Login: "my-org"}},
+			Sender:     User{Login: login, Type: userType},
+		})
+	}
+
+	tests := []struct {
+		name       string
+		authorizer *senderAuthorizer
+		policy     *SenderPolicy
+		wantReason string
+		wantErr    bool
+	}{
+		{"no policy", sender("bob", "User"), nil, "", false},
+		{"empty policy", sender("bob", "User"), &SenderPolicy{}, "", false},
+		{"bot ignored", sender("dependabot[bot]", "Bot"), &SenderPolicy{IgnoreBots: true}, "sender dependabot[bot] is a bot", false},
+		{"bot suffix ignored", sender("renovate[bot]", ""), &SenderPolicy{IgnoreBots: true}, "sender renovate[bot] is a bot", false},
+		{"bot allowed", sender("dependabot[bot]", "Bot"), &SenderPolicy{}, "", false},
+		{"denied", sender("Mallory", "User"), &SenderPolicy{Deny: []string{"mallory"}}, "sender Mallory is denied", false},
+		{"deny wins over allow", sender("mallory", "User"), &SenderPolicy{Allow: []string{"mallory"}, Deny: []string{"mallory"}}, "sender mallory is denied", false},
+		{"allowed", sender("bob", "User"), &SenderPolicy{Allow: []string{"bob"}}, "", false},
+		{"not allowed", sender("eve", "User"), &SenderPolicy{Allow: []string{"bob"}}, "sender eve is not allowed", false},
+		{"team member", sender("alice", "User"), &SenderPolicy{Teams: []string{"release-managers"}}, "", false},
+		{"pending team member", sender("carol", "User"), &SenderPolicy{Teams: []string{"release-managers"}}, "sender carol is not allowed or a member of release-managers", false},
+		{"not a team member", sender("eve", "User"), &SenderPolicy{Teams: []string{"my-org/release-managers"}}, "sender eve is not allowed or a member of my-org/release-managers", false},
+		{"allow list or team", sender("bob", "User"), &SenderPolicy{Allow: []string{"bob"}, Teams: []string{"release-managers"}}, "", false},
+		{"membership check fails", sender("alice", "User"), &SenderPolicy{Teams: []string{"other-org/sre"}}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, err := tt.authorizer.Authorize(context.Background(), tt.policy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Authorize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if reason != tt.wantReason {
+				t.Errorf("Authorize() = %q, want %q", reason, tt.wantReason)
+			}
+		})
+	}
+
+	// Memberships are checked once per delivery
+	authorizer := sender("alice", "User")
+	requests = 0
+	policy := &SenderPolicy{Teams: []string{"release-managers"}}
+	authorizer.Authorize(context.Background(), policy)
+	authorizer.Authorize(context.Background(), policy)
+	if requests != 1 {
+		t.Errorf("expected one membership request, got %d", requests)
+	}
+}
+
+func TestAuthorizeSender(t *testing.T) {
+	authorizer := newSenderAuthorizer(nil, &WebhookPayload{Sender: User{Login: "bob", Type: "User"}})
+
+	rule := Rule{Senders: &SenderPolicy{Deny: []string{"mallory"}}}
+	prod := Target{Repo: "prod", EventType: "deploy", Senders: &SenderPolicy{Allow: []string{"alice"}}}
+	staging := Target{Repo: "staging", EventType: "deploy"}
+
+	if status, reason := authorizeSender(context.Background(), authorizer, rule, prod); status != targetStatusSkipped || !strings.Contains(reason, "not allowed") {
+		t.Errorf("prod = %q, %q, want skipped by the target policy", status, reason)
+	}
+	if status, _ := authorizeSender(context.Background(), authorizer, rule, staging); status != "" {
+		t.Errorf("staging = %q, want allowed", status)
+	}
+
+	rule.Senders.Deny = append(rule.Senders.Deny, "bob")
+	if status, reason := authorizeSender(context.Background(), authorizer, rule, staging); status != targetStatusSkipped || reason != "sender bob is denied" {
+		t.Errorf("staging = %q, %q, want skipped by the rule policy", status, reason)
+	}
+}
@@ -1,48 +1,156 @@
 package main
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type AppConfig struct {
 	Dispatches []Rule `yaml:"dispatches" mapstructure:"dispatches"`
+	// Freezes hold dispatches back during change freezes
+	Freezes        []FreezeWindow  `yaml:"freezes" mapstructure:"freezes"`
+	FreezeOverride *FreezeOverride `yaml:"freeze-override" mapstructure:"freeze-override"`
+	// ChatOps configures the /dispatch comment command
+	ChatOps *ChatOpsConfig `yaml:"chatops" mapstructure:"chatops"`
+	// Schedules send dispatches on a cron schedule instead of on events
+	Schedules []Schedule `yaml:"schedules" mapstructure:"schedules"`
 }
 
 type Rule struct {
 	Event   string   `yaml:"event" mapstructure:"event"`
 	Targets []Target `yaml:"targets" mapstructure:"targets"`
+
+	// Senders restricts who can trigger the rule's dispatches
+	Senders *SenderPolicy `yaml:"senders" mapstructure:"senders"`
+
+	// Types restricts the rule to these webhook actions (e.g. opened, published)
+	Types []string `yaml:"types" mapstructure:"types"`
+
+	// Ref filters with GitHub Actions glob semantics. Push events match the
+	// pushed ref, pull requests their base branch and workflow runs their head branch.
+	Branches       []string `yaml:"branches" mapstructure:"branches"`
+	BranchesIgnore []string `yaml:"branches-ignore" mapstructure:"branches-ignore"`
+	Tags           []string `yaml:"tags" mapstructure:"tags"`
+	TagsIgnore     []string `yaml:"tags-ignore" mapstructure:"tags-ignore"`
+
+	// Tag conditions for tag pushes and releases: a regular expression and a
+	// semver range such as ">=2.0.0 <3.0.0". Prereleases only satisfy the range
+	// when their channel (e.g. rc, beta) is listed in PrereleaseChannels.
+	TagPattern         string   `yaml:"tag-pattern" mapstructure:"tag-pattern"`
+	Semver             string   `yaml:"semver" mapstructure:"semver"`
+	PrereleaseChannels []string `yaml:"prerelease-channels" mapstructure:"prerelease-channels"`
+
+	// Changed path filters for branch pushes and releases, evaluated with the compare API
+	Paths       []string `yaml:"paths" mapstructure:"paths"`
+	PathsIgnore []string `yaml:"paths-ignore" mapstructure:"paths-ignore"`
+
+	// Pull request filters, unset pointers do not restrict
+	HeadBranches       []string `yaml:"head-branches" mapstructure:"head-branches"`
+	HeadBranchesIgnore []string `yaml:"head-branches-ignore" mapstructure:"head-branches-ignore"`
+	Merged             *bool    `yaml:"merged" mapstructure:"merged"`
+	Labels             []string `yaml:"labels" mapstructure:"labels"`
+
+	// Draft filters draft pull requests and releases. Unset matches every pull
+	// request but no draft release.
+	Draft *bool `yaml:"draft" mapstructure:"draft"`
+	// Prerelease is include (default), exclude or only
+	Prerelease string `yaml:"prerelease" mapstructure:"prerelease"`
+
+	// RefTypes restricts create and delete rules to branch or tag refs
+	RefTypes []string `yaml:"ref-types" mapstructure:"ref-types"`
+
+	// Package filters: types (container, npm, ...) and name and version
+	// patterns, container versions also match on their tag
+	PackageTypes    []string `yaml:"package-types" mapstructure:"package-types"`
+	PackageNames    []string `yaml:"package-names" mapstructure:"package-names"`
+	PackageVersions []string `yaml:"package-versions" mapstructure:"package-versions"`
+
+	// Deployment filters: environment name patterns and deployment status states
+	Environments []string `yaml:"environments" mapstructure:"environments"`
+	States       []string `yaml:"states" mapstructure:"states"`
+
+	// Workflow run filters, workflows match the workflow name or file path
+	Workflows   []string `yaml:"workflows" mapstructure:"workflows"`
+	Conclusions []string `yaml:"conclusions" mapstructure:"conclusions"`
 }
 
 type Target struct {
 	Repo      string `yaml:"repo" mapstructure:"repo"`
 	EventType string `yaml:"event_type" mapstructure:"event_type"`
+
+	// Senders further restricts who can trigger this target, on top of the rule's policy
+	Senders *SenderPolicy `yaml:"senders" mapstructure:"senders"`
+
+	// TeardownEventType is dispatched to the target of a create rule when the
+	// created branch or tag is deleted, e.g. to remove a preview environment
+	TeardownEventType string `yaml:"teardown-event-type" mapstructure:"teardown-event-type"`
+
+	// Forward copies these JSON pointers (e.g. /alert/rule/severity) of the
+	// webhook body into client_payload.event. ForwardRaw forwards the whole
+	// body instead, as long as the client_payload fits in maxClientPayloadSize.
+	Forward    []string `yaml:"forward" mapstructure:"forward"`
+	ForwardRaw bool     `yaml:"forward-raw" mapstructure:"forward-raw"`
 }
 
-// WebhookPayload represents the GitHub webhook payload
+// WebhookPayload holds the fields common to every GitHub webhook payload.
+// Typed events embed it and add their own event specific fields.
 type WebhookPayload struct {
 	Action       string       `json:"action"`
 	Repository   Repository   `json:"repository"`
 	Sender       User         `json:"sender"`
 	Installation Installation `json:"installation"`
-	Release      *Release     `json:"release,omitempty"`
-	Ref          string       `json:"ref,omitempty"`
+
+	// raw is the webhook body the event was parsed from, for forwarding
+	raw json.RawMessage
 }
 
+func (p *WebhookPayload) Envelope() *WebhookPayload { return p }
+
 type Repository struct {
-	ID       int64  `json:"id"`
-	Name     string `json:"name"`
-	FullName string `json:"full_name"`
-	Owner    User   `json:"owner"`
+	ID            int64  `json:"id"`
+	Name          string `json:"name"`
+	FullName      string `json:"full_name"`
+	Owner         User   `json:"owner"`
+	DefaultBranch string `json:"default_branch,omitempty"`
 }
 
 type User struct {
 	Login string `json:"login"`
 	ID    int64  `json:"id"`
+	Type  string `json:"type,omitempty"`
 }
 
 type Installation struct {
-	ID int64 `json:"id"`
+	ID                  int64  `json:"id"`
+	Account             User   `json:"account,omitempty"`
+	RepositorySelection string `json:"repository_selection,omitempty"`
+}
+
+type Commit struct {
+	ID        string       `json:"id"`
+	Message   string       `json:"message"`
+	Timestamp string       `json:"timestamp"`
+	URL       string       `json:"url"`
+	Author    CommitAuthor `json:"author"`
+	Added     []string     `json:"added,omitempty"`
+	Modified  []string     `json:"modified,omitempty"`
+	Removed   []string     `json:"removed,omitempty"`
+}
+
+type CommitAuthor struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Username string `json:"username,omitempty"`
 }
 
 type Release struct {
-	ID      int64  `json:"id"`
-	TagName string `json:"tag_name"`
-	Name    string `json:"name"`
-	Draft   bool   `json:"draft"`
+	ID              int64      `json:"id"`
+	TagName         string     `json:"tag_name"`
+	Name            string     `json:"name"`
+	Draft           bool       `json:"draft"`
+	Prerelease      bool       `json:"prerelease"`
+	TargetCommitish string     `json:"target_commitish"`
+	HTMLURL         string     `json:"html_url"`
+	Body            string     `json:"body"`
+	PublishedAt     *time.Time `json:"published_at"`
 }
@@ -10,7 +10,7 @@ func TestWebhookPayloadUnmarshal(t *testing.T) {
 		name    string
 		json    string
 		wantErr bool
-		verify  func(*testing.T, *WebhookPayload)
+		verify  func(*testing.T, *ReleaseEvent)
 	}{
 		{
 			name: "complete release payload",
@@ -40,7 +40,7 @@ func TestWebhookPayloadUnmarshal(t *testing.T) {
 				}
 			}`,
 			wantErr: false,
-			verify: func(t *testing.T, p *WebhookPayload) {
+			verify: func(t *testing.T, p *ReleaseEvent) {
 				if p.Action != "published" {
 					t.Errorf("Action = %v, want published", p.Action)
 				}
@@ -77,7 +77,7 @@ func TestWebhookPayloadUnmarshal(t *testing.T) {
 				}
 			}`,
 			wantErr: false,
-			verify: func(t *testing.T, p *WebhookPayload) {
+			verify: func(t *testing.T, p *ReleaseEvent) {
 				if p.Release != nil {
 					t.Error("Release should be nil")
 				}
@@ -96,7 +96,7 @@ func TestWebhookPayloadUnmarshal(t *testing.T) {
 				"installation": {}
 			}`,
 			wantErr: false,
-			verify: func(t *testing.T, p *WebhookPayload) {
+			verify: func(t *testing.T, p *ReleaseEvent) {
 				if p.Repository.Owner.Login != "" {
 					t.Errorf("Owner.Login should be empty, got %v", p.Repository.Owner.Login)
 				}
@@ -111,7 +111,7 @@ func TestWebhookPayloadUnmarshal(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			var payload WebhookPayload
+			var payload ReleaseEvent
 			err := json.Unmarshal([]byte(tt.json), &payload)
 
 			if (err != nil) != tt.wantErr {
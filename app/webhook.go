@@ -2,40 +2,128 @@ package main
 
 import (
 	"crypto/hmac"
+	"crypto/sha1"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
+	"net/http"
 	"strings"
 )
 
+// signatureScheme describes one of the headers GitHub signs deliveries with
+type signatureScheme struct {
+	algorithm string
+	header    string
+	prefix    string
+	hash      func() hash.Hash
+}
+
+var (
+	sha256Signature = signatureScheme{algorithm: "sha256", header: "X-Hub-Signature-256", prefix: "sha256=", hash: sha256.New}
+	// sha1Signature is only sent alone by older GitHub Enterprise Server versions
+	sha1Signature = signatureScheme{algorithm: "sha1", header: "X-Hub-Signature", prefix: "sha1=", hash: sha1.New}
+
+	errMissingSignature = errors.New("no signature provided")
+)
+
+// webhookSecret is an accepted webhook secret and the generation it belongs to
+type webhookSecret struct {
+	generation string
+	value      string
+}
+
+// signatureMatch reports how a delivery's signature was verified
+type signatureMatch struct {
+	Algorithm  string
+	Generation string
+}
+
+// webhookSecrets returns the accepted secrets, the current one first followed
+// by previous ones still accepted while a rotation is rolled out
+func webhookSecrets() []webhookSecret {
+	var secrets []webhookSecret
+	if githubAppWebhookSecret != "" {
+		secrets = append(secrets, webhookSecret{generation: "current", value: githubAppWebhookSecret})
+	}
+	for i, secret := range githubAppPreviousWebhookSecrets {
+		if secret == "" {
+			continue
+		}
+		generation := "previous"
+		if i > 0 {
+			generation = fmt.Sprintf("previous-%d", i+1)
+		}
+		secrets = append(secrets, webhookSecret{generation: generation, value: secret})
+	}
+	return secrets
+}
+
+// verifyWebhookSignature verifies the delivery against X-Hub-Signature-256,
+// falling back to the SHA-1 X-Hub-Signature header only when allowed
+func verifyWebhookSignature(payload []byte, headers http.Header) (signatureMatch, error) {
+	scheme := sha256Signature
+	signature := headers.Get(sha256Signature.header)
+	if signature == "" && allowSHA1Signatures {
+		scheme = sha1Signature
+		signature = headers.Get(sha1Signature.header)
+	}
+	if signature == "" {
+		return signatureMatch{}, errMissingSignature
+	}
+
+	generation, err := matchSignature(payload, signature, scheme)
+	if err != nil {
+		return signatureMatch{}, err
+	}
+	return signatureMatch{Algorithm: scheme.algorithm, Generation: generation}, nil
+}
+
 // verifyGitHubSignature verifies that the webhook request is from GitHub
 // by comparing the signature in the X-Hub-Signature-256 header with
 // https://docs.github.com/en/webhooks/webhook-events-and-payloads
 // the HMAC-SHA256 hash of the request body using the webhook secret
 
 func verifyGitHubSignature(payload []byte, signature string) (bool, error) {
-	if githubAppWebhookSecret == "" {
-		return false, fmt.Errorf("webhook secret not configured")
+	if _, err := matchSignature(payload, signature, sha256Signature); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// matchSignature computes the HMAC with every accepted secret and returns the
+// generation of the secret that matched. All secrets are always tried so the
+// response time does not reveal which generation is in use.
+func matchSignature(payload []byte, signature string, scheme signatureScheme) (string, error) {
+	secrets := webhookSecrets()
+	if len(secrets) == 0 {
+		return "", fmt.Errorf("webhook secret not configured")
 	}
 
 	if signature == "" {
-		return false, fmt.Errorf("no signature provided")
+		return "", errMissingSignature
 	}
 
-	if !strings.HasPrefix(signature, "sha256=") {
-		return false, fmt.Errorf("invalid signature format")
+	if !strings.HasPrefix(signature, scheme.prefix) {
+		return "", fmt.Errorf("invalid signature format")
 	}
 
-	receivedSignature := strings.TrimPrefix(signature, "sha256=")
+	receivedSignature := strings.TrimPrefix(signature, scheme.prefix)
 
-	
-	mac := hmac.New(sha256.New, []byte(githubAppWebhookSecret))
-	mac.Write(payload)
-	expectedMAC := mac.Sum(nil)
-	expectedSignature := hex.EncodeToString(expectedMAC)
+	matched := ""
+	for _, secret := range secrets {
+		mac := hmac.New(scheme.hash, []byte(secret.value))
+		mac.Write(payload)
+		expectedSignature := hex.EncodeToString(mac.Sum(nil))
 
-	if !hmac.Equal([]byte(expectedSignature), []byte(receivedSignature)) {
-		return false, fmt.Errorf("signature mismatch")
+		if hmac.Equal([]byte(expectedSignature), []byte(receivedSignature)) && matched == "" {
+			matched = secret.generation
+		}
 	}
-	return true, nil
+
+	if matched == "" {
+		return "", fmt.Errorf("signature mismatch")
+	}
+	return matched, nil
 }
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/url"
+)
+
+// decodeTransportBody undoes the base64 encoding gateways apply to bodies they
+// treat as binary. The result is the exact byte sequence GitHub signed.
+func decodeTransportBody(body string, isBase64Encoded bool) ([]byte, error) {
+	if !isBase64Encoded {
+		return []byte(body), nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode base64 body: %w", err)
+	}
+	return decoded, nil
+}
+
+// extractJSONPayload returns the JSON document of a verified webhook body. Apps
+// configured with the application/x-www-form-urlencoded content type send the
+// JSON in the payload form field; application/json bodies are the JSON itself.
+func extractJSONPayload(contentType string, body []byte) ([]byte, error) {
+	if contentType == "" {
+		return body, nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid content type %q: %w", contentType, err)
+	}
+
+	if mediaType != "application/x-www-form-urlencoded" {
+		return body, nil
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse form body: %w", err)
+	}
+	if !form.Has("payload") {
+		return nil, fmt.Errorf("form body has no payload field")
+	}
+	return []byte(form.Get("payload")), nil
+}
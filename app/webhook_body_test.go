@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/url"
+	"testing"
+)
+
+func TestDecodeTransportBody(t *testing.T) {
+	body := `{"action":"published"}`
+
+	tests := []struct {
+		name     string
+		body     string
+		isBase64 bool
+		want     string
+		wantErr  bool
+	}{
+		{name: "plain body", body: body, want: body},
+		{name: "base64 body", body: base64.StdEncoding.EncodeToString([]byte(body)), isBase64: true, want: body},
+		{name: "invalid base64", body: "not base64!", isBase64: true, wantErr: true},
+		{name: "empty body", body: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeTransportBody(tt.body, tt.isBase64)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeTransportBody() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(got) != tt.want {
+				t.Errorf("decodeTransportBody() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractJSONPayload(t *testing.T) {
+	payload := `{"action":"published","release":{"tag_name":"v1.0.0+build"}}`
+	formBody := "payload=" + url.QueryEscape(payload)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+		wantErr     bool
+	}{
+		{name: "json", contentType: "application/json", body: payload, want: payload},
+		{name: "json with charset", contentType: "application/json; charset=utf-8", body: payload, want: payload},
+		{name: "no content type", contentType: "", body: payload, want: payload},
+		{name: "form encoded", contentType: "application/x-www-form-urlencoded", body: formBody, want: payload},
+		{name: "form encoded mixed case", contentType: "Application/X-WWW-Form-Urlencoded; charset=utf-8", body: formBody, want: payload},
+		{name: "form without payload field", contentType: "application/x-www-form-urlencoded", body: "other=1", wantErr: true},
+		{name: "malformed form", contentType: "application/x-www-form-urlencoded", body: "payload=%zz", wantErr: true},
+		{name: "malformed content type", contentType: "application/json; =", body: payload, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extractJSONPayload(tt.contentType, []byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("extractJSONPayload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(got) != tt.want {
+				t.Errorf("extractJSONPayload() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// WebhookRequest is a transport independent view of an incoming webhook request
+type WebhookRequest struct {
+	RequestID string
+	Method    string
+	Path      string
+	SourceIP  string
+	UserAgent string
+	Headers   http.Header
+	Body      []byte
+}
+
+// WebhookResponse is the transport independent result of handling a webhook
+type WebhookResponse struct {
+	StatusCode  int
+	Body        string
+	ContentType string
+}
+
+// contentTypeHeader returns the Content-Type to answer with, plain text by default
+func (r WebhookResponse) contentTypeHeader() string {
+	if r.ContentType == "" {
+		return "text/plain; charset=utf-8"
+	}
+	return r.ContentType
+}
+
+// handleWebhook verifies and processes a webhook delivery independently of the
+// transport (Lambda or HTTP server) it arrived on
+func handleWebhook(ctx context.Context, req *WebhookRequest) WebhookResponse {
+	logger.Info("received request",
+		zap.String("requestId", req.RequestID),
+		zap.String("method", req.Method),
+		zap.String("path", req.Path),
+		zap.String("sourceIp", req.SourceIP),
+		zap.String("userAgent", req.UserAgent),
+	)
+
+	// Header values are masked by the log redaction policy
+	logger.Info("request headers received",
+		zap.String("requestId", req.RequestID),
+		zap.Any("headers", req.Headers),
+		zap.Int("bodyLength", len(req.Body)),
+	)
+
+	if logPayloadPreviews {
+		bodyPreview := string(req.Body)
+		if len(bodyPreview) > 500 {
+			bodyPreview = bodyPreview[:500] + "... (truncated)"
+		}
+		logger.Debug("request body preview",
+			zap.String("requestId", req.RequestID),
+			zap.String("bodyPreview", bodyPreview),
+		)
+	}
+
+	eventName := req.Headers.Get("X-GitHub-Event")
+	if eventName == "" {
+		logger.Warn("missing x-github-event header")
+		return WebhookResponse{
+			StatusCode: 400,
+			Body:       "Error: missing event header",
+		}
+	}
+
+	// Verify GitHub webhook signature
+	match, err := verifyWebhookSignature(req.Body, req.Headers)
+	if errors.Is(err, errMissingSignature) {
+		logger.Warn("missing signature header",
+			zap.Any("availableHeaders", req.Headers),
+		)
+		return WebhookResponse{
+			StatusCode: 400,
+			Body:       "Error: missing signature header",
+		}
+	}
+	if err != nil {
+		logger.Warn("invalid signature", zap.Error(err))
+		return WebhookResponse{
+			StatusCode: 401,
+			Body:       "Error: invalid signature",
+		}
+	}
+
+	// Tracks when deliveries stop using a previous secret so it can be retired
+	logger.Info("signature verified",
+		zap.String("algorithm", match.Algorithm),
+		zap.String("secretGeneration", match.Generation),
+	)
+
+	// The signature covers the body as sent, decode the content type only once verified
+	payload, err := extractJSONPayload(req.Headers.Get("Content-Type"), req.Body)
+	if err != nil {
+		logger.Warn("failed to decode webhook body", zap.Error(err))
+		return WebhookResponse{
+			StatusCode: 400,
+			Body:       "Error: invalid payload",
+		}
+	}
+
+	// Route the payload to the handler registered for the event
+	event, err := parseWebhookEvent(eventName, payload)
+	if errors.Is(err, errUnsupportedEvent) {
+		logger.Warn("unsupported event type, skipping",
+			zap.String("event", eventName),
+		)
+		return WebhookResponse{
+			StatusCode: 200,
+			Body:       "Event type not supported",
+		}
+	}
+	if err != nil {
+		logger.Error("failed to parse webhook payload", zap.Error(err))
+		return WebhookResponse{
+			StatusCode: 400,
+			Body:       "Error: invalid payload",
+		}
+	}
+
+	logger.Info("webhook signature verified, processing event",
+		zap.String("event", eventName),
+		zap.String("action", event.Envelope().Action),
+		zap.String("repo", event.Envelope().Repository.FullName),
+	)
+
+	// Events about the App itself are handled right away, they are not routed to dispatch rules
+	if lifecycle, ok := event.(lifecycleEvent); ok {
+		return lifecycle.Handle(ctx, req)
+	}
+
+	// GitHub redelivers webhooks with the same delivery ID, skip the ones already processed
+	deliveryID := req.Headers.Get("X-GitHub-Delivery")
+	if deliveryID == "" {
+		logger.Warn("missing x-github-delivery header, skipping deduplication")
+	} else {
+		claimed, err := idempotencyStore.Claim(ctx, deliveryID)
+		if err != nil {
+			logger.Error("failed to record delivery", zap.Error(err), zap.String("deliveryId", deliveryID))
+			return WebhookResponse{
+				StatusCode: 500,
+				Body:       "Error: failed to record delivery",
+			}
+		}
+		if !claimed {
+			logger.Info("duplicate delivery, skipping", zap.String("deliveryId", deliveryID))
+			report := newDispatchReport(deliveryID, event)
+			report.Status = reportStatusDuplicate
+			report.Error = "duplicate delivery"
+			return jsonResponse(200, report)
+		}
+	}
+
+	// In async mode acknowledge GitHub right away and let the consumer process the delivery
+	if processingMode == processingModeAsync {
+		delivery := &QueuedDelivery{
+			DeliveryID: deliveryID,
+			Event:      eventName,
+			Repository: event.Envelope().Repository.FullName,
+			Body:       json.RawMessage(payload),
+		}
+		if err := deliveryQueue.Enqueue(ctx, delivery); err != nil {
+			logger.Error("failed to enqueue delivery", zap.Error(err), zap.String("deliveryId", deliveryID))
+			releaseDelivery(ctx, deliveryID)
+			return WebhookResponse{
+				StatusCode: 500,
+				Body:       "Error: failed to enqueue webhook",
+			}
+		}
+
+		// SQS retries the delivery from here on, a redelivery by GitHub is a duplicate.
+		// The in-memory queue's consumer completes the claim once processed.
+		if _, ok := deliveryQueue.(*memoryDeliveryQueue); !ok {
+			completeDelivery(ctx, deliveryID)
+		}
+
+		logger.Info("webhook queued for processing", zap.String("deliveryId", deliveryID))
+		report := newDispatchReport(deliveryID, event)
+		report.Status = reportStatusQueued
+		return jsonResponse(202, report)
+	}
+
+	// Process the webhook and send repository dispatches
+	report, err := processWebhook(ctx, deliveryID, event)
+	if err != nil {
+		logger.Error("failed to process webhook", zap.Error(err))
+		// Let a redelivery of this webhook be processed again
+		releaseDelivery(ctx, deliveryID)
+		return jsonResponse(500, report)
+	}
+	completeDelivery(ctx, deliveryID)
+
+	logger.Info("webhook processed",
+		zap.String("requestId", req.RequestID),
+		zap.String("status", report.Status),
+	)
+
+	// Failed targets are reported in the body rather than with an error status,
+	// a redelivery would send the successful dispatches a second time
+	return jsonResponse(200, report)
+}
+
+// completeDelivery turns the delivery's in-progress claim into a completed
+// one. Until then a delivery cut short by the function timeout is processed
+// again when redelivered.
+func completeDelivery(ctx context.Context, deliveryID string) {
+	if deliveryID == "" {
+		return
+	}
+	if err := idempotencyStore.Complete(ctx, deliveryID); err != nil {
+		logger.Error("failed to complete delivery", zap.Error(err), zap.String("deliveryId", deliveryID))
+	}
+}
+
+// releaseDelivery drops the delivery's claim so a redelivery is processed again
+func releaseDelivery(ctx context.Context, deliveryID string) {
+	if deliveryID == "" {
+		return
+	}
+	if err := idempotencyStore.Release(ctx, deliveryID); err != nil {
+		logger.Error("failed to release delivery", zap.Error(err), zap.String("deliveryId", deliveryID))
+	}
+}
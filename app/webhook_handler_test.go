@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testReleasePayload = `{
+	"action": "published",
+	"release": {"tag_name": "v1.0.0"},
+	"repository": {"name": "repo", "full_name": "owner/repo", "owner": {"login": "owner"}},
+	"installation": {"id": 42}
+}`
+
+// useFakeAppGitHub points the App at a fake GitHub that issues installation
+// tokens and serves a config without dispatch rules
+func useFakeAppGitHub(t *testing.T) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /app/installations/42/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"token": "ghs_test", "expires_at": "2099-01-01T00:00:00Z"})
+	})
+	mux.HandleFunc("GET /repos/owner/repo/contents/.github/app-config.yaml", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"type": "file", "encoding": "base64", "content": "ZGlzcGF0Y2hlczogW10K"})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	originalURL, originalID, originalKey := githubAPIURL, githubAppID, githubAppPrivateKeyPem
+	githubAPIURL, githubAppID, githubAppPrivateKeyPem = server.URL, 1234, string(keyPEM)
+	t.Cleanup(func() { githubAPIURL, githubAppID, githubAppPrivateKeyPem = originalURL, originalID, originalKey })
+}
+
+// useTestIdempotencyStore swaps in an empty store and a known webhook secret
+func useTestIdempotencyStore(t *testing.T) {
+	t.Helper()
+
+	originalStore, originalSecret := idempotencyStore, githubAppWebhookSecret
+	idempotencyStore = newMemoryIdempotencyStore(time.Minute, time.Hour)
+	githubAppWebhookSecret = "test-secret"
+	t.Cleanup(func() { idempotencyStore, githubAppWebhookSecret = originalStore, originalSecret })
+}
+
+func signedReleaseRequest(deliveryID string) *WebhookRequest {
+	mac := hmac.New(sha256.New, []byte(githubAppWebhookSecret))
+	mac.Write([]byte(testReleasePayload))
+
+	headers := http.Header{}
+	headers.Set("Content-Type", "application/json")
+	headers.Set("X-GitHub-Event", "release")
+	headers.Set("X-GitHub-Delivery", deliveryID)
+	headers.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	return &WebhookRequest{Method: http.MethodPost, Path: "/", Headers: headers, Body: []byte(testReleasePayload)}
+}
+
+func decodeReport(t *testing.T, response WebhookResponse) DispatchReport {
+	t.Helper()
+
+	var report DispatchReport
+	if err := json.Unmarshal([]byte(response.Body), &report); err != nil {
+		t.Fatalf("failed to decode report %q: %v", response.Body, err)
+	}
+	return report
+}
+
+func TestHandleWebhookSkipsDuplicateDelivery(t *testing.T) {
+	useTestIdempotencyStore(t)
+	useFakeAppGitHub(t)
+	ctx := context.Background()
+
+	first := handleWebhook(ctx, signedReleaseRequest("delivery-1"))
+	if first.StatusCode != 200 {
+		t.Fatalf("first delivery status = %d, body %s", first.StatusCode, first.Body)
+	}
+	if report := decodeReport(t, first); report.Status != reportStatusProcessed {
+		t.Errorf("first delivery report status = %q, want %q", report.Status, reportStatusProcessed)
+	}
+
+	second := handleWebhook(ctx, signedReleaseRequest("delivery-1"))
+	if second.StatusCode != 200 {
+		t.Fatalf("redelivery status = %d, want 200", second.StatusCode)
+	}
+	if report := decodeReport(t, second); report.Status != reportStatusDuplicate {
+		t.Errorf("redelivery report status = %q, want %q", report.Status, reportStatusDuplicate)
+	}
+}
+
+func TestHandleWebhookReleasesFailedDelivery(t *testing.T) {
+	useTestIdempotencyStore(t)
+	ctx := context.Background()
+
+	// Without a private key no GitHub client can be created
+	originalKey := githubAppPrivateKeyPem
+	githubAppPrivateKeyPem = ""
+	failed := handleWebhook(ctx, signedReleaseRequest("delivery-1"))
+	githubAppPrivateKeyPem = originalKey
+	if failed.StatusCode != 500 {
+		t.Fatalf("failed delivery status = %d, want 500", failed.StatusCode)
+	}
+
+	useFakeAppGitHub(t)
+	redelivered := handleWebhook(ctx, signedReleaseRequest("delivery-1"))
+	if redelivered.StatusCode != 200 {
+		t.Fatalf("redelivery status = %d, body %s", redelivered.StatusCode, redelivered.Body)
+	}
+	if report := decodeReport(t, redelivered); report.Status != reportStatusProcessed {
+		t.Errorf("redelivery report status = %q, want %q", report.Status, reportStatusProcessed)
+	}
+}
+
+type fakeDeliveryQueue struct {
+	err       error
+	delivered []*QueuedDelivery
+}
+
+func (q *fakeDeliveryQueue) Enqueue(ctx context.Context, delivery *QueuedDelivery) error {
+	if q.err != nil {
+		return q.err
+	}
+	q.delivered = append(q.delivered, delivery)
+	return nil
+}
+
+func useAsyncProcessing(t *testing.T, queue DeliveryQueue) {
+	t.Helper()
+
+	originalMode, originalQueue := processingMode, deliveryQueue
+	processingMode, deliveryQueue = processingModeAsync, queue
+	t.Cleanup(func() { processingMode, deliveryQueue = originalMode, originalQueue })
+}
+
+func TestHandleWebhookEnqueuesDelivery(t *testing.T) {
+	useTestIdempotencyStore(t)
+	queue := &fakeDeliveryQueue{}
+	useAsyncProcessing(t, queue)
+	ctx := context.Background()
+
+	response := handleWebhook(ctx, signedReleaseRequest("delivery-1"))
+	if response.StatusCode != 202 {
+		t.Fatalf("status = %d, body %s", response.StatusCode, response.Body)
+	}
+	if report := decodeReport(t, response); report.Status != reportStatusQueued {
+		t.Errorf("report status = %q, want %q", report.Status, reportStatusQueued)
+	}
+	if len(queue.delivered) != 1 {
+		t.Fatalf("enqueued %d deliveries, want 1", len(queue.delivered))
+	}
+	delivery := queue.delivered[0]
+	if delivery.DeliveryID != "delivery-1" || delivery.Event != "release" || delivery.Repository != "owner/repo" {
+		t.Errorf("enqueued %+v", delivery)
+	}
+	if string(delivery.Body) != testReleasePayload {
+		t.Errorf("enqueued body %s", delivery.Body)
+	}
+
+	// The queue retries from here on, GitHub's redelivery is a duplicate
+	redelivered := handleWebhook(ctx, signedReleaseRequest("delivery-1"))
+	if report := decodeReport(t, redelivered); report.Status != reportStatusDuplicate {
+		t.Errorf("redelivery report status = %q, want %q", report.Status, reportStatusDuplicate)
+	}
+	if len(queue.delivered) != 1 {
+		t.Errorf("redelivery was enqueued again")
+	}
+}
+
+func TestHandleWebhookEnqueueFailure(t *testing.T) {
+	useTestIdempotencyStore(t)
+	queue := &fakeDeliveryQueue{err: errors.New("queue unavailable")}
+	useAsyncProcessing(t, queue)
+	ctx := context.Background()
+
+	response := handleWebhook(ctx, signedReleaseRequest("delivery-1"))
+	if response.StatusCode != 500 || response.Body != "Error: failed to enqueue webhook" {
+		t.Fatalf("response = %d %q, want 500 failed to enqueue", response.StatusCode, response.Body)
+	}
+
+	// The claim is released so GitHub's redelivery is enqueued
+	queue.err = nil
+	redelivered := handleWebhook(ctx, signedReleaseRequest("delivery-1"))
+	if redelivered.StatusCode != 202 || len(queue.delivered) != 1 {
+		t.Errorf("redelivery status = %d with %d enqueued, want 202 and 1", redelivered.StatusCode, len(queue.delivered))
+	}
+}
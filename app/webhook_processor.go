@@ -3,79 +3,250 @@ package main
 import (
 	"context"
 	"fmt"
+	"slices"
+	"time"
 
+	"github.com/google/go-github/v57/github"
 	"go.uber.org/zap"
 )
 
-var (
-	// supportedEvents defines which webhook events are handled
-	supportedEvents = map[string]bool{
-		"release": true,
-	}
-)
+// processWebhook processes the webhook and sends repository dispatches based on config.
+// The report lists every target and its outcome; an error is only returned when the
+// delivery could not be processed at all.
+func processWebhook(ctx context.Context, deliveryID string, event Event) (*DispatchReport, error) {
 
-// processWebhook processes the webhook and sends repository dispatches based on config
-func processWebhook(ctx context.Context, payload *WebhookPayload) error {
+	payload := event.Envelope()
+	report := newDispatchReport(deliveryID, event)
 
 	client, err := createGitHubClient(payload.Installation.ID)
 	if err != nil {
-		return fmt.Errorf("failed to create GitHub client: %w", err)
+		return report.fail(fmt.Errorf("failed to create GitHub client: %w", err))
 	}
 
 	// Load dispatch configuration from the source repository
 	config, err := loadAppConfig(ctx, client, payload.Repository.Owner.Login, payload.Repository.Name)
+	// Schedules are only evaluated for repositories known to have them
+	trackScheduledRepository(ctx, event, config, err)
 	if err != nil {
-		return fmt.Errorf("failed to load app config: %w", err)
+		return report.fail(fmt.Errorf("failed to load app config: %w", err))
 	}
 
-
-	eventType, _ := determineEventType(payload)
+	eventType := event.Name()
 
 	logger.Info("processing webhook event",
+		zap.String("deliveryId", deliveryID),
 		zap.String("eventType", eventType),
 		zap.String("action", payload.Action),
 		zap.String("repo", payload.Repository.FullName),
 	)
 
+	// Changed files are only fetched when a matching rule has paths filters
+	changes := newChangedFilesLoader(client, event)
+	d := newDispatcher(deliveryID, event, client, config, report)
+
+	// Slash commands name their targets, they are not matched against the rules
+	if source, ok := event.(commandSource); ok {
+		runDispatchCommands(ctx, d, config, source)
+	}
+
 	// Find matching dispatch rules
-	var dispatched int
-	for _, rule := range config.Dispatches {
-		if !matchesRule(rule, eventType) {
+	for i, rule := range config.Dispatches {
+		var fields map[string]interface{}
+		if !ruleApplies(rule, event) {
+			// A deleted ref tears down what the targets of a create rule set up
+			teardown, ok := teardownRule(rule, event)
+			if !ok {
+				continue
+			}
+			rule, fields = teardown, map[string]interface{}{"teardown": true}
+		}
+
+		// Paths filters need the compare API, so they are evaluated last
+		paths, matched, err := evaluatePathFilters(ctx, changes, rule)
+		if err != nil {
+			logger.Error("failed to evaluate paths filters", zap.Int("rule", i), zap.Error(err))
+			report.MatchedRules = append(report.MatchedRules, RuleReport{Index: i, Event: rule.Event})
+			for _, target := range rule.Targets {
+				report.addTarget(i, target, targetStatusFailed, fmt.Sprintf("failed to evaluate paths filters: %v", err))
+			}
 			continue
 		}
+		if !matched {
+			continue
+		}
+		report.MatchedRules = append(report.MatchedRules, RuleReport{Index: i, Event: rule.Event})
 
-		// Send dispatches to all targets
-		for _, target := range rule.Targets {
-			if err := sendRepositoryDispatch(ctx, client, target, payload); err != nil {
-				logger.Error("failed to send repository dispatch",
-					zap.Error(err),
-					zap.String("target", fmt.Sprintf("%s/%s", payload.Repository.Owner.Login, target.Repo)),
-				)
-				continue
+		if paths != nil {
+			if fields == nil {
+				fields = map[string]interface{}{}
 			}
-			dispatched++
+			fields["paths"] = paths
+		}
+
+		// Send dispatches to all targets
+		for j, target := range rule.Targets {
+			d.dispatch(ctx, i, j, rule, target, fields)
 		}
 	}
 
+	report.finish()
+
 	logger.Info("webhook processing complete",
-		zap.Int("dispatchesSent", dispatched),
+		zap.String("status", report.Status),
+		zap.Int("dispatchesSent", report.countTargets(targetStatusSent)),
+		zap.Int("dispatchesFailed", report.countTargets(targetStatusFailed)),
+		zap.Int("dispatchesSkipped", report.countTargets(targetStatusSkipped)),
+		zap.Int("dispatchesDeferred", report.countTargets(targetStatusDeferred)),
 	)
 
-	return nil
+	return report, nil
 }
 
-// determineEventType determines the event type from the payload
-func determineEventType(payload *WebhookPayload) (string, error) {
-	if payload.Release != nil {
-		eventType := "release"
-		if supportedEvents[eventType] {
-			return eventType, nil
+// dispatcher sends the dispatches of one delivery, applying sender policies
+// and freeze windows to every target and recording the outcomes in the report
+type dispatcher struct {
+	deliveryID string
+	event      Event
+	client     *github.Client
+	report     *DispatchReport
+	senders    *senderAuthorizer
+	freezes    *freezeGate
+}
+
+func newDispatcher(deliveryID string, event Event, client *github.Client, config *AppConfig, report *DispatchReport) *dispatcher {
+	return &dispatcher{
+		deliveryID: deliveryID,
+		event:      event,
+		client:     client,
+		report:     report,
+		senders:    newSenderAuthorizer(client, event.Envelope()),
+		freezes:    newFreezeGate(config, event, client, time.Now()),
+	}
+}
+
+// dispatch sends the dispatch for a target of a rule, records the outcome and returns it
+func (d *dispatcher) dispatch(ctx context.Context, ruleIndex, targetIndex int, rule Rule, target Target, fields map[string]interface{}) TargetReport {
+	return d.dispatchAs(ctx, deferredDispatchID(d.deliveryID, ruleIndex, targetIndex), ruleIndex, rule, target, fields)
+}
+
+// dispatchAs is dispatch for targets sent more than once per delivery, dispatchID
+// tells their deferred dispatches apart
+func (d *dispatcher) dispatchAs(ctx context.Context, dispatchID string, ruleIndex int, rule Rule, target Target, fields map[string]interface{}) TargetReport {
+	status, reason := d.send(ctx, dispatchID, rule, target, fields)
+	d.report.addTarget(ruleIndex, target, status, reason)
+	return d.report.Targets[len(d.report.Targets)-1]
+}
+
+func (d *dispatcher) send(ctx context.Context, dispatchID string, rule Rule, target Target, fields map[string]interface{}) (string, string) {
+	if target.Repo == "" || target.EventType == "" {
+		return targetStatusSkipped, "target repo or event_type not configured"
+	}
+
+	if status, reason := authorizeSender(ctx, d.senders, rule, target); status != "" {
+		return status, reason
+	}
+
+	fields, err := forwardedFields(target, d.event, fields)
+	if err != nil {
+		return targetStatusFailed, err.Error()
+	}
+
+	payload := d.event.Envelope()
+	window, release, err := d.freezes.Check(ctx, target)
+	if err != nil {
+		logger.Error("failed to check freeze windows", zap.Error(err))
+		return targetStatusFailed, err.Error()
+	}
+	if window != nil {
+		dispatch := &DeferredDispatch{
+			ID:             dispatchID,
+			DeliveryID:     d.deliveryID,
+			InstallationID: payload.Installation.ID,
+			Owner:          payload.Repository.Owner.Login,
+			Target:         target,
+			NotBefore:      release,
+			Freeze:         window.Name,
 		}
+		return holdDispatch(ctx, window, dispatch, d.event, fields)
 	}
-	return "", fmt.Errorf("unsupported or unknown event type")
+
+	if err := sendRepositoryDispatch(ctx, d.client, target, d.event, fields); err != nil {
+		logger.Error("failed to send repository dispatch",
+			zap.Error(err),
+			zap.String("target", fmt.Sprintf("%s/%s", payload.Repository.Owner.Login, target.Repo)),
+		)
+		return targetStatusFailed, err.Error()
+	}
+	return targetStatusSent, ""
+}
+
+// authorizeSender applies the rule's and then the target's sender policy. It
+// returns the target status and reason when the dispatch must not be sent.
+func authorizeSender(ctx context.Context, senders *senderAuthorizer, rule Rule, target Target) (string, string) {
+	for _, policy := range []*SenderPolicy{rule.Senders, target.Senders} {
+		reason, err := senders.Authorize(ctx, policy)
+		if err != nil {
+			logger.Error("failed to authorize sender", zap.Error(err))
+			return targetStatusFailed, err.Error()
+		}
+		if reason != "" {
+			logger.Info("dispatch skipped by sender policy",
+				zap.String("target", target.Repo),
+				zap.String("reason", reason),
+			)
+			return targetStatusSkipped, reason
+		}
+	}
+	return "", ""
+}
+
+// holdDispatch skips or defers a dispatch frozen by the window and returns
+// the target status and reason
+func holdDispatch(ctx context.Context, window *freezeWindow, dispatch *DeferredDispatch, event Event, fields map[string]interface{}) (string, string) {
+	until := dispatch.NotBefore.In(window.location).Format(time.RFC3339)
+
+	if window.Mode == freezeModeSkip {
+		logger.Info("dispatch skipped by freeze window",
+			zap.String("freeze", window.Name),
+			zap.String("target", dispatch.Target.Repo),
+		)
+		return targetStatusSkipped, fmt.Sprintf("frozen by freeze window %s until %s", window.Name, until)
+	}
+
+	clientPayload, err := buildClientPayload(event, fields)
+	if err != nil {
+		return targetStatusFailed, err.Error()
+	}
+	dispatch.ClientPayload = clientPayload
+	if err := deferredDispatchStore.Put(ctx, dispatch); err != nil {
+		logger.Error("failed to store deferred dispatch", zap.Error(err))
+		return targetStatusFailed, err.Error()
+	}
+
+	logger.Info("dispatch deferred by freeze window",
+		zap.String("freeze", window.Name),
+		zap.String("target", dispatch.Target.Repo),
+		zap.Time("notBefore", dispatch.NotBefore),
+	)
+	return targetStatusDeferred, fmt.Sprintf("deferred by freeze window %s until %s", window.Name, until)
 }
 
 // matchesRule checks if the webhook matches the rule
 func matchesRule(rule Rule, eventType string) bool {
 	return rule.Event == eventType
 }
+
+// ruleApplies checks the rule's event name, action types and the event specific filters
+func ruleApplies(rule Rule, event Event) bool {
+	if !matchesRule(rule, event.Name()) {
+		return false
+	}
+	action := event.Envelope().Action
+	if len(rule.Types) > 0 && !slices.Contains(rule.Types, action) {
+		return false
+	}
+	if filter, ok := event.(ruleFilter); ok {
+		return filter.MatchesFilters(rule)
+	}
+	return true
+}
@@ -2,8 +2,12 @@ package main
 
 import (
 	"crypto/hmac"
+	"crypto/sha1"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"hash"
+	"net/http"
 	"testing"
 )
 
@@ -147,3 +151,116 @@ func TestVerifyGitHubSignature_EdgeCases(t *testing.T) {
 		}
 	})
 }
+
+func TestVerifyWebhookSignatureRotation(t *testing.T) {
+	originalSecret := githubAppWebhookSecret
+	originalPrevious := githubAppPreviousWebhookSecrets
+	originalSHA1 := allowSHA1Signatures
+	defer func() {
+		githubAppWebhookSecret = originalSecret
+		githubAppPreviousWebhookSecrets = originalPrevious
+		allowSHA1Signatures = originalSHA1
+	}()
+
+	githubAppWebhookSecret = "new-secret"
+	githubAppPreviousWebhookSecrets = []string{"old-secret", "older-secret"}
+
+	payload := []byte(`{"action":"published"}`)
+	sign := func(newHash func() hash.Hash, prefix, secret string) string {
+		mac := hmac.New(newHash, []byte(secret))
+		mac.Write(payload)
+		return prefix + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	tests := []struct {
+		name           string
+		headers        map[string]string
+		allowSHA1      bool
+		wantAlgorithm  string
+		wantGeneration string
+		wantErr        error
+	}{
+		{
+			name:           "current secret",
+			headers:        map[string]string{"X-Hub-Signature-256": sign(sha256.New, "sha256=", "new-secret")},
+			wantAlgorithm:  "sha256",
+			wantGeneration: "current",
+		},
+		{
+			name:           "previous secret",
+			headers:        map[string]string{"X-Hub-Signature-256": sign(sha256.New, "sha256=", "old-secret")},
+			wantAlgorithm:  "sha256",
+			wantGeneration: "previous",
+		},
+		{
+			name:           "second previous secret",
+			headers:        map[string]string{"X-Hub-Signature-256": sign(sha256.New, "sha256=", "older-secret")},
+			wantAlgorithm:  "sha256",
+			wantGeneration: "previous-2",
+		},
+		{
+			name:    "unknown secret",
+			headers: map[string]string{"X-Hub-Signature-256": sign(sha256.New, "sha256=", "wrong-secret")},
+			wantErr: errors.New("signature mismatch"),
+		},
+		{
+			name:    "sha1 only when not allowed",
+			headers: map[string]string{"X-Hub-Signature": sign(sha1.New, "sha1=", "new-secret")},
+			wantErr: errMissingSignature,
+		},
+		{
+			name:           "sha1 only when allowed",
+			headers:        map[string]string{"X-Hub-Signature": sign(sha1.New, "sha1=", "old-secret")},
+			allowSHA1:      true,
+			wantAlgorithm:  "sha1",
+			wantGeneration: "previous",
+		},
+		{
+			name: "sha256 preferred over sha1",
+			headers: map[string]string{
+				"X-Hub-Signature-256": sign(sha256.New, "sha256=", "wrong-secret"),
+				"X-Hub-Signature":     sign(sha1.New, "sha1=", "new-secret"),
+			},
+			allowSHA1: true,
+			wantErr:   errors.New("signature mismatch"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowSHA1Signatures = tt.allowSHA1
+			headers := http.Header{}
+			for name, value := range tt.headers {
+				headers.Set(name, value)
+			}
+
+			match, err := verifyWebhookSignature(payload, headers)
+
+			if tt.wantErr != nil {
+				if err == nil || err.Error() != tt.wantErr.Error() {
+					t.Fatalf("verifyWebhookSignature() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifyWebhookSignature() unexpected error = %v", err)
+			}
+			if match.Algorithm != tt.wantAlgorithm || match.Generation != tt.wantGeneration {
+				t.Errorf("verifyWebhookSignature() = %+v, want %s/%s", match, tt.wantAlgorithm, tt.wantGeneration)
+			}
+		})
+	}
+}
+
+func TestSplitSecrets(t *testing.T) {
+	got := splitSecrets("first, second\nthird\n\n")
+	want := []string{"first", "second", "third"}
+	if len(got) != len(want) {
+		t.Fatalf("splitSecrets() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("splitSecrets()[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
@@ -25,6 +25,69 @@ locals {
   account_id = data.aws_caller_identity.current.account_id
   region     = data.aws_region.current.name
   function_name = "serverless-github-app-${local.account_id}-${local.region}"
+
+  # Previous webhook secrets are only read while a rotation is in progress
+  previous_webhook_secrets_env = var.github_app_previous_webhook_secrets_ssm_path == "" ? {} : {
+    SSM_GITHUB_APP_WEBHOOK_SECRET_PREVIOUS = var.github_app_previous_webhook_secrets_ssm_path
+  }
+  previous_webhook_secrets_arns = var.github_app_previous_webhook_secrets_ssm_path == "" ? [] : [
+    "arn:aws:ssm:${local.region}:${local.account_id}:parameter${var.github_app_previous_webhook_secrets_ssm_path}"
+  ]
+}
+
+resource "aws_dynamodb_table" "deliveries" {
+  name         = "${local.function_name}-deliveries"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "delivery_id"
+
+  attribute {
+    name = "delivery_id"
+    type = "S"
+  }
+
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+}
+
+resource "aws_dynamodb_table" "installations" {
+  name         = "${local.function_name}-installations"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "installation_id"
+
+  attribute {
+    name = "installation_id"
+    type = "N"
+  }
+}
+
+resource "aws_dynamodb_table" "deferred_dispatches" {
+  name         = "${local.function_name}-deferred-dispatches"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "dispatch_id"
+
+  attribute {
+    name = "dispatch_id"
+    type = "S"
+  }
+}
+
+resource "aws_sqs_queue" "deliveries_dlq" {
+  name                      = "${local.function_name}-deliveries-dlq.fifo"
+  fifo_queue                = true
+  message_retention_seconds = 1209600
+}
+
+resource "aws_sqs_queue" "deliveries" {
+  name                       = "${local.function_name}-deliveries.fifo"
+  fifo_queue                 = true
+  visibility_timeout_seconds = 180
+
+  redrive_policy = jsonencode({
+    deadLetterTargetArn = aws_sqs_queue.deliveries_dlq.arn
+    maxReceiveCount     = 5
+  })
 }
 
 module "lambda_function" {
@@ -49,12 +112,24 @@ module "lambda_function" {
   timeout     = 30
   memory_size = 256
 
-  environment_variables = {
-    ENVIRONMENT                     = var.environment
-    SSM_GITHUB_APP_ID               = var.github_app_id_ssm_path
-    SSM_GITHUB_APP_PRIVATE_KEY      = var.github_app_private_key_ssm_path
-    SSM_GITHUB_APP_WEBHOOK_SECRET   = var.github_app_webhook_secret_ssm_path
-  }
+  environment_variables = merge({
+    ENVIRONMENT                   = var.environment
+    SSM_GITHUB_APP_ID             = var.github_app_id_ssm_path
+    SSM_GITHUB_APP_PRIVATE_KEY    = var.github_app_private_key_ssm_path
+    SSM_GITHUB_APP_WEBHOOK_SECRET = var.github_app_webhook_secret_ssm_path
+    ALLOW_SHA1_SIGNATURES         = tostring(var.allow_sha1_signatures)
+    LOG_PAYLOAD_PREVIEWS          = tostring(var.log_payload_previews)
+    IDEMPOTENCY_STORE             = "dynamodb"
+    IDEMPOTENCY_TABLE             = aws_dynamodb_table.deliveries.name
+    IDEMPOTENCY_LEASE             = "1m"
+    INSTALLATION_REGISTRY         = "dynamodb"
+    INSTALLATION_TABLE            = aws_dynamodb_table.installations.name
+    DEFERRED_DISPATCH_STORE       = "dynamodb"
+    DEFERRED_DISPATCH_TABLE       = aws_dynamodb_table.deferred_dispatches.name
+    PROCESSING_MODE               = var.processing_mode
+    DELIVERY_QUEUE                = "sqs"
+    DELIVERY_QUEUE_URL            = aws_sqs_queue.deliveries.url
+  }, local.previous_webhook_secrets_env)
 
   create_lambda_function_url = true
   authorization_type         = "NONE"
@@ -68,11 +143,263 @@ module "lambda_function" {
         "ssm:GetParameter",
         "ssm:GetParameters"
       ]
-      resources = [
+      resources = concat([
         "arn:aws:ssm:${local.region}:${local.account_id}:parameter${var.github_app_id_ssm_path}",
         "arn:aws:ssm:${local.region}:${local.account_id}:parameter${var.github_app_private_key_ssm_path}",
         "arn:aws:ssm:${local.region}:${local.account_id}:parameter${var.github_app_webhook_secret_ssm_path}"
+      ], local.previous_webhook_secrets_arns)
+    }
+    dynamodb_deliveries = {
+      effect = "Allow"
+      actions = [
+        "dynamodb:PutItem",
+        "dynamodb:DeleteItem"
+      ]
+      resources = [aws_dynamodb_table.deliveries.arn]
+    }
+    dynamodb_installations = {
+      effect = "Allow"
+      actions = [
+        "dynamodb:GetItem",
+        "dynamodb:PutItem",
+        "dynamodb:DeleteItem",
+        "dynamodb:Scan"
+      ]
+      resources = [aws_dynamodb_table.installations.arn]
+    }
+    dynamodb_deferred_dispatches = {
+      effect    = "Allow"
+      actions   = ["dynamodb:PutItem"]
+      resources = [aws_dynamodb_table.deferred_dispatches.arn]
+    }
+    sqs_send = {
+      effect    = "Allow"
+      actions   = ["sqs:SendMessage"]
+      resources = [aws_sqs_queue.deliveries.arn]
+    }
+  }
+}
+
+# Consumes the delivery queue when PROCESSING_MODE is async
+module "consumer_function" {
+  source  = "terraform-aws-modules/lambda/aws"
+  version = "~> 7.0"
+
+  function_name = "${local.function_name}-consumer"
+  handler       = "bootstrap"
+  runtime       = "provided.al2023"
+  architectures = ["arm64"]
+
+  source_path = [
+    {
+      path = "${path.module}/../app"
+      commands = [
+        "GOOS=linux GOARCH=arm64 CGO_ENABLED=0 go build -o bootstrap .",
+        ":zip"
+      ]
+    }
+  ]
+
+  timeout     = 120
+  memory_size = 256
+
+  environment_variables = {
+    ENVIRONMENT                = var.environment
+    APP_MODE                   = "consumer"
+    SSM_GITHUB_APP_ID          = var.github_app_id_ssm_path
+    SSM_GITHUB_APP_PRIVATE_KEY = var.github_app_private_key_ssm_path
+    DEFERRED_DISPATCH_STORE    = "dynamodb"
+    DEFERRED_DISPATCH_TABLE    = aws_dynamodb_table.deferred_dispatches.name
+    INSTALLATION_REGISTRY      = "dynamodb"
+    INSTALLATION_TABLE         = aws_dynamodb_table.installations.name
+  }
+
+  event_source_mapping = {
+    sqs = {
+      event_source_arn        = aws_sqs_queue.deliveries.arn
+      batch_size              = 10
+      function_response_types = ["ReportBatchItemFailures"]
+    }
+  }
+
+  allowed_triggers = {
+    sqs = {
+      principal  = "sqs.amazonaws.com"
+      source_arn = aws_sqs_queue.deliveries.arn
+    }
+  }
+
+  attach_policy_statements = true
+  policy_statements = {
+    ssm_read = {
+      effect = "Allow"
+      actions = [
+        "ssm:GetParameter",
+        "ssm:GetParameters"
+      ]
+      resources = [
+        "arn:aws:ssm:${local.region}:${local.account_id}:parameter${var.github_app_id_ssm_path}",
+        "arn:aws:ssm:${local.region}:${local.account_id}:parameter${var.github_app_private_key_ssm_path}"
+      ]
+    }
+    sqs_consume = {
+      effect = "Allow"
+      actions = [
+        "sqs:ReceiveMessage",
+        "sqs:DeleteMessage",
+        "sqs:GetQueueAttributes"
+      ]
+      resources = [aws_sqs_queue.deliveries.arn]
+    }
+    dynamodb_deferred_dispatches = {
+      effect    = "Allow"
+      actions   = ["dynamodb:PutItem"]
+      resources = [aws_dynamodb_table.deferred_dispatches.arn]
+    }
+    # Pushes changing the app config record whether the repository has schedules
+    dynamodb_installations = {
+      effect = "Allow"
+      actions = [
+        "dynamodb:GetItem",
+        "dynamodb:PutItem"
+      ]
+      resources = [aws_dynamodb_table.installations.arn]
+    }
+  }
+}
+
+# Runs scheduled tasks (e.g. redelivery of failed webhook deliveries)
+module "scheduled_function" {
+  source  = "terraform-aws-modules/lambda/aws"
+  version = "~> 7.0"
+
+  function_name = "${local.function_name}-scheduled"
+  handler       = "bootstrap"
+  runtime       = "provided.al2023"
+  architectures = ["arm64"]
+
+  source_path = [
+    {
+      path = "${path.module}/../app"
+      commands = [
+        "GOOS=linux GOARCH=arm64 CGO_ENABLED=0 go build -o bootstrap .",
+        ":zip"
+      ]
+    }
+  ]
+
+  timeout     = 300
+  memory_size = 256
+
+  environment_variables = {
+    ENVIRONMENT                = var.environment
+    APP_MODE                   = "scheduled"
+    SSM_GITHUB_APP_ID          = var.github_app_id_ssm_path
+    SSM_GITHUB_APP_PRIVATE_KEY = var.github_app_private_key_ssm_path
+    REDELIVERY_LOOKBACK        = var.redelivery_lookback
+    REDELIVERY_MAX             = tostring(var.redelivery_max)
+    DEFERRED_DISPATCH_STORE    = "dynamodb"
+    DEFERRED_DISPATCH_TABLE    = aws_dynamodb_table.deferred_dispatches.name
+    IDEMPOTENCY_STORE          = "dynamodb"
+    IDEMPOTENCY_TABLE          = aws_dynamodb_table.deliveries.name
+    IDEMPOTENCY_LEASE          = "6m"
+    INSTALLATION_REGISTRY      = "dynamodb"
+    INSTALLATION_TABLE         = aws_dynamodb_table.installations.name
+    SCHEDULE_INTERVAL          = "${var.schedule_interval_minutes}m"
+  }
+
+  allowed_triggers = {
+    redeliver = {
+      principal  = "events.amazonaws.com"
+      source_arn = aws_cloudwatch_event_rule.redeliver.arn
+    }
+    send_deferred = {
+      principal  = "events.amazonaws.com"
+      source_arn = aws_cloudwatch_event_rule.send_deferred.arn
+    }
+    dispatch_schedules = {
+      principal  = "events.amazonaws.com"
+      source_arn = aws_cloudwatch_event_rule.dispatch_schedules.arn
+    }
+  }
+  create_current_version_allowed_triggers = false
+
+  attach_policy_statements = true
+  policy_statements = {
+    ssm_read = {
+      effect = "Allow"
+      actions = [
+        "ssm:GetParameter",
+        "ssm:GetParameters"
+      ]
+      resources = [
+        "arn:aws:ssm:${local.region}:${local.account_id}:parameter${var.github_app_id_ssm_path}",
+        "arn:aws:ssm:${local.region}:${local.account_id}:parameter${var.github_app_private_key_ssm_path}"
+      ]
+    }
+    dynamodb_deferred_dispatches = {
+      effect = "Allow"
+      actions = [
+        "dynamodb:Scan",
+        "dynamodb:PutItem",
+        "dynamodb:DeleteItem"
+      ]
+      resources = [aws_dynamodb_table.deferred_dispatches.arn]
+    }
+    # Scheduled dispatch runs are claimed in the deliveries table
+    dynamodb_deliveries = {
+      effect = "Allow"
+      actions = [
+        "dynamodb:PutItem",
+        "dynamodb:DeleteItem"
+      ]
+      resources = [aws_dynamodb_table.deliveries.arn]
+    }
+    # The installations table lists the repositories with schedules
+    dynamodb_installations = {
+      effect = "Allow"
+      actions = [
+        "dynamodb:GetItem",
+        "dynamodb:PutItem"
       ]
+      resources = [aws_dynamodb_table.installations.arn]
     }
   }
 }
+
+resource "aws_cloudwatch_event_rule" "redeliver" {
+  name                = "${local.function_name}-redeliver"
+  description         = "Request redelivery of failed GitHub App webhook deliveries"
+  schedule_expression = var.redelivery_schedule
+}
+
+resource "aws_cloudwatch_event_target" "redeliver" {
+  rule  = aws_cloudwatch_event_rule.redeliver.name
+  arn   = module.scheduled_function.lambda_function_arn
+  input = jsonencode({ task = "redeliver" })
+}
+
+resource "aws_cloudwatch_event_rule" "send_deferred" {
+  name                = "${local.function_name}-send-deferred"
+  description         = "Send repository dispatches deferred by freeze windows"
+  schedule_expression = var.deferred_dispatch_schedule
+}
+
+resource "aws_cloudwatch_event_target" "send_deferred" {
+  rule  = aws_cloudwatch_event_rule.send_deferred.name
+  arn   = module.scheduled_function.lambda_function_arn
+  input = jsonencode({ task = "send-deferred" })
+}
+
+# Fires on interval boundaries, the task evaluates the schedules of the elapsed interval
+resource "aws_cloudwatch_event_rule" "dispatch_schedules" {
+  name                = "${local.function_name}-dispatch-schedules"
+  description         = "Send repository dispatches of cron schedules in app configs"
+  schedule_expression = "cron(0/${var.schedule_interval_minutes} * * * ? *)"
+}
+
+resource "aws_cloudwatch_event_target" "dispatch_schedules" {
+  rule  = aws_cloudwatch_event_rule.dispatch_schedules.name
+  arn   = module.scheduled_function.lambda_function_arn
+  input = jsonencode({ task = "dispatch-schedules" })
+}
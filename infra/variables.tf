@@ -36,3 +36,62 @@ variable "github_app_webhook_secret_ssm_path" {
   type        = string
   default     = "/dev/github-app-webhook-secret"
 }
+
+variable "github_app_previous_webhook_secrets_ssm_path" {
+  description = "SSM Parameter Store path for previous webhook secrets still accepted during a rotation (newline or comma separated). Empty when no rotation is in progress"
+  type        = string
+  default     = ""
+}
+
+variable "allow_sha1_signatures" {
+  description = "Accept the legacy X-Hub-Signature (SHA-1) header when no SHA-256 signature is sent"
+  type        = bool
+  default     = false
+}
+
+variable "log_payload_previews" {
+  description = "Log a redacted preview of webhook bodies at debug level. Enable only in non-production environments"
+  type        = bool
+  default     = false
+}
+
+variable "processing_mode" {
+  description = "Webhook processing mode: sync processes in the request, async enqueues to SQS and returns 202"
+  type        = string
+  default     = "sync"
+}
+
+variable "redelivery_schedule" {
+  description = "EventBridge schedule expression for the failed delivery redelivery task"
+  type        = string
+  default     = "rate(15 minutes)"
+}
+
+variable "redelivery_lookback" {
+  description = "How far back failed deliveries are redelivered (Go duration)"
+  type        = string
+  default     = "1h"
+}
+
+variable "redelivery_max" {
+  description = "Maximum number of redeliveries requested per run"
+  type        = number
+  default     = 25
+}
+
+variable "deferred_dispatch_schedule" {
+  description = "EventBridge schedule expression for sending dispatches deferred by freeze windows"
+  type        = string
+  default     = "rate(5 minutes)"
+}
+
+variable "schedule_interval_minutes" {
+  description = "How often the schedules of app configs are evaluated, in minutes"
+  type        = number
+  default     = 5
+
+  validation {
+    condition     = var.schedule_interval_minutes >= 1 && 60 % var.schedule_interval_minutes == 0
+    error_message = "schedule_interval_minutes must divide an hour evenly."
+  }
+}